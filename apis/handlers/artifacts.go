@@ -0,0 +1,50 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetArtifacts Returns the eBPF packages extracted on the node
+// @Summary Returns the eBPF packages extracted on the node
+// @Description Returns the eBPF package versions in the artifact cache, with their disk usage, last use and whether they are in use
+// @Accept  json
+// @Produce  json
+// @Success 200
+// @Router /l3af/artifacts [get]
+func GetArtifacts(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	entries, err := kfcfgs.ArtifactCacheEntries()
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to list artifact cache: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+
+	resp, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/kf"
+)
+
+func Test_GetArtifacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		cfg    *kf.NFConfigs
+	}{
+		{
+			name:   "EmptyCache",
+			status: http.StatusOK,
+			cfg:    &kf.NFConfigs{},
+		},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "l3af/artifacts", nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(GetArtifacts)
+		InitConfigs(tt.cfg)
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("GetArtifacts Failed")
+		}
+	}
+}
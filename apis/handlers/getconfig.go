@@ -49,7 +49,7 @@ func GetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := json.MarshalIndent(kfcfgs.EBPFPrograms(iface), "", "  ")
+	resp, err := json.MarshalIndent(kfcfgs.RedactSecrets(kfcfgs.EBPFPrograms(iface)), "", "  ")
 	if err != nil {
 		mesg = "internal server error"
 		log.Error().Msgf("failed to marshal response: %v", err)
@@ -80,7 +80,11 @@ func GetConfigAll(w http.ResponseWriter, r *http.Request) {
 		}
 	}(&mesg, &statusCode)
 
-	resp, err := json.MarshalIndent(kfcfgs.EBPFProgramsAll(), "", "  ")
+	progs := kfcfgs.EBPFProgramsAll()
+	for i := range progs {
+		progs[i] = kfcfgs.RedactSecrets(progs[i])
+	}
+	resp, err := json.MarshalIndent(progs, "", "  ")
 	if err != nil {
 		mesg = "internal server error"
 		log.Error().Msgf("failed to marshal response: %v", err)
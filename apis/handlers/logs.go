@@ -0,0 +1,86 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultLogLines is the number of lines returned when the request does not provide it
+const defaultLogLines = 100
+
+// GetProgramLogs Returns the last lines of the output of an eBPF program
+// @Summary Returns the last lines of the output of an eBPF program
+// @Description Returns the last lines of the stdout and stderr of the user program, captured in the bpf-log-dir, per attach point and direction
+// @Accept  json
+// @Produce  json
+// @Param program path string true "program name"
+// @Param attach_point query string false "interface, cgroup path or attach target"
+// @Param direction query string false "direction or hook"
+// @Param lines query int false "number of lines"
+// @Success 200
+// @Router /l3af/logs/{program} [get]
+func GetProgramLogs(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	program := chi.URLParam(r, "program")
+	if len(program) == 0 {
+		mesg = "program value is empty"
+		log.Error().Msgf(mesg)
+		statusCode = http.StatusBadRequest
+		return
+	}
+
+	query := r.URL.Query()
+	lines := defaultLogLines
+	if v := query.Get("lines"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			mesg = fmt.Sprintf("invalid lines value %s", v)
+			log.Error().Msg(mesg)
+			statusCode = http.StatusBadRequest
+			return
+		}
+		lines = n
+	}
+
+	logs, err := kfcfgs.ProgramLogs(program, query.Get("attach_point"), query.Get("direction"), lines)
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to read logs of program %s: %v", program, err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	if len(logs) == 0 {
+		mesg = fmt.Sprintf("no captured output of program %s", program)
+		statusCode = http.StatusNotFound
+		return
+	}
+
+	resp, err := json.MarshalIndent(logs, "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/l3af-project/l3afd/kf"
+)
+
+func Test_GetProgramLogs(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		query   string
+		status  int
+	}{
+		{name: "EmptyProgram", program: "", status: http.StatusBadRequest},
+		{name: "InvalidLines", program: "ratelimiting", query: "?lines=zero", status: http.StatusBadRequest},
+		{name: "NegativeLines", program: "ratelimiting", query: "?lines=-1", status: http.StatusBadRequest},
+		{name: "UnknownProgram", program: "ratelimiting", query: "?lines=10&attach_point=fakeif0", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "l3af/logs/"+tt.program+tt.query, nil)
+		rctx := chi.NewRouteContext()
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rctx.URLParams.Add("program", tt.program)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(GetProgramLogs)
+		InitConfigs(&kf.NFConfigs{})
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("GetProgramLogs Failed %s with status %d", tt.name, rr.Code)
+		}
+	}
+}
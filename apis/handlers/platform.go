@@ -0,0 +1,50 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetPlatform Returns the platform resolution of the node
+// @Summary Returns the platform resolution of the node
+// @Description Returns the platform of the node and the platform directories of the eBPF package repository tried in order
+// @Accept  json
+// @Produce  json
+// @Success 200
+// @Router /l3af/platform [get]
+func GetPlatform(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	platform, err := kfcfgs.Platform()
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to resolve platform: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+
+	resp, err := json.MarshalIndent(platform, "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/kf"
+)
+
+func Test_GetPlatform(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		cfg    *kf.NFConfigs
+	}{
+		{
+			name:   "Detected",
+			status: http.StatusOK,
+			cfg:    &kf.NFConfigs{},
+		},
+		{
+			name:   "Override",
+			status: http.StatusOK,
+			cfg:    &kf.NFConfigs{HostConfig: &config.Config{Platforms: []string{"focal", "generic"}}},
+		},
+		{
+			name:   "InvalidOverride",
+			status: http.StatusInternalServerError,
+			cfg:    &kf.NFConfigs{HostConfig: &config.Config{Platforms: []string{"../focal"}}},
+		},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "l3af/platform", nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(GetPlatform)
+		InitConfigs(tt.cfg)
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("GetPlatform Failed %s", tt.name)
+		}
+	}
+}
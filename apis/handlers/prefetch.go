@@ -0,0 +1,108 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+// PrefetchArtifacts Downloads eBPF packages in the background ahead of their deployment
+// @Summary Prefetches eBPF packages on node
+// @Description Downloads, verifies and extracts eBPF packages in the background, so that their deployment does not wait for the download
+// @Accept  json
+// @Produce  json
+// @Param refs body []models.ArtifactRef true "eBPF packages"
+// @Success 202
+// @Router /l3af/artifacts/prefetch [post]
+func PrefetchArtifacts(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusAccepted
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	if r.Body == nil {
+		mesg = "empty request body"
+		log.Warn().Msg(mesg)
+		statusCode = http.StatusBadRequest
+		return
+	}
+	bodyBuffer, err := io.ReadAll(r.Body)
+	if err != nil {
+		mesg = fmt.Sprintf("failed to read request body: %v", err)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+
+	var refs []models.ArtifactRef
+	if err := json.Unmarshal(bodyBuffer, &refs); err != nil {
+		mesg = fmt.Sprintf("failed to unmarshal payload: %v", err)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusBadRequest
+		return
+	}
+
+	statuses, err := kfcfgs.PrefetchArtifacts(refs)
+	if err != nil {
+		mesg = fmt.Sprintf("failed to prefetch artifacts: %v", err)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusBadRequest
+		return
+	}
+
+	resp, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
+
+// GetPrefetchStatus Returns the status of the prefetched eBPF packages
+// @Summary Returns the status of the prefetched eBPF packages
+// @Description Returns the state of the eBPF packages being prefetched and of those prefetched within the last hour
+// @Accept  json
+// @Produce  json
+// @Success 200
+// @Router /l3af/artifacts/prefetch [get]
+func GetPrefetchStatus(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	resp, err := json.MarshalIndent(kfcfgs.PrefetchStatus(), "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/kf"
+)
+
+func Test_PrefetchArtifacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		Body   *bytes.Buffer
+		status int
+		cfg    *kf.NFConfigs
+	}{
+		{
+			name:   "NilBody",
+			Body:   nil,
+			status: http.StatusBadRequest,
+			cfg:    &kf.NFConfigs{},
+		},
+		{
+			name:   "InvalidPayload",
+			Body:   bytes.NewBufferString(`{"name": "foo"}`),
+			status: http.StatusBadRequest,
+			cfg:    &kf.NFConfigs{},
+		},
+		{
+			name:   "PrefetchNotConfigured",
+			Body:   bytes.NewBufferString(`[{"name": "foo", "version": "1.0", "artifact": "foo.tar.gz"}]`),
+			status: http.StatusBadRequest,
+			cfg:    &kf.NFConfigs{},
+		},
+	}
+	for _, tt := range tests {
+		var req *http.Request
+		if tt.Body == nil {
+			req, _ = http.NewRequest("POST", "/l3af/artifacts/prefetch", nil)
+		} else {
+			req, _ = http.NewRequest("POST", "/l3af/artifacts/prefetch", tt.Body)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(PrefetchArtifacts)
+		InitConfigs(tt.cfg)
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("PrefetchArtifacts Failed %s, got status %d", tt.name, rr.Code)
+		}
+	}
+}
+
+func Test_GetPrefetchStatus(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/l3af/artifacts/prefetch", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(GetPrefetchStatus)
+	InitConfigs(&kf.NFConfigs{})
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "[]" {
+		t.Errorf("GetPrefetchStatus Failed, got status %d body %s", rr.Code, rr.Body.String())
+	}
+}
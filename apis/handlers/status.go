@@ -0,0 +1,42 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetProgramStatus Returns the run time state of the eBPF programs
+// @Summary Returns the run time state of the eBPF programs
+// @Description Returns the state, restart policy, restart count and last exit of the eBPF programs. Programs whose restarts are exhausted are in crash-loop state
+// @Accept  json
+// @Produce  json
+// @Success 200
+// @Router /l3af/status [get]
+func GetProgramStatus(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	resp, err := json.MarshalIndent(kfcfgs.ProgramStatus(), "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
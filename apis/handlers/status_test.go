@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/kf"
+)
+
+func Test_GetProgramStatus(t *testing.T) {
+	req, _ := http.NewRequest("GET", "l3af/status", nil)
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(GetProgramStatus)
+	InitConfigs(&kf.NFConfigs{})
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("GetProgramStatus Failed with status %d", rr.Code)
+	}
+	if rr.Body.String() != "[]" {
+		t.Errorf("GetProgramStatus returned %s, want no programs", rr.Body.String())
+	}
+}
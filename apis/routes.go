@@ -39,6 +39,36 @@ func apiRoutes(ctx context.Context, kfcfg *kf.NFConfigs) []routes.Route {
 			Path:        "/l3af/configs/{version}/delete",
 			HandlerFunc: handlers.DeleteEbpfPrograms(ctx, kfcfg),
 		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/artifacts",
+			HandlerFunc: handlers.GetArtifacts,
+		},
+		{
+			Method:      "POST",
+			Path:        "/l3af/artifacts/prefetch",
+			HandlerFunc: handlers.PrefetchArtifacts,
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/artifacts/prefetch",
+			HandlerFunc: handlers.GetPrefetchStatus,
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/platform",
+			HandlerFunc: handlers.GetPlatform,
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/status",
+			HandlerFunc: handlers.GetProgramStatus,
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/logs/{program}",
+			HandlerFunc: handlers.GetProgramLogs,
+		},
 	}
 
 	return r
@@ -5,7 +5,9 @@
 package config
 
 import (
+	"crypto/ed25519"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"strings"
 	"time"
@@ -18,11 +20,26 @@ const (
 	ENV_PROD = "PROD"
 )
 
+// TC attach modes of programs loaded by l3afd
+const (
+	TCAttachAuto    = "auto"
+	TCAttachTCX     = "tcx"
+	TCAttachNetlink = "netlink"
+)
+
 type Config struct {
-	PIDFilename         string
-	DataCenter          string
-	BPFDir              string
-	BPFLogDir           string
+	PIDFilename string
+	DataCenter  string
+	BPFDir      string
+	BPFLogDir   string
+	// Rotation of the logs capturing the output of user programs in BPFLogDir
+	BPFLogMaxSizeMB int
+	BPFLogMaxFiles  int
+	// Last lines of the log attached to the error of a failed start
+	BPFLogTailLines int
+	// User programs run in their own cgroup v2 under the slice, not isolated when the slice is empty
+	UserCgroupRoot      string
+	UserCgroupSlice     string
 	MinKernelMajorVer   int
 	MinKernelMinorVer   int
 	EBPFRepoURL         string
@@ -33,6 +50,62 @@ type Config struct {
 	// Flag to enable chaining with root program
 	BpfChainingEnabled bool
 
+	// Restart of user programs which are not running
+	// Wait time before the second restart, doubled on every following restart
+	RestartBackoff    time.Duration
+	RestartMaxBackoff time.Duration
+	// Programs running for the success window get their restart count reset
+	RestartSuccessWindow time.Duration
+	// Maximum number of restarts of all the programs of the host in the budget interval, 0 means unlimited
+	RestartBudget         int
+	RestartBudgetInterval time.Duration
+	// Time given to user programs to exit once stopped before they are killed, unless set by the program
+	StopGracePeriod time.Duration
+	// Time the user programs are waited for to pin or remove their maps, unless set by the program
+	BPFWaitTimeout time.Duration
+	// State files of the running user programs, adopted by the next l3afd instance
+	BPFStateDir string
+	// Secret files given to user programs, and the private tmpfs directories they are written to
+	SecretsDir    string
+	SecretsRunDir string
+
+	// Artifact verification
+	// ed25519 public keys trusted to sign eBPF artifacts
+	ArtifactTrustedKeys []ed25519.PublicKey
+	// Refuse artifacts which do not carry a valid digest and signature
+	ArtifactRequireSignature bool
+
+	// Artifact download
+	DownloadRetries      int
+	DownloadRetryBackoff time.Duration
+	DownloadMaxBackoff   time.Duration
+	MaxArtifactSizeMB    int
+	MaxExtractedSizeMB   int
+	MaxExtractedFiles    int
+	// Credentials for OCI registries serving eBPF packages
+	RegistryUsername string
+	RegistryPassword string
+
+	// Platform directories of the eBPF package repository tried in order, overrides the detected platform
+	Platforms []string
+
+	// Mirrors of the eBPF package repository, tried in order after EBPFRepoURL
+	EBPFRepoMirrorURLs []string
+	// Repositories failing to serve a package are tried last during the cooldown
+	EBPFRepoFailureCooldown time.Duration
+	// TLS and proxy settings of the eBPF package repository client
+	EBPFRepoCABundle   string
+	EBPFRepoClientCert string
+	EBPFRepoClientKey  string
+	EBPFRepoProxy      string
+
+	// Artifact cache
+	ArtifactCacheKeepVersions int
+	ArtifactCacheQuotaMB      int
+
+	// Number of eBPF packages prefetched concurrently
+	ArtifactPrefetchConcurrency int
+
 	// stats
 	// Prometheus endpoint for pull/scrape the metrics.
 	MetricsAddr      string
@@ -40,6 +113,8 @@ type Config struct {
 	NMetricSamples   int
 
 	ShutdownTimeout time.Duration
+	// Leave programs loaded by l3afd attached on shutdown, the next l3afd instance adopts them
+	KeepAttachedOnShutdown bool
 
 	SwaggerApiEnabled bool
 
@@ -51,6 +126,10 @@ type Config struct {
 	XDPRootVersion           string
 	XDPRootObjectFile        string
 	XDPRootEntryFunctionName string
+	XDPRootArtifactSHA256    string
+	XDPRootArtifactSignature string
+	// Load the root program from its object file instead of running its command
+	XDPRootNativeLoad bool
 
 	// TC Root program details.
 	TCRootPackageName              string
@@ -63,6 +142,15 @@ type Config struct {
 	TCRootEgressObjectFile         string
 	TCRootIngressEntryFunctionName string
 	TCRootEgressEntryFunctionName  string
+	TCRootArtifactSHA256           string
+	TCRootArtifactSignature        string
+	// Load the root programs from their object files instead of running the command
+	TCRootNativeLoad bool
+
+	// TC attachment of programs loaded by l3afd, TCX links on kernels supporting them or clsact filters
+	TCAttachMode     string
+	TCFilterPriority int
+	TCFilterHandle   int
 
 	// ebpf chain details
 	EBPFChainDebugAddr    string
@@ -97,22 +185,66 @@ func ReadConfig(configPath string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	trustedKeys, err := loadTrustedKeys(confReader, "ebpf-repo", "trusted-public-keys")
+	if err != nil {
+		return nil, err
+	}
+	tcAttachMode, err := loadTCAttachMode(confReader)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		PIDFilename:                    LoadConfigString(confReader, "l3afd", "pid-file"),
 		DataCenter:                     LoadConfigString(confReader, "l3afd", "datacenter"),
 		BPFDir:                         LoadConfigString(confReader, "l3afd", "bpf-dir"),
 		BPFLogDir:                      LoadOptionalConfigString(confReader, "l3afd", "bpf-log-dir", ""),
+		BPFLogMaxSizeMB:                LoadOptionalConfigInt(confReader, "l3afd", "bpf-log-max-size-mb", 10),
+		BPFLogMaxFiles:                 LoadOptionalConfigInt(confReader, "l3afd", "bpf-log-max-files", 3),
+		BPFLogTailLines:                LoadOptionalConfigInt(confReader, "l3afd", "bpf-log-tail-lines", 20),
+		UserCgroupRoot:                 LoadOptionalConfigString(confReader, "l3afd", "cgroup-root", "/sys/fs/cgroup"),
+		UserCgroupSlice:                LoadOptionalConfigString(confReader, "l3afd", "cgroup-slice", "l3afd.slice"),
 		MinKernelMajorVer:              LoadOptionalConfigInt(confReader, "l3afd", "kernel-major-version", 5),
 		MinKernelMinorVer:              LoadOptionalConfigInt(confReader, "l3afd", "kernel-minor-version", 1),
 		EBPFRepoURL:                    LoadConfigString(confReader, "ebpf-repo", "url"),
 		HttpClientTimeout:              LoadOptionalConfigDuration(confReader, "l3afd", "http-client-timeout", 10*time.Second),
 		MaxEBPFReStartCount:            LoadOptionalConfigInt(confReader, "l3afd", "max-ebpf-restart-count", 3),
 		BpfChainingEnabled:             LoadConfigBool(confReader, "l3afd", "bpf-chaining-enabled"),
+		RestartBackoff:                 LoadOptionalConfigDuration(confReader, "l3afd", "restart-backoff", 1*time.Second),
+		RestartMaxBackoff:              LoadOptionalConfigDuration(confReader, "l3afd", "restart-max-backoff", 5*time.Minute),
+		RestartSuccessWindow:           LoadOptionalConfigDuration(confReader, "l3afd", "restart-success-window", 10*time.Minute),
+		RestartBudget:                  LoadOptionalConfigInt(confReader, "l3afd", "restart-budget", 10),
+		RestartBudgetInterval:          LoadOptionalConfigDuration(confReader, "l3afd", "restart-budget-interval", 1*time.Minute),
+		StopGracePeriod:                LoadOptionalConfigDuration(confReader, "l3afd", "stop-grace-period", 5*time.Second),
+		BPFWaitTimeout:                 LoadOptionalConfigDuration(confReader, "l3afd", "bpf-wait-timeout", 10*time.Second),
+		BPFStateDir:                    LoadOptionalConfigString(confReader, "l3afd", "bpf-state-dir", "/var/l3afd/state"),
+		SecretsDir:                     LoadOptionalConfigString(confReader, "l3afd", "secrets-dir", "/etc/l3afd/secrets"),
+		SecretsRunDir:                  LoadOptionalConfigString(confReader, "l3afd", "secrets-run-dir", "/run/l3afd/secrets"),
+		ArtifactTrustedKeys:            trustedKeys,
+		ArtifactRequireSignature:       LoadOptionalConfigBool(confReader, "ebpf-repo", "require-signature", false),
+		DownloadRetries:                LoadOptionalConfigInt(confReader, "ebpf-repo", "download-retries", 3),
+		DownloadRetryBackoff:           LoadOptionalConfigDuration(confReader, "ebpf-repo", "download-retry-backoff", 1*time.Second),
+		DownloadMaxBackoff:             LoadOptionalConfigDuration(confReader, "ebpf-repo", "download-max-backoff", 30*time.Second),
+		MaxArtifactSizeMB:              LoadOptionalConfigInt(confReader, "ebpf-repo", "max-artifact-size-mb", 512),
+		MaxExtractedSizeMB:             LoadOptionalConfigInt(confReader, "ebpf-repo", "max-extracted-size-mb", 2048),
+		MaxExtractedFiles:              LoadOptionalConfigInt(confReader, "ebpf-repo", "max-extracted-files", 10000),
+		RegistryUsername:               LoadOptionalConfigString(confReader, "ebpf-repo", "registry-username", ""),
+		RegistryPassword:               LoadOptionalConfigString(confReader, "ebpf-repo", "registry-password", ""),
+		Platforms:                      LoadOptionalConfigStringCSV(confReader, "ebpf-repo", "platform", []string{}),
+		EBPFRepoMirrorURLs:             LoadOptionalConfigStringCSV(confReader, "ebpf-repo", "mirror-urls", []string{}),
+		EBPFRepoFailureCooldown:        LoadOptionalConfigDuration(confReader, "ebpf-repo", "failure-cooldown", 1*time.Minute),
+		EBPFRepoCABundle:               LoadOptionalConfigString(confReader, "ebpf-repo", "ca-bundle", ""),
+		EBPFRepoClientCert:             LoadOptionalConfigString(confReader, "ebpf-repo", "client-cert", ""),
+		EBPFRepoClientKey:              LoadOptionalConfigString(confReader, "ebpf-repo", "client-key", ""),
+		EBPFRepoProxy:                  LoadOptionalConfigString(confReader, "ebpf-repo", "proxy", ""),
+		ArtifactCacheKeepVersions:      LoadOptionalConfigInt(confReader, "artifact-cache", "keep-versions", 2),
+		ArtifactCacheQuotaMB:           LoadOptionalConfigInt(confReader, "artifact-cache", "disk-quota-mb", 0),
+		ArtifactPrefetchConcurrency:    LoadOptionalConfigInt(confReader, "artifact-cache", "prefetch-concurrency", 2),
 		MetricsAddr:                    LoadConfigString(confReader, "web", "metrics-addr"),
 		EBPFPollInterval:               LoadOptionalConfigDuration(confReader, "web", "ebpf-poll-interval", 30*time.Second),
 		NMetricSamples:                 LoadOptionalConfigInt(confReader, "web", "n-metric-samples", 20),
 		ShutdownTimeout:                LoadOptionalConfigDuration(confReader, "l3afd", "shutdown-timeout", 5*time.Second),
+		KeepAttachedOnShutdown:         LoadOptionalConfigBool(confReader, "l3afd", "keep-attached-on-shutdown", false),
 		SwaggerApiEnabled:              LoadOptionalConfigBool(confReader, "l3afd", "swagger-api-enabled", false),
 		Environment:                    LoadOptionalConfigString(confReader, "l3afd", "environment", ENV_PROD),
 		BpfMapDefaultPath:              LoadConfigString(confReader, "l3afd", "BpfMapDefaultPath"),
@@ -123,6 +255,9 @@ func ReadConfig(configPath string) (*Config, error) {
 		XDPRootVersion:                 loadXDPRootVersion(confReader),
 		XDPRootObjectFile:              LoadOptionalConfigString(confReader, "xdp-root", "object-file", "xdp_root_kern.o"),
 		XDPRootEntryFunctionName:       LoadOptionalConfigString(confReader, "xdp-root", "entry-function-name", "xdp_root"),
+		XDPRootArtifactSHA256:          LoadOptionalConfigString(confReader, "xdp-root", "artifact-sha256", ""),
+		XDPRootArtifactSignature:       LoadOptionalConfigString(confReader, "xdp-root", "artifact-signature", ""),
+		XDPRootNativeLoad:              LoadOptionalConfigBool(confReader, "xdp-root", "native-load", false),
 		TCRootPackageName:              loadTCRootPackageName(confReader),
 		TCRootArtifact:                 loadTCRootArtifact(confReader),
 		TCRootIngressMapName:           loadTCRootIngressMapName(confReader),
@@ -133,6 +268,12 @@ func ReadConfig(configPath string) (*Config, error) {
 		TCRootEgressObjectFile:         LoadOptionalConfigString(confReader, "tc-root", "egress-object-file", "tc_root_egress_kern.o"),
 		TCRootIngressEntryFunctionName: LoadOptionalConfigString(confReader, "tc-root", "ingress-entry-function-name", "tc_ingress_root"),
 		TCRootEgressEntryFunctionName:  LoadOptionalConfigString(confReader, "tc-root", "egress-entry-function-name", "tc_egress_root"),
+		TCRootArtifactSHA256:           LoadOptionalConfigString(confReader, "tc-root", "artifact-sha256", ""),
+		TCRootArtifactSignature:        LoadOptionalConfigString(confReader, "tc-root", "artifact-signature", ""),
+		TCRootNativeLoad:               LoadOptionalConfigBool(confReader, "tc-root", "native-load", false),
+		TCAttachMode:                   tcAttachMode,
+		TCFilterPriority:               LoadOptionalConfigInt(confReader, "tc-attach", "priority", 1),
+		TCFilterHandle:                 LoadOptionalConfigInt(confReader, "tc-attach", "handle", 1),
 		EBPFChainDebugAddr:             LoadOptionalConfigString(confReader, "ebpf-chain-debug", "addr", "localhost:8899"),
 		EBPFChainDebugEnabled:          LoadOptionalConfigBool(confReader, "ebpf-chain-debug", "enabled", false),
 		L3afConfigsRestAPIAddr:         LoadOptionalConfigString(confReader, "l3af-configs", "restapi-addr", "localhost:53000"),
@@ -162,6 +303,37 @@ func loadTLSVersion(cfgRdr *config.Config, fieldName string) (uint16, error) {
 	}
 }
 
+func loadTCAttachMode(cfgRdr *config.Config) (string, error) {
+	mode := strings.TrimSpace(LoadOptionalConfigString(cfgRdr, "tc-attach", "mode", TCAttachAuto))
+	switch mode {
+	case TCAttachAuto, TCAttachTCX, TCAttachNetlink:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported tc-attach mode %q, use %s, %s or %s", mode, TCAttachAuto, TCAttachTCX, TCAttachNetlink)
+	}
+}
+
+// loadTrustedKeys - parses the comma separated list of base64 encoded ed25519 public keys
+// used to verify artifact signatures.
+func loadTrustedKeys(cfgRdr *config.Config, group, field string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0)
+	for _, encKey := range LoadOptionalConfigStringCSV(cfgRdr, group, field, []string{}) {
+		encKey = strings.TrimSpace(encKey)
+		if encKey == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode trusted public key %q: %v", encKey, err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("trusted public key %q has invalid length %d, expected %d", encKey, len(key), ed25519.PublicKeySize)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
 func loadXDPRootPackageName(cfgRdr *config.Config) string {
 	xdpRootPackageName := LoadOptionalConfigString(cfgRdr, "xdp-root-program", "name", "")
 	if xdpRootPackageName == "" {
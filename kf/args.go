@@ -0,0 +1,162 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+// commandArgs renders the arguments of a user program command as --key=value flags, sorted by
+// key. Lists are comma-joined or repeated depending on the arg list format of the program.
+func (b *BPF) commandArgs(field string, args models.L3afDNFArgs) ([]string, error) {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	flags := make([]string, 0, len(args))
+	for _, k := range keys {
+		if err := validateArgKey(k); err != nil {
+			return nil, fmt.Errorf("%s of the ebpf program %s: %v", field, b.Program.Name, err)
+		}
+		values, err := argValues(args[k], b.Program.ArgListFormat)
+		if err != nil {
+			return nil, fmt.Errorf("%s key %s of the ebpf program %s: %v", field, k, b.Program.Name, err)
+		}
+		for _, v := range values {
+			flags = append(flags, "--"+k+"="+v)
+		}
+	}
+	return flags, nil
+}
+
+// validateArgKey checks the key is usable as a --key=value flag
+func validateArgKey(key string) error {
+	switch {
+	case len(key) == 0:
+		return fmt.Errorf("empty key")
+	case strings.HasPrefix(key, "-"):
+		return fmt.Errorf("key %q starts with -", key)
+	case strings.ContainsAny(key, "= \t\n\x00"):
+		return fmt.Errorf("key %q contains = or white space", key)
+	}
+	return nil
+}
+
+// argValues renders the value of an argument, one value per flag. Lists are expanded into one value
+// per element with the repeat format and joined with commas otherwise, empty lists are omitted.
+func argValues(value interface{}, format string) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		if l, isStrings := value.([]string); isStrings {
+			list, ok = make([]interface{}, 0, len(l)), true
+			for _, e := range l {
+				list = append(list, e)
+			}
+		}
+	}
+	if !ok {
+		v, err := argString(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+
+	values := make([]string, 0, len(list))
+	for _, e := range list {
+		v, err := argString(e)
+		if err != nil {
+			return nil, err
+		}
+		if format != models.ArgListRepeat && strings.Contains(v, ",") {
+			return nil, fmt.Errorf("list element %q contains a comma, use the %s arg list format", v, models.ArgListRepeat)
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 || format == models.ArgListRepeat {
+		return values, nil
+	}
+	return []string{strings.Join(values, ",")}, nil
+}
+
+// argString renders a single value, objects and nested lists as JSON
+func argString(value interface{}) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("null value")
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("invalid number %v", v)
+		}
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		s = v.String()
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid object: %v", err)
+		}
+		s = string(data)
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+	if strings.ContainsRune(s, 0) {
+		return "", fmt.Errorf("value contains a NUL byte")
+	}
+	return s, nil
+}
+
+// mapArgValue renders the value of a map argument, lists are always comma-joined
+func mapArgValue(value interface{}) (string, error) {
+	if _, ok := value.(map[string]interface{}); ok {
+		return "", fmt.Errorf("objects are not supported by map args")
+	}
+	values, err := argValues(value, models.ArgListComma)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(values, ","), nil
+}
+
+// validateArgs checks the arguments of the program render into flags, before any command is run
+func (b *BPF) validateArgs() error {
+	switch b.Program.ArgListFormat {
+	case "", models.ArgListComma, models.ArgListRepeat:
+	default:
+		return fmt.Errorf("unknown arg list format %s of program %s, expected %s or %s", b.Program.ArgListFormat,
+			b.Program.Name, models.ArgListComma, models.ArgListRepeat)
+	}
+	for _, field := range []string{"start_args", "stop_args", "status_args", "update_args", "config_args"} {
+		args, _ := programArgs(&b.Program, field)
+		if _, err := b.commandArgs(field, args); err != nil {
+			return err
+		}
+	}
+	for k, val := range b.Program.MapArgs {
+		if _, err := mapArgValue(val); err != nil {
+			return fmt.Errorf("map_args key %s of the ebpf program %s: %v", k, b.Program.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_commandArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		format  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Empty", args: `{}`, want: []string{}},
+		{name: "Sorted", args: `{"verbose":"2","collector_ip":"10.10.10.2"}`, want: []string{"--collector_ip=10.10.10.2", "--verbose=2"}},
+		{name: "Numbers", args: `{"rate":2,"ratio":0.5,"max":10000000000}`, want: []string{"--max=10000000000", "--rate=2", "--ratio=0.5"}},
+		{name: "Bool", args: `{"debug":true,"trace":false}`, want: []string{"--debug=true", "--trace=false"}},
+		{name: "CommaList", args: `{"ports":[80,443]}`, want: []string{"--ports=80,443"}},
+		{name: "RepeatList", args: `{"ports":[80,443]}`, format: models.ArgListRepeat, want: []string{"--ports=80", "--ports=443"}},
+		{name: "EmptyList", args: `{"ports":[]}`, want: []string{}},
+		{name: "Object", args: `{"limits":{"rate":2,"burst":[1,2]}}`, want: []string{`--limits={"burst":[1,2],"rate":2}`}},
+		{name: "CommaInList", args: `{"hosts":["a,b"]}`, wantErr: true},
+		{name: "CommaInRepeatList", args: `{"hosts":["a,b"]}`, format: models.ArgListRepeat, want: []string{"--hosts=a,b"}},
+		{name: "Null", args: `{"rate":null}`, wantErr: true},
+		{name: "EmptyKey", args: `{"":"2"}`, wantErr: true},
+		{name: "FlagKey", args: `{"-rate":"2"}`, wantErr: true},
+		{name: "KeyWithEquals", args: `{"rate=3":"2"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args models.L3afDNFArgs
+			if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+				t.Fatal(err)
+			}
+			b := &BPF{Program: models.BPFProgram{Name: "foo", ArgListFormat: tt.format}}
+			got, err := b.commandArgs("start_args", args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("commandArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commandArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_validateArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		prog    models.BPFProgram
+		wantErr bool
+	}{
+		{name: "Valid", prog: models.BPFProgram{StartArgs: models.L3afDNFArgs{"rate": float64(2)}, MapArgs: models.L3afDNFArgs{"rl_ports_map": []interface{}{float64(80), float64(443)}}}},
+		{name: "UnknownFormat", prog: models.BPFProgram{ArgListFormat: "space"}, wantErr: true},
+		{name: "InvalidStatusArgs", prog: models.BPFProgram{StatusArgs: models.L3afDNFArgs{"rate": nil}}, wantErr: true},
+		{name: "ObjectMapArgs", prog: models.BPFProgram{MapArgs: models.L3afDNFArgs{"rl_config_map": map[string]interface{}{"rate": "2"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: tt.prog}
+			if err := b.validateArgs(); (err != nil) != tt.wantErr {
+				t.Errorf("validateArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// artifactCacheMarker is kept in every package version directory managed by the artifact cache.
+// Its modification time is the last time the version was used. Directories without the marker
+// are never evicted, since BPFDir may be shared with other applications.
+const artifactCacheMarker = ".l3af-cache"
+
+// ArtifactCache manages the extracted eBPF packages under BPFDir/<name>/<version>. It keeps
+// the versions referenced by running BPF programs and the most recently used versions of every
+// program, and evicts the other versions in least recently used order once the disk quota is exceeded.
+type ArtifactCache struct {
+	dir          string
+	keepVersions int
+	quota        int64
+	mu           sync.Mutex
+}
+
+// NewArtifactCache returns the artifact cache for the BPFDir of the host config
+func NewArtifactCache(conf *config.Config) *ArtifactCache {
+	return &ArtifactCache{
+		dir:          conf.BPFDir,
+		keepVersions: conf.ArtifactCacheKeepVersions,
+		quota:        int64(conf.ArtifactCacheQuotaMB) << 20,
+	}
+}
+
+// artifactKey returns the cache key of a package version
+func artifactKey(name, version string) string {
+	return name + "/" + version
+}
+
+// markArtifactUsed records the package version of the program as used now
+func (b *BPF) markArtifactUsed(conf *config.Config) error {
+	marker := filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version, artifactCacheMarker)
+	now := time.Now()
+	if err := os.Chtimes(marker, now, now); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return fmt.Errorf("failed to mark artifact %s as used: %v", marker, err)
+	}
+	return nil
+}
+
+// Entries returns the cached package versions, most recently used first
+func (a *ArtifactCache) Entries(inUse map[string]bool) ([]models.ArtifactCacheEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.entries(inUse)
+}
+
+func (a *ArtifactCache) entries(inUse map[string]bool) ([]models.ArtifactCacheEntry, error) {
+	markers, err := filepath.Glob(filepath.Join(a.dir, "*", "*", artifactCacheMarker))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifact cache: %v", err)
+	}
+
+	entries := make([]models.ArtifactCacheEntry, 0, len(markers))
+	for _, marker := range markers {
+		info, err := os.Stat(marker)
+		if err != nil {
+			continue
+		}
+		versionDir := filepath.Dir(marker)
+		entry := models.ArtifactCacheEntry{
+			Name:     filepath.Base(filepath.Dir(versionDir)),
+			Version:  filepath.Base(versionDir),
+			LastUsed: info.ModTime(),
+		}
+		entry.InUse = inUse[artifactKey(entry.Name, entry.Version)]
+		if entry.SizeBytes, err = dirSize(versionDir); err != nil {
+			log.Warn().Err(err).Msgf("failed to compute size of artifact %s", versionDir)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// GC evicts the package versions which are neither in use nor among the keepVersions most
+// recently used versions of their program, in least recently used order until the cache fits
+// into the quota. Nothing is evicted without a quota.
+func (a *ArtifactCache) GC(inUse map[string]bool) error {
+	if a.quota <= 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries, err := a.entries(inUse)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	var candidates []models.ArtifactCacheEntry
+	kept := make(map[string]int)
+	for _, entry := range entries {
+		total += entry.SizeBytes
+		if entry.InUse {
+			continue
+		}
+		if kept[entry.Name] < a.keepVersions {
+			kept[entry.Name]++
+			continue
+		}
+		candidates = append(candidates, entry)
+	}
+
+	// candidates are ordered most recently used first, evict from the back
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if total <= a.quota {
+			break
+		}
+		entry := candidates[i]
+		versionDir := filepath.Join(a.dir, entry.Name, entry.Version)
+		log.Info().Msgf("evicting artifact %s version %s from cache, last used %s", entry.Name, entry.Version, entry.LastUsed)
+		if err := os.RemoveAll(versionDir); err != nil {
+			return fmt.Errorf("failed to evict artifact %s: %v", versionDir, err)
+		}
+		total -= entry.SizeBytes
+	}
+
+	if total > a.quota {
+		log.Warn().Msgf("artifact cache size %d bytes exceeds quota %d bytes, remaining versions are in use or kept", total, a.quota)
+	}
+	return nil
+}
+
+// dirSize returns the disk usage of the regular files below dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,125 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// cacheVersion extracts a fake package version of size bytes, last used age ago
+func cacheVersion(t *testing.T, dir, name, version string, size int, age time.Duration) {
+	versionDir := filepath.Join(dir, name, version)
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		t.Fatalf("failed to create version directory %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "prog"), make([]byte, size), 0644); err != nil {
+		t.Fatalf("failed to create artifact %v", err)
+	}
+	b := &BPF{Program: models.BPFProgram{Name: name, Version: version}}
+	if err := b.markArtifactUsed(&config.Config{BPFDir: dir}); err != nil {
+		t.Fatalf("markArtifactUsed() error = %v", err)
+	}
+	lastUsed := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(versionDir, artifactCacheMarker), lastUsed, lastUsed); err != nil {
+		t.Fatalf("failed to set last used time %v", err)
+	}
+}
+
+func TestArtifactCache_GC(t *testing.T) {
+	tests := []struct {
+		name         string
+		keepVersions int
+		quotaMB      int
+		inUse        map[string]bool
+		want         []string
+	}{
+		{
+			name:         "NoQuota",
+			keepVersions: 0,
+			inUse:        map[string]bool{"foo/2.0": true},
+			want:         []string{"bar/1.0", "bar/2.0", "foo/1.0", "foo/2.0", "foo/3.0", "unmanaged/1.0"},
+		},
+		{
+			name:         "QuotaExceededKeepNone",
+			keepVersions: 0,
+			quotaMB:      1,
+			inUse:        map[string]bool{"foo/2.0": true},
+			want:         []string{"foo/2.0", "unmanaged/1.0"},
+		},
+		{
+			name:         "WithinQuota",
+			keepVersions: 1,
+			quotaMB:      10,
+			inUse:        map[string]bool{},
+			want:         []string{"bar/1.0", "bar/2.0", "foo/1.0", "foo/2.0", "foo/3.0", "unmanaged/1.0"},
+		},
+		{
+			name:         "QuotaExceededEvictLRU",
+			keepVersions: 1,
+			quotaMB:      4,
+			inUse:        map[string]bool{"foo/1.0": true},
+			want:         []string{"bar/2.0", "foo/1.0", "foo/2.0", "foo/3.0", "unmanaged/1.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cacheVersion(t, dir, "foo", "1.0", 1<<20, 5*time.Hour)
+			cacheVersion(t, dir, "foo", "2.0", 1<<20, 3*time.Hour)
+			cacheVersion(t, dir, "foo", "3.0", 1<<20, 1*time.Hour)
+			cacheVersion(t, dir, "bar", "1.0", 1<<20, 4*time.Hour)
+			cacheVersion(t, dir, "bar", "2.0", 1<<20, 2*time.Hour)
+			// extracted outside of the cache, never evicted
+			if err := os.MkdirAll(filepath.Join(dir, "unmanaged", "1.0"), 0755); err != nil {
+				t.Fatalf("failed to create version directory %v", err)
+			}
+
+			a := NewArtifactCache(&config.Config{BPFDir: dir, ArtifactCacheKeepVersions: tt.keepVersions, ArtifactCacheQuotaMB: tt.quotaMB})
+			if err := a.GC(tt.inUse); err != nil {
+				t.Fatalf("GC() error = %v", err)
+			}
+
+			got, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+			if err != nil {
+				t.Fatalf("failed to list cache %v", err)
+			}
+			for i := range got {
+				got[i], _ = filepath.Rel(dir, got[i])
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GC() left %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArtifactCache_Entries(t *testing.T) {
+	dir := t.TempDir()
+	cacheVersion(t, dir, "foo", "1.0", 10, 2*time.Hour)
+	cacheVersion(t, dir, "foo", "2.0", 20, time.Hour)
+
+	a := NewArtifactCache(&config.Config{BPFDir: dir})
+	entries, err := a.Entries(map[string]bool{"foo/1.0": true})
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Entries() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].Version != "2.0" || entries[0].SizeBytes != 20 || entries[0].InUse {
+		t.Errorf("Entries()[0] = %+v, want most recently used version 2.0 not in use", entries[0])
+	}
+	if entries[1].Version != "1.0" || entries[1].SizeBytes != 10 || !entries[1].InUse {
+		t.Errorf("Entries()[1] = %+v, want version 1.0 in use", entries[1])
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// partialDownloadSuffix is appended to the artifact name while it is being downloaded
+const partialDownloadSuffix = ".part"
+
+// errArtifactTooLarge is returned when the artifact exceeds the configured max artifact size
+var errArtifactTooLarge = errors.New("artifact exceeds max artifact size")
+
+// retryableError marks download errors which are worth another attempt
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// idleTimeoutReader cancels the request of the body once no data was received for the timeout, so
+// that a stalled transfer fails instead of blocking the download forever
+type idleTimeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	t := &idleTimeoutReader{r: r, timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&t.expired, 1)
+		cancel()
+	})
+	return t
+}
+
+func (t *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err != nil && atomic.LoadInt32(&t.expired) == 1 {
+		return n, fmt.Errorf("no data received for %s", t.timeout)
+	}
+	if n > 0 {
+		t.timer.Reset(t.timeout)
+	}
+	return n, err
+}
+
+// stop releases the timer once the body is read
+func (t *idleTimeoutReader) stop() {
+	t.timer.Stop()
+}
+
+// contentRangeStart returns the first byte position of a Content-Range header: bytes <start>-<end>/<size>
+func contentRangeStart(contentRange string) (int64, error) {
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	i := strings.Index(spec, "-")
+	if spec == contentRange || i < 0 {
+		return 0, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	start, err := strconv.ParseInt(spec[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	return start, nil
+}
+
+// partialDownloadPath returns the on-disk location of the artifact download. It is stable
+// across attempts, so that an interrupted download can be resumed with a Range request.
+func (b *BPF) partialDownloadPath(conf *config.Config) string {
+	return filepath.Join(conf.BPFDir, b.Program.Name, "."+b.Program.Version+"-"+b.Program.Artifact+partialDownloadSuffix)
+}
+
+// maxArtifactSize returns the max artifact size in bytes, zero means unlimited
+func maxArtifactSize(conf *config.Config) int64 {
+	if conf.MaxArtifactSizeMB <= 0 {
+		return 0
+	}
+	return int64(conf.MaxArtifactSizeMB) << 20
+}
+
+// downloadBackoff returns the wait duration before the given retry attempt
+func downloadBackoff(conf *config.Config, attempt int) time.Duration {
+	backoff := conf.DownloadRetryBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if conf.DownloadMaxBackoff > 0 && backoff >= conf.DownloadMaxBackoff {
+			return conf.DownloadMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// httpDownload streams the artifact at URL to a temp file on disk. Transient failures are retried
+// with exponential backoff, and each retry resumes from the bytes already on disk when the
+// repository supports Range requests. An attempt fails once no data was received for the http
+// client timeout. The header is added to every request. The caller owns the returned file and
+// must remove it.
+func (b *BPF) httpDownload(URL *url.URL, header http.Header, conf *config.Config) (*os.File, error) {
+	transport, err := newRepoTransport(conf)
+	if err != nil {
+		return nil, err
+	}
+	client := http.Client{Transport: transport}
+
+	fPath := b.partialDownloadPath(conf)
+	if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %v", err)
+	}
+
+	f, err := os.OpenFile(fPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %v", err)
+	}
+
+	var retryErr *retryableError
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			backoff := downloadBackoff(conf, attempt)
+			log.Warn().Err(err).Msgf("download of %s failed, retry %d of %d in %s", URL, attempt, conf.DownloadRetries, backoff)
+			time.Sleep(backoff)
+		}
+
+		err = b.httpDownloadAttempt(&client, URL, header, f, conf)
+		if err == nil {
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				break
+			}
+			return f, nil
+		}
+
+		if !errors.As(err, &retryErr) || attempt >= conf.DownloadRetries {
+			break
+		}
+	}
+
+	f.Close()
+	// Keep the partial download after transient failures, the next deploy resumes from it
+	if !errors.As(err, &retryErr) {
+		if removeErr := os.Remove(fPath); removeErr != nil {
+			log.Warn().Err(removeErr).Msgf("failed to remove partial download %s", fPath)
+		}
+	}
+	return nil, fmt.Errorf("download failed: %w", err)
+}
+
+// httpDownloadAttempt fetches the artifact once, appending to the bytes already in f
+func (b *BPF) httpDownloadAttempt(client *http.Client, URL *url.URL, header http.Header, f *os.File, conf *config.Config) error {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek download file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		log.Info().Msgf("resuming download of %s at offset %d", URL, offset)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Range is not honoured by the repository, start over
+		if offset > 0 {
+			if err := f.Truncate(0); err != nil {
+				return fmt.Errorf("failed to truncate download file: %v", err)
+			}
+			if offset, err = f.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek download file: %v", err)
+			}
+		}
+	case http.StatusPartialContent:
+		// The range must start where the partial download stops, start over otherwise
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err == nil && start != offset {
+			err = fmt.Errorf("range starts at %d", start)
+		}
+		if err != nil {
+			if truncErr := f.Truncate(0); truncErr != nil {
+				return fmt.Errorf("failed to truncate download file: %v", truncErr)
+			}
+			return &retryableError{fmt.Errorf("partial content does not resume at offset %d: %v", offset, err)}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial download is stale or already complete but unverified, start over
+		if err := f.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate download file: %v", err)
+		}
+		return &retryableError{fmt.Errorf("range request at offset %d was not satisfiable", offset)}
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, http.StatusInternalServerError:
+		return &retryableError{fmt.Errorf("get request returned unexpected status code: %d (%s)", resp.StatusCode, http.StatusText(resp.StatusCode))}
+	case http.StatusNotFound:
+		return fmt.Errorf("%w at %s", errArtifactNotFound, URL)
+	default:
+		return fmt.Errorf("get request returned unexpected status code: %d (%s), %d was expected", resp.StatusCode, http.StatusText(resp.StatusCode), http.StatusOK)
+	}
+
+	maxSize := maxArtifactSize(conf)
+	if maxSize > 0 && resp.ContentLength > 0 && offset+resp.ContentLength > maxSize {
+		return fmt.Errorf("%v: %d bytes, max %d bytes", errArtifactTooLarge, offset+resp.ContentLength, maxSize)
+	}
+
+	var body io.Reader = resp.Body
+	if conf.HttpClientTimeout > 0 {
+		idle := newIdleTimeoutReader(resp.Body, conf.HttpClientTimeout, cancel)
+		defer idle.stop()
+		body = idle
+	}
+	if maxSize > 0 {
+		body = io.LimitReader(body, maxSize-offset+1)
+	}
+
+	n, err := io.Copy(f, body)
+	if maxSize > 0 && offset+n > maxSize {
+		return fmt.Errorf("%v: max %d bytes", errArtifactTooLarge, maxSize)
+	}
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed after %d bytes: %v", offset+n, err)}
+	}
+	if resp.ContentLength > 0 && n < resp.ContentLength {
+		return &retryableError{fmt.Errorf("short read, got %d of %d bytes", n, resp.ContentLength)}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_httpDownload(t *testing.T) {
+	artifact := bytes.Repeat([]byte("this is just a test ebpf artifact "), 1024)
+	modTime := time.Now()
+
+	tests := []struct {
+		name        string
+		handler     func(requests int32, w http.ResponseWriter, r *http.Request)
+		retries     int
+		maxSizeMB   int
+		wantErr     bool
+		wantRequest int32
+	}{
+		{
+			name: "Success",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "foo.tar.gz", modTime, bytes.NewReader(artifact))
+			},
+			wantErr:     false,
+			wantRequest: 1,
+		},
+		{
+			name: "RetryServerError",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				if requests < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				http.ServeContent(w, r, "foo.tar.gz", modTime, bytes.NewReader(artifact))
+			},
+			retries:     3,
+			wantErr:     false,
+			wantRequest: 3,
+		},
+		{
+			name: "RetriesExhausted",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			retries:     2,
+			wantErr:     true,
+			wantRequest: 3,
+		},
+		{
+			name: "NoRetryNotFound",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			retries:     3,
+			wantErr:     true,
+			wantRequest: 1,
+		},
+		{
+			name: "ResumeInterrupted",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				if requests == 1 {
+					// Announce the full artifact but hang up half way through
+					w.Header().Set("Content-Length", strconv.Itoa(len(artifact)))
+					w.WriteHeader(http.StatusOK)
+					w.Write(artifact[:len(artifact)/2])
+					return
+				}
+				if r.Header.Get("Range") != "bytes="+strconv.Itoa(len(artifact)/2)+"-" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				http.ServeContent(w, r, "foo.tar.gz", modTime, bytes.NewReader(artifact))
+			},
+			retries:     1,
+			wantErr:     false,
+			wantRequest: 2,
+		},
+		{
+			name: "RestartMismatchedRange",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				if requests == 1 {
+					w.Header().Set("Content-Length", strconv.Itoa(len(artifact)))
+					w.WriteHeader(http.StatusOK)
+					w.Write(artifact[:len(artifact)/2])
+					return
+				}
+				if requests == 2 {
+					// Resume from the start of the artifact instead of the requested offset
+					w.Header().Set("Content-Range", "bytes 0-"+strconv.Itoa(len(artifact)-1)+"/"+strconv.Itoa(len(artifact)))
+					w.WriteHeader(http.StatusPartialContent)
+					w.Write(artifact)
+					return
+				}
+				http.ServeContent(w, r, "foo.tar.gz", modTime, bytes.NewReader(artifact))
+			},
+			retries:     2,
+			wantErr:     false,
+			wantRequest: 3,
+		},
+		{
+			name: "RetryStalledBody",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				if requests == 1 {
+					w.Header().Set("Content-Length", strconv.Itoa(len(artifact)))
+					w.WriteHeader(http.StatusOK)
+					w.Write(artifact[:len(artifact)/2])
+					w.(http.Flusher).Flush()
+					<-r.Context().Done()
+					return
+				}
+				http.ServeContent(w, r, "foo.tar.gz", modTime, bytes.NewReader(artifact))
+			},
+			retries:     1,
+			wantErr:     false,
+			wantRequest: 2,
+		},
+		{
+			name: "TooLarge",
+			handler: func(requests int32, w http.ResponseWriter, r *http.Request) {
+				w.Write(bytes.Repeat([]byte("a"), 1<<20+1))
+			},
+			retries:     3,
+			maxSizeMB:   1,
+			wantErr:     true,
+			wantRequest: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(atomic.AddInt32(&requests, 1), w, r)
+			}))
+			defer srv.Close()
+
+			URL, err := url.Parse(srv.URL + "/foo.tar.gz")
+			if err != nil {
+				t.Fatalf("failed to parse url %v", err)
+			}
+			conf := &config.Config{
+				BPFDir:               t.TempDir(),
+				HttpClientTimeout:    100 * time.Millisecond,
+				DownloadRetries:      tt.retries,
+				DownloadRetryBackoff: time.Millisecond,
+				DownloadMaxBackoff:   2 * time.Millisecond,
+				MaxArtifactSizeMB:    tt.maxSizeMB,
+			}
+			b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"}}
+
+			f, err := b.httpDownload(URL, nil, conf)
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequest {
+				t.Errorf("httpDownload() requests = %d, want %d", got, tt.wantRequest)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("httpDownload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer f.Close()
+			got, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatalf("failed to read download %v", err)
+			}
+			if !bytes.Equal(got, artifact) {
+				t.Errorf("httpDownload() got %d bytes, want %d bytes", len(got), len(artifact))
+			}
+			if _, err := os.Stat(b.partialDownloadPath(conf)); err != nil {
+				t.Errorf("httpDownload() download file missing %v", err)
+			}
+		})
+	}
+}
+
+func Test_downloadBackoff(t *testing.T) {
+	conf := &config.Config{DownloadRetryBackoff: time.Second, DownloadMaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := downloadBackoff(conf, i+1); got != w {
+			t.Errorf("downloadBackoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func Test_contentRangeStart(t *testing.T) {
+	tests := []struct {
+		contentRange string
+		want         int64
+		wantErr      bool
+	}{
+		{contentRange: "bytes 1024-2047/2048", want: 1024},
+		{contentRange: "bytes 0-0/*", want: 0},
+		{contentRange: "", wantErr: true},
+		{contentRange: "bytes */2048", wantErr: true},
+		{contentRange: "items 1024-2047/2048", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentRange, func(t *testing.T) {
+			got, err := contentRangeStart(tt.contentRange)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("contentRangeStart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("contentRangeStart() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+	"github.com/ulikunitz/xz"
+)
+
+// artifactCompleteMarker is written to the package version directory once the artifact is fully extracted
+const artifactCompleteMarker = ".l3af-complete"
+
+// Artifact formats, by file name suffix
+const (
+	tarGzArtifact  = ".tar.gz"
+	tarZstArtifact = ".tar.zst"
+	tarXzArtifact  = ".tar.xz"
+	zipArtifact    = ".zip"
+	objectArtifact = ".o"
+)
+
+var artifactFormats = []string{tarGzArtifact, tarZstArtifact, tarXzArtifact, zipArtifact, objectArtifact}
+
+// artifactFormat returns the format suffix of the artifact file name
+func artifactFormat(artifact string) (string, error) {
+	for _, suffix := range artifactFormats {
+		if len(artifact) > len(suffix) && strings.HasSuffix(artifact, suffix) {
+			return suffix, nil
+		}
+	}
+	return "", fmt.Errorf("unknown artifact format %s, supported formats are %v", artifact, artifactFormats)
+}
+
+// artifactBaseName returns the artifact file name without its format suffix. The artifact is
+// expected to extract into a directory of that name.
+func artifactBaseName(artifact string) string {
+	format, err := artifactFormat(artifact)
+	if err != nil {
+		return artifact
+	}
+	return strings.TrimSuffix(artifact, format)
+}
+
+// isObjectArtifact reports whether the artifact is a bare object file, i.e. a kernel program
+// shipped without user program
+func isObjectArtifact(artifact string) bool {
+	format, err := artifactFormat(artifact)
+	return err == nil && format == objectArtifact
+}
+
+// validateObjectArtifact checks that the object file of a program shipped as bare object file is the artifact itself
+func (b *BPF) validateObjectArtifact() error {
+	if !isObjectArtifact(b.Program.Artifact) || len(b.Program.ObjectFile) == 0 || b.Program.ObjectFile == b.Program.Artifact {
+		return nil
+	}
+	return fmt.Errorf("object_file %s of program %s differs from its bare object artifact %s", b.Program.ObjectFile, b.Program.Name, b.Program.Artifact)
+}
+
+// extractLimits guards the extraction against decompression bombs
+type extractLimits struct {
+	maxSize  int64
+	maxFiles int
+	size     int64
+	files    int
+}
+
+func newExtractLimits(conf *config.Config) *extractLimits {
+	return &extractLimits{
+		maxSize:  int64(conf.MaxExtractedSizeMB) << 20,
+		maxFiles: conf.MaxExtractedFiles,
+	}
+}
+
+// addEntry accounts for another archive entry
+func (l *extractLimits) addEntry() error {
+	l.files++
+	if l.maxFiles > 0 && l.files > l.maxFiles {
+		return fmt.Errorf("artifact has more than %d files", l.maxFiles)
+	}
+	return nil
+}
+
+// copy copies the contents of an archive entry while enforcing the total size limit
+func (l *extractLimits) copy(dst io.Writer, src io.Reader) error {
+	if l.maxSize > 0 {
+		src = io.LimitReader(src, l.maxSize-l.size+1)
+	}
+	n, err := io.Copy(dst, src)
+	l.size += n
+	if l.maxSize > 0 && l.size > l.maxSize {
+		return fmt.Errorf("artifact extracts to more than %d bytes", l.maxSize)
+	}
+	return err
+}
+
+// extractArtifact extracts the downloaded artifact into a staging directory, and renames it to
+// the program version directory once the extraction has succeeded. The digest of the verified
+// artifact and the completion marker are recorded with the extracted files.
+func (b *BPF) extractArtifact(f *os.File, digest string, conf *config.Config) error {
+	nameDir := filepath.Join(conf.BPFDir, b.Program.Name)
+	if err := os.MkdirAll(nameDir, 0755); err != nil {
+		return fmt.Errorf("failed to create artifact directory: %v", err)
+	}
+	removeStaleStagingDirs(nameDir, b.Program.Version)
+
+	stagingDir, err := os.MkdirTemp(nameDir, "."+b.Program.Version+"-staging-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+	if err := os.Chmod(stagingDir, 0755); err != nil {
+		return fmt.Errorf("failed to set staging directory permissions: %v", err)
+	}
+
+	format, err := artifactFormat(b.Program.Artifact)
+	if err != nil {
+		return err
+	}
+	limits := newExtractLimits(conf)
+	switch format {
+	case zipArtifact:
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat artifact: %v", err)
+		}
+		zipReader, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("failed to create zip reader: %v", err)
+		}
+		if err := extractZip(zipReader, stagingDir, limits); err != nil {
+			return err
+		}
+	case tarGzArtifact:
+		archive, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to create Gzip reader: %v", err)
+		}
+		defer archive.Close()
+		if err := extractTar(tar.NewReader(archive), stagingDir, limits); err != nil {
+			return err
+		}
+	case tarZstArtifact:
+		archive, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to create zstd reader: %v", err)
+		}
+		defer archive.Close()
+		if err := extractTar(tar.NewReader(archive), stagingDir, limits); err != nil {
+			return err
+		}
+	case tarXzArtifact:
+		archive, err := xz.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to create xz reader: %v", err)
+		}
+		if err := extractTar(tar.NewReader(archive), stagingDir, limits); err != nil {
+			return err
+		}
+	case objectArtifact:
+		// The object file is placed where an archive would have extracted it
+		if err := limits.addEntry(); err != nil {
+			return err
+		}
+		fPath, err := ValidatePath(filepath.Join(artifactBaseName(b.Program.Artifact), b.Program.Artifact), stagingDir)
+		if err != nil {
+			return err
+		}
+		if err := writeExtractedFile(fPath, 0644, f, limits); err != nil {
+			return fmt.Errorf("failed to copy object file: %v", err)
+		}
+	}
+
+	if err := saveArtifactDigest(stagingDir, digest); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(stagingDir, artifactCompleteMarker), []byte(b.Program.Artifact), 0644); err != nil {
+		return fmt.Errorf("failed to write completion marker: %v", err)
+	}
+
+	versionDir := filepath.Join(nameDir, b.Program.Version)
+	if _, err := os.Stat(versionDir); err == nil {
+		staleDir := filepath.Join(nameDir, "."+b.Program.Version+"-staging-stale"+strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err := os.Rename(versionDir, staleDir); err != nil {
+			return fmt.Errorf("failed to replace version directory %s: %v", versionDir, err)
+		}
+		defer os.RemoveAll(staleDir)
+	}
+	if err := os.Rename(stagingDir, versionDir); err != nil {
+		return fmt.Errorf("failed to move extracted artifact into place: %v", err)
+	}
+
+	log.Info().Msgf("extracted artifact %s of program %s into %s (%d files, %d bytes)", b.Program.Artifact, b.Program.Name, versionDir, limits.files, limits.size)
+	b.FilePath = filepath.Join(versionDir, artifactBaseName(b.Program.Artifact))
+	return nil
+}
+
+// removeStaleStagingDirs removes staging directories left behind by interrupted extractions
+func removeStaleStagingDirs(nameDir, version string) {
+	staleDirs, err := filepath.Glob(filepath.Join(nameDir, "."+version+"-staging-*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range staleDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warn().Err(err).Msgf("failed to remove stale staging directory %s", dir)
+		}
+	}
+}
+
+// extractedArtifactComplete reports whether the extraction of the program version has completed
+func (b *BPF) extractedArtifactComplete(conf *config.Config) bool {
+	_, err := os.Stat(filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version, artifactCompleteMarker))
+	return err == nil
+}
+
+// extractTar extracts the directories and regular files of the tar archive into dir
+func extractTar(tarReader *tar.Reader, dir string, limits *extractLimits) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("untar failed: %v", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeDir, tar.TypeReg, tar.TypeRegA:
+		case tar.TypeSymlink, tar.TypeLink:
+			return fmt.Errorf("untar failed: %s is a link, links are not allowed", header.Name)
+		default:
+			return fmt.Errorf("untar failed: %s has unsupported type %c", header.Name, header.Typeflag)
+		}
+
+		if err := limits.addEntry(); err != nil {
+			return err
+		}
+
+		fPath, err := ValidatePath(header.Name, dir)
+		if err != nil {
+			return err
+		}
+
+		info := header.FileInfo()
+		if info.IsDir() {
+			if err = os.MkdirAll(fPath, info.Mode().Perm()|0700); err != nil {
+				return fmt.Errorf("untar failed to create directories: %v", err)
+			}
+			continue
+		}
+
+		if err := writeExtractedFile(fPath, info.Mode().Perm(), tarReader, limits); err != nil {
+			return fmt.Errorf("untar failed: %v", err)
+		}
+	}
+}
+
+// extractZip extracts the directories and regular files of the zip archive into dir
+func extractZip(zipReader *zip.Reader, dir string, limits *extractLimits) error {
+	for _, file := range zipReader.File {
+		mode := file.Mode()
+		if mode&os.ModeSymlink != 0 {
+			return fmt.Errorf("unzip failed: %s is a link, links are not allowed", file.Name)
+		}
+		if !mode.IsDir() && !mode.IsRegular() {
+			return fmt.Errorf("unzip failed: %s has unsupported type %s", file.Name, mode.Type())
+		}
+
+		if err := limits.addEntry(); err != nil {
+			return err
+		}
+
+		extractedFilePath, err := ValidatePath(file.Name, dir)
+		if err != nil {
+			return err
+		}
+
+		if mode.IsDir() {
+			if err := os.MkdirAll(extractedFilePath, mode.Perm()|0700); err != nil {
+				return fmt.Errorf("unzip failed to create directories: %v", err)
+			}
+			continue
+		}
+
+		zippedFile, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("unzip failed: %v", err)
+		}
+		err = writeExtractedFile(extractedFilePath, mode.Perm(), zippedFile, limits)
+		zippedFile.Close()
+		if err != nil {
+			return fmt.Errorf("unzip failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeExtractedFile creates the file at fPath with the contents of r
+func writeExtractedFile(fPath string, perm os.FileMode, r io.Reader, limits *extractLimits) error {
+	if err := os.MkdirAll(filepath.Dir(fPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %v", err)
+	}
+	// O_EXCL refuses to write through anything already at fPath, e.g. duplicate archive entries
+	file, err := os.OpenFile(fPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	if err := limits.copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to copy %s: %v", fPath, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,311 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type testArchiveEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+// writeTestTarGz writes the entries as tar.gz artifact into dir
+func writeTestTarGz(t *testing.T, dir string, entries []testArchiveEntry) *os.File {
+	buf := new(bytes.Buffer)
+	gzWriter := gzip.NewWriter(buf)
+	writeTestTar(t, gzWriter, entries)
+	gzWriter.Close()
+	return writeTestArtifact(t, dir, "foo.tar.gz", buf.Bytes())
+}
+
+// writeTestTar writes the entries as tar archive to w
+func writeTestTar(t *testing.T, w io.Writer, entries []testArchiveEntry) {
+	tarWriter := tar.NewWriter(w)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0755, Size: int64(len(e.body)), Linkname: e.linkname}
+		if e.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("failed to write tar header %v", err)
+		}
+		if header.Size > 0 {
+			if _, err := tarWriter.Write([]byte(e.body)); err != nil {
+				t.Fatalf("failed to write tar entry %v", err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar writer %v", err)
+	}
+}
+
+func writeTestArtifact(t *testing.T, dir, name string, data []byte) *os.File {
+	fPath := filepath.Join(dir, name)
+	if err := os.WriteFile(fPath, data, 0644); err != nil {
+		t.Fatalf("failed to write artifact %v", err)
+	}
+	f, err := os.Open(fPath)
+	if err != nil {
+		t.Fatalf("failed to open artifact %v", err)
+	}
+	return f
+}
+
+func TestBPF_extractArtifact(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []testArchiveEntry
+		maxFiles int
+		maxSize  int
+		wantErr  bool
+	}{
+		{
+			name: "Success",
+			entries: []testArchiveEntry{
+				{name: "foo/", typeflag: tar.TypeDir},
+				{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+				{name: "foo/bpf/foo_kern.o", typeflag: tar.TypeReg, body: "kernel program"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Symlink",
+			entries: []testArchiveEntry{
+				{name: "foo/foo", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Hardlink",
+			entries: []testArchiveEntry{
+				{name: "foo/foo", typeflag: tar.TypeLink, linkname: "/etc/passwd"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "PathTraversal",
+			entries: []testArchiveEntry{
+				{name: "../../foo", typeflag: tar.TypeReg, body: "userspace program"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DuplicateEntry",
+			entries: []testArchiveEntry{
+				{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+				{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "TooManyFiles",
+			entries: []testArchiveEntry{
+				{name: "foo/", typeflag: tar.TypeDir},
+				{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+			},
+			maxFiles: 1,
+			wantErr:  true,
+		},
+		{
+			name: "TooLarge",
+			entries: []testArchiveEntry{
+				{name: "foo/foo", typeflag: tar.TypeReg, body: string(make([]byte, 1<<20+1))},
+			},
+			maxSize: 1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{BPFDir: t.TempDir(), MaxExtractedFiles: tt.maxFiles, MaxExtractedSizeMB: tt.maxSize}
+			b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"}}
+			f := writeTestTarGz(t, t.TempDir(), tt.entries)
+			defer f.Close()
+
+			err := b.extractArtifact(f, "", conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractArtifact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			staging, _ := filepath.Glob(filepath.Join(conf.BPFDir, "foo", ".1.0-staging-*"))
+			if len(staging) != 0 {
+				t.Errorf("extractArtifact() left staging directories %v", staging)
+			}
+			if b.extractedArtifactComplete(conf) == tt.wantErr {
+				t.Errorf("extractedArtifactComplete() = %v, want %v", !tt.wantErr, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(filepath.Join(conf.BPFDir, "foo", "1.0")); !os.IsNotExist(err) {
+					t.Errorf("extractArtifact() left version directory after failure")
+				}
+				return
+			}
+			if b.FilePath != filepath.Join(conf.BPFDir, "foo", "1.0", "foo") {
+				t.Errorf("extractArtifact() FilePath = %v", b.FilePath)
+			}
+			if _, err := os.Stat(filepath.Join(b.FilePath, "bpf", "foo_kern.o")); err != nil {
+				t.Errorf("extractArtifact() missing extracted file %v", err)
+			}
+		})
+	}
+}
+
+func TestBPF_extractArtifactReplace(t *testing.T) {
+	conf := &config.Config{BPFDir: t.TempDir()}
+	b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.zip"}}
+
+	// a half populated version directory from an interrupted extraction
+	if err := os.MkdirAll(filepath.Join(conf.BPFDir, "foo", "1.0", "foo"), 0755); err != nil {
+		t.Fatalf("failed to create version directory %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(conf.BPFDir, "foo", "1.0", "foo", "stale"), nil, 0644); err != nil {
+		t.Fatalf("failed to create stale file %v", err)
+	}
+	if b.extractedArtifactComplete(conf) {
+		t.Fatalf("extractedArtifactComplete() = true for interrupted extraction")
+	}
+
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+	w, _ := zipWriter.Create("foo/foo")
+	w.Write([]byte("userspace program"))
+	zipWriter.Close()
+	f := writeTestArtifact(t, t.TempDir(), "foo.zip", buf.Bytes())
+	defer f.Close()
+
+	if err := b.extractArtifact(f, "", conf); err != nil {
+		t.Fatalf("extractArtifact() error = %v", err)
+	}
+	if !b.extractedArtifactComplete(conf) {
+		t.Errorf("extractedArtifactComplete() = false after extraction")
+	}
+	if _, err := os.Stat(filepath.Join(b.FilePath, "stale")); !os.IsNotExist(err) {
+		t.Errorf("extractArtifact() kept files of the interrupted extraction")
+	}
+	if _, err := os.Stat(filepath.Join(b.FilePath, "foo")); err != nil {
+		t.Errorf("extractArtifact() missing extracted file %v", err)
+	}
+}
+
+func TestBPF_extractArtifactFormats(t *testing.T) {
+	entries := []testArchiveEntry{
+		{name: "foo.v2/", typeflag: tar.TypeDir},
+		{name: "foo.v2/foo", typeflag: tar.TypeReg, body: "userspace program"},
+	}
+	tarZst := new(bytes.Buffer)
+	zstWriter, err := zstd.NewWriter(tarZst)
+	if err != nil {
+		t.Fatalf("failed to create zstd writer %v", err)
+	}
+	writeTestTar(t, zstWriter, entries)
+	zstWriter.Close()
+
+	tarXz := new(bytes.Buffer)
+	xzWriter, err := xz.NewWriter(tarXz)
+	if err != nil {
+		t.Fatalf("failed to create xz writer %v", err)
+	}
+	writeTestTar(t, xzWriter, entries)
+	xzWriter.Close()
+
+	tests := []struct {
+		name     string
+		artifact string
+		data     []byte
+		wantFile string
+		wantErr  bool
+	}{
+		{
+			name:     "TarZst",
+			artifact: "foo.v2.tar.zst",
+			data:     tarZst.Bytes(),
+			wantFile: "foo",
+		},
+		{
+			name:     "TarXz",
+			artifact: "foo.v2.tar.xz",
+			data:     tarXz.Bytes(),
+			wantFile: "foo",
+		},
+		{
+			name:     "Object",
+			artifact: "foo.v2.o",
+			data:     []byte("\x7fELF kernel program"),
+			wantFile: "foo.v2.o",
+		},
+		{
+			name:     "CorruptTarZst",
+			artifact: "foo.v2.tar.zst",
+			data:     []byte("not zstd"),
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownFormat",
+			artifact: "foo.v2.rpm",
+			data:     []byte("rpm"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{BPFDir: t.TempDir()}
+			b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: tt.artifact}}
+			f := writeTestArtifact(t, t.TempDir(), tt.artifact, tt.data)
+			defer f.Close()
+
+			err := b.extractArtifact(f, "", conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractArtifact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if b.FilePath != filepath.Join(conf.BPFDir, "foo", "1.0", "foo.v2") {
+				t.Errorf("extractArtifact() FilePath = %v", b.FilePath)
+			}
+			if _, err := os.Stat(filepath.Join(b.FilePath, tt.wantFile)); err != nil {
+				t.Errorf("extractArtifact() missing extracted file %v", err)
+			}
+		})
+	}
+}
+
+func Test_artifactBaseName(t *testing.T) {
+	tests := []struct {
+		artifact string
+		want     string
+	}{
+		{artifact: "l3af_xdp_root.tar.gz", want: "l3af_xdp_root"},
+		{artifact: "ratelimiting-1.2.3.tar.zst", want: "ratelimiting-1.2.3"},
+		{artifact: "foo.tar.xz", want: "foo"},
+		{artifact: "foo.bar.zip", want: "foo.bar"},
+		{artifact: "foo_kern.o", want: "foo_kern"},
+		{artifact: "foo.rpm", want: "foo.rpm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.artifact, func(t *testing.T) {
+			if got := artifactBaseName(tt.artifact); got != tt.want {
+				t.Errorf("artifactBaseName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxRepoCooldownFactor caps the growth of the cooldown of a repository failing repeatedly
+const maxRepoCooldownFactor = 10
+
+// repoHealth tracks the failures of eBPF package repositories, so that downloads fail over to the
+// next mirror right away instead of waiting on a repository known to be failing.
+type repoHealth struct {
+	mu       sync.Mutex
+	failures map[string]int
+	until    map[string]time.Time
+}
+
+var mirrorHealth = newRepoHealth()
+
+func newRepoHealth() *repoHealth {
+	return &repoHealth{
+		failures: make(map[string]int),
+		until:    make(map[string]time.Time),
+	}
+}
+
+// recordFailure puts the repository into cooldown, the cooldown grows with consecutive failures
+func (h *repoHealth) recordFailure(repoURL string, cooldown time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures[repoURL]++
+	factor := h.failures[repoURL]
+	if factor > maxRepoCooldownFactor {
+		factor = maxRepoCooldownFactor
+	}
+	h.until[repoURL] = time.Now().Add(time.Duration(factor) * cooldown)
+}
+
+// recordSuccess marks the repository healthy
+func (h *repoHealth) recordSuccess(repoURL string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.failures, repoURL)
+	delete(h.until, repoURL)
+}
+
+// order returns the repositories in configured order, the ones in cooldown last. Repositories in
+// cooldown are still tried, since they may be the only ones holding the artifact.
+func (h *repoHealth) order(repoURLs []string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	healthy := make([]string, 0, len(repoURLs))
+	var failing []string
+	for _, repoURL := range repoURLs {
+		if now.Before(h.until[repoURL]) {
+			failing = append(failing, repoURL)
+			continue
+		}
+		healthy = append(healthy, repoURL)
+	}
+	return append(healthy, failing...)
+}
+
+// repoURLs returns the repositories of the program in configured order. The repositories of the
+// program replace the repositories of the host config.
+func (b *BPF) repoURLs(conf *config.Config) (repoURLs []string, isDefault bool) {
+	candidates := append([]string{b.Program.EPRURL}, b.Program.EPRURLs...)
+	isDefault = len(b.Program.EPRURL) == 0 && len(b.Program.EPRURLs) == 0
+	if isDefault {
+		candidates = append([]string{conf.EBPFRepoURL}, conf.EBPFRepoMirrorURLs...)
+	}
+	for _, repoURL := range candidates {
+		if len(repoURL) > 0 && !containsString(repoURLs, repoURL) {
+			repoURLs = append(repoURLs, repoURL)
+		}
+	}
+	return repoURLs, isDefault
+}
+
+// newRepoTransport returns the http transport of the eBPF package repository client, configured
+// with the CA bundle, client certificate and proxy of the host config.
+func newRepoTransport(conf *config.Config) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: conf.HttpClientTimeout,
+	}
+
+	if len(conf.EBPFRepoProxy) > 0 {
+		proxyURL, err := url.Parse(conf.EBPFRepoProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ebpf-repo proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if len(conf.EBPFRepoCABundle) == 0 && len(conf.EBPFRepoClientCert) == 0 {
+		return transport, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(conf.EBPFRepoCABundle) > 0 {
+		pem, err := os.ReadFile(conf.EBPFRepoCABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ebpf-repo ca-bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to load system cert pool, trusting the ebpf-repo ca-bundle only")
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ebpf-repo ca-bundle %s has no PEM encoded certificates", conf.EBPFRepoCABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(conf.EBPFRepoClientCert) > 0 {
+		cert, err := tls.LoadX509KeyPair(conf.EBPFRepoClientCert, conf.EBPFRepoClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ebpf-repo client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
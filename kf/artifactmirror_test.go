@@ -0,0 +1,183 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_repoHealth_order(t *testing.T) {
+	h := newRepoHealth()
+	repos := []string{"https://local", "https://central", "https://backup"}
+	if got := h.order(repos); !reflect.DeepEqual(got, repos) {
+		t.Errorf("order() = %v, want %v", got, repos)
+	}
+
+	h.recordFailure("https://local", time.Hour)
+	want := []string{"https://central", "https://backup", "https://local"}
+	if got := h.order(repos); !reflect.DeepEqual(got, want) {
+		t.Errorf("order() = %v, want %v", got, want)
+	}
+
+	h.recordSuccess("https://local")
+	if got := h.order(repos); !reflect.DeepEqual(got, repos) {
+		t.Errorf("order() after success = %v, want %v", got, repos)
+	}
+}
+
+func TestBPF_repoURLs(t *testing.T) {
+	conf := &config.Config{EBPFRepoURL: "https://local", EBPFRepoMirrorURLs: []string{"https://central", "https://local"}}
+	tests := []struct {
+		name        string
+		program     models.BPFProgram
+		want        []string
+		wantDefault bool
+	}{
+		{
+			name:        "Default",
+			want:        []string{"https://local", "https://central"},
+			wantDefault: true,
+		},
+		{
+			name:    "ProgramURL",
+			program: models.BPFProgram{EPRURL: "https://program"},
+			want:    []string{"https://program"},
+		},
+		{
+			name:    "ProgramMirrors",
+			program: models.BPFProgram{EPRURL: "https://program", EPRURLs: []string{"https://program-mirror"}},
+			want:    []string{"https://program", "https://program-mirror"},
+		},
+		{
+			name:    "ProgramMirrorsOnly",
+			program: models.BPFProgram{EPRURLs: []string{"https://program-mirror"}},
+			want:    []string{"https://program-mirror"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: tt.program}
+			got, isDefault := b.repoURLs(conf)
+			if !reflect.DeepEqual(got, tt.want) || isDefault != tt.wantDefault {
+				t.Errorf("repoURLs() = %v, %v, want %v, %v", got, isDefault, tt.want, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestBPF_GetArtifactsFailover(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	artifact := writeTestTarGz(t, t.TempDir(), []testArchiveEntry{
+		{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+	})
+	artifact.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repo/foo/1.0/generic/foo.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, artifact.Name())
+	}))
+	defer mirror.Close()
+
+	conf := &config.Config{
+		BPFDir:                  t.TempDir(),
+		EBPFRepoURL:             failing.URL + "/repo",
+		EBPFRepoMirrorURLs:      []string{mirror.URL + "/repo"},
+		EBPFRepoFailureCooldown: time.Minute,
+		Platforms:               []string{genericPlatform},
+		HttpClientTimeout:       time.Second,
+	}
+	b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"}}
+	if err := b.GetArtifacts(conf); err != nil {
+		t.Fatalf("GetArtifacts() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.FilePath, "foo")); err != nil {
+		t.Errorf("GetArtifacts() missing extracted file %v", err)
+	}
+
+	want := []string{conf.EBPFRepoMirrorURLs[0], conf.EBPFRepoURL}
+	if got := mirrorHealth.order([]string{conf.EBPFRepoURL, conf.EBPFRepoMirrorURLs[0]}); !reflect.DeepEqual(got, want) {
+		t.Errorf("failing repository is not in cooldown, order() = %v, want %v", got, want)
+	}
+
+	// a tampered artifact does not put the repository serving it into cooldown
+	b.Program.ArtifactSHA256 = strings.Repeat("0", 64)
+	if err := b.GetArtifacts(conf); err == nil {
+		t.Errorf("GetArtifacts() succeeded for an artifact failing verification")
+	}
+	if got := mirrorHealth.order([]string{conf.EBPFRepoURL, conf.EBPFRepoMirrorURLs[0]}); !reflect.DeepEqual(got, want) {
+		t.Errorf("repository serving an artifact failing verification is in cooldown, order() = %v, want %v", got, want)
+	}
+
+	b.Program.ArtifactSHA256 = ""
+	b.Program.Version = "2.0"
+	if err := b.GetArtifacts(conf); err == nil {
+		t.Errorf("GetArtifacts() succeeded for an artifact missing on all repositories")
+	}
+}
+
+func Test_newRepoTransport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caBundle := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatalf("failed to write ca bundle %v", err)
+	}
+	invalidBundle := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalidBundle, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("failed to write ca bundle %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		conf    *config.Config
+		wantErr bool
+	}{
+		{name: "CABundle", conf: &config.Config{EBPFRepoCABundle: caBundle, EBPFRepoProxy: "http://proxy.example.com:3128"}},
+		{name: "MissingCABundle", conf: &config.Config{EBPFRepoCABundle: filepath.Join(dir, "missing.pem")}, wantErr: true},
+		{name: "InvalidCABundle", conf: &config.Config{EBPFRepoCABundle: invalidBundle}, wantErr: true},
+		{name: "InvalidClientCert", conf: &config.Config{EBPFRepoClientCert: invalidBundle, EBPFRepoClientKey: invalidBundle}, wantErr: true},
+		{name: "InvalidProxy", conf: &config.Config{EBPFRepoProxy: "http://proxy example"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := newRepoTransport(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newRepoTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			proxyURL, err := transport.Proxy(httptest.NewRequest(http.MethodGet, srv.URL, nil))
+			if err != nil || proxyURL == nil || proxyURL.Host != "proxy.example.com:3128" {
+				t.Errorf("newRepoTransport() proxy = %v, %v", proxyURL, err)
+			}
+			transport.Proxy = nil
+			resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+			if err != nil {
+				t.Fatalf("request with ca bundle failed %v", err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Prefetch states
+const (
+	PrefetchPending     = "pending"
+	PrefetchDownloading = "downloading"
+	PrefetchReady       = "ready"
+	PrefetchFailed      = "failed"
+)
+
+// prefetchStatusRetention is how long the status of a finished prefetch is kept
+const prefetchStatusRetention = time.Hour
+
+// artifactLock serialises the download and extraction of a package version
+type artifactLock struct {
+	sync.Mutex
+	refs int
+}
+
+var (
+	artifactLocksMu sync.Mutex
+	artifactLocks   = map[string]*artifactLock{}
+)
+
+// lockArtifact locks the package version, so that deployments and prefetches never download or
+// extract the same version concurrently. It returns the function releasing the lock.
+func lockArtifact(name, version string) func() {
+	key := artifactKey(name, version)
+	artifactLocksMu.Lock()
+	l, ok := artifactLocks[key]
+	if !ok {
+		l = &artifactLock{}
+		artifactLocks[key] = l
+	}
+	l.refs++
+	artifactLocksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		artifactLocksMu.Lock()
+		defer artifactLocksMu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(artifactLocks, key)
+		}
+	}
+}
+
+// ArtifactPrefetcher downloads, verifies and extracts eBPF packages in the background, ahead of
+// their deployment.
+type ArtifactPrefetcher struct {
+	conf      *config.Config
+	sem       chan struct{}
+	retention time.Duration
+	mu        sync.Mutex
+	status    map[string]*models.ArtifactPrefetchStatus
+}
+
+// NewArtifactPrefetcher returns the artifact prefetcher for the host config
+func NewArtifactPrefetcher(conf *config.Config) *ArtifactPrefetcher {
+	concurrency := conf.ArtifactPrefetchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &ArtifactPrefetcher{
+		conf:      conf,
+		sem:       make(chan struct{}, concurrency),
+		retention: prefetchStatusRetention,
+		status:    make(map[string]*models.ArtifactPrefetchStatus),
+	}
+}
+
+// prefetchKey returns the status key of a package reference. Prefetches of the same version from
+// another repository or with another digest or signature are tracked separately.
+func prefetchKey(ref models.ArtifactRef) string {
+	fields := append([]string{ref.Name, ref.Version, ref.Artifact, ref.EPRURL, ref.ArtifactSHA256, ref.ArtifactSignature}, ref.EPRURLs...)
+	return strings.Join(fields, "\x00")
+}
+
+// finished returns whether the prefetch is done, successfully or not
+func finished(s *models.ArtifactPrefetchStatus) bool {
+	return s.State == PrefetchReady || s.State == PrefetchFailed
+}
+
+// prune removes the status of the prefetches finished for longer than the retention, p.mu must be held
+func (p *ArtifactPrefetcher) prune(now time.Time) {
+	for key, s := range p.status {
+		if finished(s) && now.Sub(s.UpdatedAt) > p.retention {
+			delete(p.status, key)
+		}
+	}
+}
+
+// validateArtifactRef checks that the package reference is complete and safe to use as path
+func validateArtifactRef(ref models.ArtifactRef) error {
+	for field, value := range map[string]string{"name": ref.Name, "version": ref.Version, "artifact": ref.Artifact} {
+		if len(value) == 0 {
+			return fmt.Errorf("%s is required", field)
+		}
+		if value == "." || value == ".." || filepath.Base(value) != value {
+			return fmt.Errorf("invalid %s %q", field, value)
+		}
+	}
+	_, err := artifactFormat(ref.Artifact)
+	return err
+}
+
+// Prefetch queues the packages for download, packages already being prefetched are not queued
+// again. It returns the status of the packages.
+func (p *ArtifactPrefetcher) Prefetch(refs []models.ArtifactRef) ([]models.ArtifactPrefetchStatus, error) {
+	for _, ref := range refs {
+		if err := validateArtifactRef(ref); err != nil {
+			return nil, fmt.Errorf("invalid artifact %s version %s: %v", ref.Name, ref.Version, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.prune(now)
+	statuses := make([]models.ArtifactPrefetchStatus, 0, len(refs))
+	for _, ref := range refs {
+		key := prefetchKey(ref)
+		if s, ok := p.status[key]; ok && !finished(s) {
+			statuses = append(statuses, *s)
+			continue
+		}
+		s := &models.ArtifactPrefetchStatus{ArtifactRef: ref, State: PrefetchPending, UpdatedAt: now}
+		p.status[key] = s
+		statuses = append(statuses, *s)
+		go p.fetch(key, ref)
+	}
+	return statuses, nil
+}
+
+// fetch downloads the package into the artifact cache
+func (p *ArtifactPrefetcher) fetch(key string, ref models.ArtifactRef) {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+
+	p.setState(key, PrefetchDownloading, nil)
+	b := &BPF{
+		Program: models.BPFProgram{
+			Name:              ref.Name,
+			Version:           ref.Version,
+			Artifact:          ref.Artifact,
+			EPRURL:            ref.EPRURL,
+			EPRURLs:           ref.EPRURLs,
+			ArtifactSHA256:    ref.ArtifactSHA256,
+			ArtifactSignature: ref.ArtifactSignature,
+		},
+	}
+	if err := b.VerifyAndGetArtifacts(p.conf); err != nil {
+		log.Error().Err(err).Msgf("prefetch of artifact %s version %s failed", ref.Name, ref.Version)
+		p.setState(key, PrefetchFailed, err)
+		return
+	}
+	log.Info().Msgf("prefetched artifact %s version %s", ref.Name, ref.Version)
+	p.setState(key, PrefetchReady, nil)
+}
+
+func (p *ArtifactPrefetcher) setState(key, state string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.status[key]
+	if !ok {
+		return
+	}
+	s.State = state
+	s.Error = ""
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.UpdatedAt = time.Now()
+}
+
+// Status returns the status of the prefetches in progress or recently finished, ordered by name and version
+func (p *ArtifactPrefetcher) Status() []models.ArtifactPrefetchStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune(time.Now())
+	statuses := make([]models.ArtifactPrefetchStatus, 0, len(p.status))
+	for _, s := range p.status {
+		statuses = append(statuses, *s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return prefetchKey(statuses[i].ArtifactRef) < prefetchKey(statuses[j].ArtifactRef)
+	})
+	return statuses
+}
+
+// inFlight adds the package versions being prefetched to inUse, so that the artifact cache does not evict them
+func (p *ArtifactPrefetcher) inFlight(inUse map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.status {
+		if !finished(s) {
+			inUse[artifactKey(s.Name, s.Version)] = true
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestArtifactPrefetcher_Prefetch(t *testing.T) {
+	repoDir := t.TempDir()
+	platformDir := filepath.Join(repoDir, "foo", "1.0", genericPlatform)
+	if err := os.MkdirAll(platformDir, 0755); err != nil {
+		t.Fatalf("failed to create repository %v", err)
+	}
+	writeTestTarGz(t, platformDir, []testArchiveEntry{
+		{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+	}).Close()
+
+	conf := &config.Config{
+		BPFDir:      t.TempDir(),
+		EBPFRepoURL: "file://" + repoDir,
+		Platforms:   []string{genericPlatform},
+	}
+	p := NewArtifactPrefetcher(conf)
+
+	if _, err := p.Prefetch([]models.ArtifactRef{{Name: "../foo", Version: "1.0", Artifact: "foo.tar.gz"}}); err == nil {
+		t.Errorf("Prefetch() accepted an invalid name")
+	}
+	if _, err := p.Prefetch([]models.ArtifactRef{{Name: "foo", Version: "1.0", Artifact: "foo.rpm"}}); err == nil {
+		t.Errorf("Prefetch() accepted an unknown artifact format")
+	}
+
+	statuses, err := p.Prefetch([]models.ArtifactRef{
+		{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"},
+		{Name: "foo", Version: "2.0", Artifact: "foo.tar.gz"},
+	})
+	if err != nil {
+		t.Fatalf("Prefetch() error = %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Prefetch() returned %d statuses, want 2", len(statuses))
+	}
+
+	want := map[string]string{"1.0": PrefetchReady, "2.0": PrefetchFailed}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got := map[string]string{}
+		for _, s := range p.Status() {
+			got[s.Version] = s.State
+		}
+		if got["1.0"] == want["1.0"] && got["2.0"] == want["2.0"] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Status() = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := os.Stat(filepath.Join(conf.BPFDir, "foo", "1.0", "foo", "foo")); err != nil {
+		t.Errorf("Prefetch() missing extracted file %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(conf.BPFDir, "foo", "1.0", artifactCacheMarker)); err != nil {
+		t.Errorf("Prefetch() did not add the artifact to the cache %v", err)
+	}
+}
+
+func Test_lockArtifact(t *testing.T) {
+	unlock := lockArtifact("foo", "1.0")
+	locked := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		unlock := lockArtifact("foo", "1.0")
+		close(locked)
+		unlock()
+		close(done)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("lockArtifact() did not wait for the lock holder")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-done
+
+	artifactLocksMu.Lock()
+	defer artifactLocksMu.Unlock()
+	if len(artifactLocks) != 0 {
+		t.Errorf("lockArtifact() left %d locks behind", len(artifactLocks))
+	}
+}
+
+func TestArtifactPrefetcher_Status(t *testing.T) {
+	now := time.Now()
+	p := NewArtifactPrefetcher(&config.Config{})
+	refs := []models.ArtifactRef{
+		{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"},
+		{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz", ArtifactSHA256: "b7e2"},
+		{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz", EPRURLs: []string{"https://mirror"}},
+		{Name: "foo", Version: "2.0", Artifact: "foo.tar.gz"},
+		{Name: "foo", Version: "3.0", Artifact: "foo.tar.gz"},
+	}
+	states := []struct {
+		state     string
+		updatedAt time.Time
+	}{
+		{PrefetchReady, now.Add(-time.Minute)},
+		{PrefetchFailed, now},
+		{PrefetchDownloading, now.Add(-2 * prefetchStatusRetention)},
+		{PrefetchReady, now.Add(-2 * prefetchStatusRetention)},
+		{PrefetchFailed, now.Add(-2 * prefetchStatusRetention)},
+	}
+	for i, ref := range refs {
+		p.status[prefetchKey(ref)] = &models.ArtifactPrefetchStatus{ArtifactRef: ref, State: states[i].state, UpdatedAt: states[i].updatedAt}
+	}
+
+	statuses := p.Status()
+	if len(statuses) != 3 {
+		t.Fatalf("Status() returned %d statuses, want 3", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.Version != "1.0" {
+			t.Errorf("Status() kept the expired prefetch of version %s", s.Version)
+		}
+	}
+	if len(p.status) != 3 {
+		t.Errorf("Status() left %d statuses, want 3", len(p.status))
+	}
+
+	inUse := map[string]bool{}
+	p.inFlight(inUse)
+	if len(inUse) != 1 || !inUse[artifactKey("foo", "1.0")] {
+		t.Errorf("inFlight() = %v", inUse)
+	}
+}
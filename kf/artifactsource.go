@@ -0,0 +1,113 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/l3af-project/l3afd/config"
+)
+
+// errArtifactNotFound is returned by artifact sources when the repository has no artifact for the platform
+var errArtifactNotFound = errors.New("artifact is not found")
+
+// ArtifactSource fetches eBPF packages from an eBPF package repository.
+type ArtifactSource interface {
+	// Fetch retrieves the artifact of the BPF program for the given platform from the repository
+	// at repoURL. The caller must close the returned artifact. Sources return an error wrapping
+	// errArtifactNotFound when the repository has no artifact for the platform, so that the next
+	// platform directory is tried.
+	Fetch(repoURL *url.URL, b *BPF, platform string, conf *config.Config) (*FetchedArtifact, error)
+}
+
+// FetchedArtifact is an eBPF package retrieved by an ArtifactSource.
+type FetchedArtifact struct {
+	*os.File
+	// Temporary artifacts are removed on Close
+	Temporary bool
+}
+
+// Close closes the artifact file and removes it if it is temporary.
+func (a *FetchedArtifact) Close() error {
+	err := a.File.Close()
+	if a.Temporary {
+		if removeErr := os.Remove(a.Name()); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+var (
+	artifactSourcesMu sync.RWMutex
+	artifactSources   = map[string]ArtifactSource{
+		httpScheme:         &httpArtifactSource{},
+		httpsScheme:        &httpArtifactSource{},
+		fileScheme:         &fileArtifactSource{},
+		ociScheme:          &ociArtifactSource{},
+		ociPlainHTTPScheme: &ociArtifactSource{plainHTTP: true},
+	}
+)
+
+// RegisterArtifactSource registers the artifact source for the URL scheme, replacing any existing one.
+func RegisterArtifactSource(scheme string, source ArtifactSource) {
+	artifactSourcesMu.Lock()
+	defer artifactSourcesMu.Unlock()
+	artifactSources[scheme] = source
+}
+
+// getArtifactSource returns the artifact source for the URL scheme
+func getArtifactSource(scheme string) (ArtifactSource, error) {
+	artifactSourcesMu.RLock()
+	defer artifactSourcesMu.RUnlock()
+	source, ok := artifactSources[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown url scheme %s", scheme)
+	}
+	return source, nil
+}
+
+// artifactPath returns the artifact location within a http or file repository
+func artifactPath(repoPath string, b *BPF, platform string) string {
+	return path.Join(repoPath, b.Program.Name, b.Program.Version, platform, b.Program.Artifact)
+}
+
+// httpArtifactSource fetches artifacts from http and https repositories
+type httpArtifactSource struct{}
+
+func (s *httpArtifactSource) Fetch(repoURL *url.URL, b *BPF, platform string, conf *config.Config) (*FetchedArtifact, error) {
+	URL := *repoURL
+	URL.Path = artifactPath(URL.Path, b, platform)
+	f, err := b.httpDownload(&URL, nil, conf)
+	if err != nil {
+		return nil, err
+	}
+	return &FetchedArtifact{File: f, Temporary: true}, nil
+}
+
+// fileArtifactSource fetches artifacts from a repository on the local filesystem
+type fileArtifactSource struct{}
+
+func (s *fileArtifactSource) Fetch(repoURL *url.URL, b *BPF, platform string, conf *config.Config) (*FetchedArtifact, error) {
+	fPath := artifactPath(repoURL.Path, b, platform)
+	if !fileExists(fPath) {
+		return nil, fmt.Errorf("%w at %s", errArtifactNotFound, fPath)
+	}
+	f, err := os.Open(fPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening err : %v", err)
+	}
+	if maxSize := maxArtifactSize(conf); maxSize > 0 {
+		if info, err := f.Stat(); err == nil && info.Size() > maxSize {
+			f.Close()
+			return nil, fmt.Errorf("%v: %d bytes, max %d bytes", errArtifactTooLarge, info.Size(), maxSize)
+		}
+	}
+	return &FetchedArtifact{File: f}, nil
+}
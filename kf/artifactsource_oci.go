@@ -0,0 +1,316 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/l3af-project/l3afd/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+const ociScheme string = "oci"
+
+// ociPlainHTTPScheme selects an OCI registry served over plain http, e.g. a local registry:2
+const ociPlainHTTPScheme string = "oci+http"
+
+const (
+	ociManifestMediaType          = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType       = "application/vnd.docker.distribution.manifest.v2+json"
+	ociTitleAnnotation            = "org.opencontainers.image.title"
+	maxOCIManifestSize      int64 = 4 << 20
+)
+
+// ociDescriptor describes a blob in an OCI registry
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an OCI image manifest
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// ociArtifactSource fetches artifacts from an OCI distribution registry. The repository URL
+// oci://registry/namespace maps the program to the repository namespace/<name> and its version
+// to the tag. The artifact is the layer titled <platform>/<artifact> or <artifact>, as pushed
+// by e.g. `oras push registry/namespace/<name>:<version> <platform>/<artifact>`.
+type ociArtifactSource struct {
+	plainHTTP bool
+}
+
+func (s *ociArtifactSource) Fetch(repoURL *url.URL, b *BPF, platform string, conf *config.Config) (*FetchedArtifact, error) {
+	scheme := httpsScheme
+	if s.plainHTTP {
+		scheme = httpScheme
+	}
+	transport, err := newRepoTransport(conf)
+	if err != nil {
+		return nil, err
+	}
+	reg := &ociRegistry{
+		baseURL:    url.URL{Scheme: scheme, Host: repoURL.Host},
+		repository: strings.Trim(path.Join(repoURL.Path, b.Program.Name), "/"),
+		username:   conf.RegistryUsername,
+		password:   conf.RegistryPassword,
+		client:     &http.Client{Transport: transport},
+	}
+
+	manifest, err := reg.getManifest(b.Program.Version)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := manifest.artifactLayer(platform, b.Program.Artifact)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s %w", reg.repository, b.Program.Version, err)
+	}
+	if maxSize := maxArtifactSize(conf); maxSize > 0 && layer.Size > maxSize {
+		return nil, fmt.Errorf("%v: %d bytes, max %d bytes", errArtifactTooLarge, layer.Size, maxSize)
+	}
+
+	f, err := b.httpDownload(reg.url("blobs", layer.Digest), reg.authHeader(), conf)
+	if err != nil {
+		return nil, err
+	}
+	artifact := &FetchedArtifact{File: f, Temporary: true}
+	if err := verifyOCIDigest(f, layer.Digest); err != nil {
+		artifact.Close()
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// artifactLayer returns the manifest layer holding the artifact for the platform. Layers are
+// titled <platform>/<artifact>, the generic platform also matches a layer titled <artifact> or
+// the only layer of the manifest.
+func (m *ociManifest) artifactLayer(platform, artifact string) (*ociDescriptor, error) {
+	var fallback *ociDescriptor
+	for i := range m.Layers {
+		switch m.Layers[i].Annotations[ociTitleAnnotation] {
+		case path.Join(platform, artifact):
+			return &m.Layers[i], nil
+		case artifact:
+			fallback = &m.Layers[i]
+		}
+	}
+	if platform == genericPlatform {
+		if fallback != nil {
+			return fallback, nil
+		}
+		if len(m.Layers) == 1 {
+			return &m.Layers[0], nil
+		}
+	}
+	return nil, fmt.Errorf("has no layer titled %s: %w", path.Join(platform, artifact), errArtifactNotFound)
+}
+
+// verifyOCIDigest checks the downloaded blob against its content addressable digest
+func verifyOCIDigest(f *os.File, digest string) error {
+	algorithm, expected, found := strings.Cut(digest, ":")
+	if !found || algorithm != "sha256" {
+		return fmt.Errorf("unsupported blob digest %s", digest)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("failed to compute blob digest: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek blob: %v", err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != expected {
+		return fmt.Errorf("blob digest mismatch: expected %s got sha256:%s", digest, got)
+	}
+	return nil
+}
+
+// ociRegistry is a client for a repository of an OCI distribution registry
+type ociRegistry struct {
+	baseURL       url.URL
+	repository    string
+	username      string
+	password      string
+	authorization string
+	client        *http.Client
+}
+
+// url returns the registry API url of a manifest or blob of the repository
+func (r *ociRegistry) url(kind, reference string) *url.URL {
+	u := r.baseURL
+	u.Path = path.Join("/v2", r.repository, kind, reference)
+	return &u
+}
+
+// authHeader returns the header authorizing requests against the repository
+func (r *ociRegistry) authHeader() http.Header {
+	header := http.Header{}
+	if len(r.authorization) > 0 {
+		header.Set("Authorization", r.authorization)
+	}
+	return header
+}
+
+// getManifest fetches the image manifest of the tag
+func (r *ociRegistry) getManifest(tag string) (*ociManifest, error) {
+	URL := r.url("manifests", tag)
+	log.Info().Msgf("Retrieving OCI manifest - %s", URL)
+
+	resp, err := r.get(URL, ociManifestMediaType+", "+dockerManifestMediaType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s:%s: %v", r.repository, tag, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: manifest %s:%s", errArtifactNotFound, r.repository, tag)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get manifest %s:%s returned unexpected status code: %d (%s)", r.repository, tag, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	manifest := &ociManifest{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOCIManifestSize)).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s:%s: %v", r.repository, tag, err)
+	}
+	if manifest.SchemaVersion != 2 {
+		return nil, fmt.Errorf("manifest %s:%s has unsupported schema version %d", r.repository, tag, manifest.SchemaVersion)
+	}
+	return manifest, nil
+}
+
+// get issues a GET request against the registry, and authenticates once if the registry asks for it
+func (r *ociRegistry) get(URL *url.URL, accept string) (*http.Response, error) {
+	for authenticated := false; ; authenticated = true {
+		req, err := http.NewRequest(http.MethodGet, URL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = r.authHeader()
+		req.Header.Set("Accept", accept)
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || authenticated {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := r.authenticate(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authenticate answers the WWW-Authenticate challenge of the registry
+func (r *ociRegistry) authenticate(challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if len(r.username) == 0 {
+			return fmt.Errorf("registry requires credentials, registry-username is not set")
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(r.username, r.password)
+		r.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		return r.fetchToken(params)
+	default:
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+}
+
+// fetchToken fetches a bearer token from the token server named in the challenge
+func (r *ociRegistry) fetchToken(params map[string]string) error {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(realm.Host) == 0 {
+		return fmt.Errorf("invalid registry token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if len(scope) == 0 {
+		scope = "repository:" + r.repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if len(r.username) > 0 {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request returned unexpected status code: %d (%s)", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOCIManifestSize)).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode registry token: %v", err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	if len(token.Token) == 0 {
+		return fmt.Errorf("registry token response has no token")
+	}
+	r.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// parseAuthChallenge splits a WWW-Authenticate challenge into its scheme and parameters,
+// e.g. Bearer realm="https://auth.example.com/token",service="registry",scope="repository:foo:pull"
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[key] = strings.TrimSpace(value)
+		}
+	}
+	return scheme, params
+}
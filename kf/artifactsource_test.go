@@ -0,0 +1,217 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// newTestRegistry returns a registry serving the layers as foo:1.0 in namespace ns, guarded by bearer tokens
+func newTestRegistry(t *testing.T, layers map[string][]byte) *httptest.Server {
+	blobs := map[string][]byte{}
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType}
+	for title, layer := range layers {
+		sum := sha256.Sum256(layer)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		blobs[digest] = layer
+		manifest.Layers = append(manifest.Layers, ociDescriptor{
+			MediaType:   "application/vnd.oci.image.layer.v1.tar",
+			Digest:      digest,
+			Size:        int64(len(layer)),
+			Annotations: map[string]string{ociTitleAnnotation: title},
+		})
+	}
+
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:ns/foo:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:ns/foo:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/ns/foo/manifests/1.0":
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			json.NewEncoder(w).Encode(manifest)
+		case filepath.Dir(r.URL.Path) == "/v2/ns/foo/blobs":
+			blob, ok := blobs[filepath.Base(r.URL.Path)]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			http.ServeContent(w, r, "", time.Now(), bytes.NewReader(blob))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	srv = httptest.NewServer(mux)
+	return srv
+}
+
+func Test_ociArtifactSource_Fetch(t *testing.T) {
+	srv := newTestRegistry(t, map[string][]byte{
+		"focal/foo.tar.gz": []byte("focal artifact"),
+		"foo.tar.gz":       []byte("generic artifact"),
+	})
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		program  models.BPFProgram
+		platform string
+		want     []byte
+		wantErr  bool
+	}{
+		{
+			name:     "PlatformLayer",
+			program:  models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"},
+			platform: "focal",
+			want:     []byte("focal artifact"),
+		},
+		{
+			name:     "GenericLayer",
+			program:  models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"},
+			platform: "generic",
+			want:     []byte("generic artifact"),
+		},
+		{
+			name:     "MissingPlatformLayer",
+			program:  models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"},
+			platform: "jammy",
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownTag",
+			program:  models.BPFProgram{Name: "foo", Version: "2.0", Artifact: "foo.tar.gz"},
+			platform: "focal",
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownArtifact",
+			program:  models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "bar.tar.gz"},
+			platform: "focal",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoURL, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatalf("failed to parse url %v", err)
+			}
+			repoURL.Scheme = ociPlainHTTPScheme
+			repoURL.Path = "/ns"
+			source, err := getArtifactSource(repoURL.Scheme)
+			if err != nil {
+				t.Fatalf("getArtifactSource() error = %v", err)
+			}
+
+			conf := &config.Config{BPFDir: t.TempDir(), HttpClientTimeout: time.Second}
+			b := &BPF{Program: tt.program}
+			artifact, err := source.Fetch(repoURL, b, tt.platform, conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := io.ReadAll(artifact)
+			artifact.Close()
+			if err != nil {
+				t.Fatalf("failed to read artifact %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Fetch() = %q, want %q", got, tt.want)
+			}
+			if _, err := os.Stat(artifact.Name()); !os.IsNotExist(err) {
+				t.Errorf("Fetch() temporary artifact %s not removed on close", artifact.Name())
+			}
+		})
+	}
+}
+
+func Test_fileArtifactSource_Fetch(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, "foo", "1.0", "focal"), 0755); err != nil {
+		t.Fatalf("failed to create repo %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "foo", "1.0", "focal", "foo.tar.gz"), []byte("artifact"), 0644); err != nil {
+		t.Fatalf("failed to create artifact %v", err)
+	}
+	repoURL := &url.URL{Scheme: fileScheme, Path: repo}
+	conf := &config.Config{}
+
+	b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"}}
+	artifact, err := (&fileArtifactSource{}).Fetch(repoURL, b, "focal", conf)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	artifact.Close()
+	if _, err := os.Stat(artifact.Name()); err != nil {
+		t.Errorf("Fetch() repository artifact removed on close %v", err)
+	}
+
+	b.Program.Version = "2.0"
+	if _, err := (&fileArtifactSource{}).Fetch(repoURL, b, "focal", conf); err == nil {
+		t.Errorf("Fetch() of missing artifact did not fail")
+	}
+}
+
+func Test_parseAuthChallenge(t *testing.T) {
+	tests := []struct {
+		challenge  string
+		wantScheme string
+		wantParams map[string]string
+	}{
+		{
+			challenge:  `Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:ns/foo:pull,push"`,
+			wantScheme: "Bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "service": "registry.example.com", "scope": "repository:ns/foo:pull,push"},
+		},
+		{
+			challenge:  `Basic realm="registry"`,
+			wantScheme: "Basic",
+			wantParams: map[string]string{"realm": "registry"},
+		},
+		{
+			challenge:  `Bearer realm=https://auth.example.com/token, service=registry`,
+			wantScheme: "Bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "service": "registry"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.challenge, func(t *testing.T) {
+			scheme, params := parseAuthChallenge(tt.challenge)
+			if scheme != tt.wantScheme {
+				t.Errorf("parseAuthChallenge() scheme = %v, want %v", scheme, tt.wantScheme)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("parseAuthChallenge() params = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
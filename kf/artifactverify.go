@@ -0,0 +1,137 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/l3af-project/l3afd/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// artifactDigestFile holds the digest of the verified artifact in the program version directory
+const artifactDigestFile = ".artifact.sha256"
+
+// verifyArtifact checks the downloaded artifact against the expected SHA-256 digest and the
+// detached ed25519 signature of the program. The signature is computed over the raw SHA-256
+// digest of the artifact and must be issued by one of the trusted public keys in l3afd.cfg.
+// The artifact must not be extracted when this returns an error. On success the hex encoded
+// digest of the verified artifact is returned, or an empty string if nothing was verified.
+func (b *BPF) verifyArtifact(r io.Reader, conf *config.Config) (string, error) {
+	expectedDigest := strings.ToLower(strings.TrimSpace(b.Program.ArtifactSHA256))
+	signature := strings.TrimSpace(b.Program.ArtifactSignature)
+
+	if conf.ArtifactRequireSignature && (len(expectedDigest) == 0 || len(signature) == 0) {
+		return "", fmt.Errorf("artifact %s of program %s is missing digest or signature", b.Program.Artifact, b.Program.Name)
+	}
+
+	if len(expectedDigest) == 0 && len(signature) == 0 {
+		log.Warn().Msgf("artifact %s of program %s is not verified, no digest or signature provided", b.Program.Artifact, b.Program.Name)
+		return "", nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("failed to compute digest of artifact %s: %v", b.Program.Artifact, err)
+	}
+	digest := hash.Sum(nil)
+
+	if len(expectedDigest) > 0 {
+		expected, err := hex.DecodeString(expectedDigest)
+		if err != nil {
+			return "", fmt.Errorf("invalid artifact_sha256 %q for program %s: %v", b.Program.ArtifactSHA256, b.Program.Name, err)
+		}
+		if subtle.ConstantTimeCompare(expected, digest) != 1 {
+			return "", fmt.Errorf("artifact %s digest mismatch: expected %s got %s", b.Program.Artifact, expectedDigest, hex.EncodeToString(digest))
+		}
+	}
+
+	if len(signature) > 0 {
+		sig, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			return "", fmt.Errorf("invalid artifact_signature for program %s: %v", b.Program.Name, err)
+		}
+		if !verifyDigestSignature(digest, sig, conf.ArtifactTrustedKeys) {
+			return "", fmt.Errorf("artifact %s signature is not issued by any trusted public key", b.Program.Artifact)
+		}
+	}
+
+	log.Info().Msgf("artifact %s of program %s verified with digest %s", b.Program.Artifact, b.Program.Name, hex.EncodeToString(digest))
+	return hex.EncodeToString(digest), nil
+}
+
+// verifyDigestSignature reports whether sig is a valid signature of digest for any of the keys.
+func verifyDigestSignature(digest, sig []byte, keys []ed25519.PublicKey) bool {
+	if len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, digest, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveArtifactDigest records the digest of the verified artifact in the program version directory,
+// so that already extracted artifacts can be matched against the expected digest before reuse.
+func saveArtifactDigest(versionDir, digest string) error {
+	if len(digest) == 0 {
+		return nil
+	}
+	digestFile := filepath.Join(versionDir, artifactDigestFile)
+	if err := os.WriteFile(digestFile, []byte(digest), 0644); err != nil {
+		return fmt.Errorf("failed to save artifact digest %s: %v", digestFile, err)
+	}
+	return nil
+}
+
+// extractedArtifactTrusted reports whether the already extracted artifact can be reused
+// without downloading and verifying it again.
+func (b *BPF) extractedArtifactTrusted(conf *config.Config) bool {
+	expectedDigest := strings.ToLower(strings.TrimSpace(b.Program.ArtifactSHA256))
+	signature := strings.TrimSpace(b.Program.ArtifactSignature)
+	if conf.ArtifactRequireSignature && (len(expectedDigest) == 0 || len(signature) == 0) {
+		return false
+	}
+	if len(expectedDigest) == 0 && len(signature) == 0 {
+		return true
+	}
+
+	recorded, err := os.ReadFile(filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version, artifactDigestFile))
+	if err != nil {
+		log.Warn().Err(err).Msgf("no verified digest found for extracted artifact of program %s", b.Program.Name)
+		return false
+	}
+	recorded = bytes.TrimSpace(recorded)
+
+	if len(expectedDigest) > 0 && string(recorded) != expectedDigest {
+		return false
+	}
+
+	if len(signature) > 0 {
+		digest, err := hex.DecodeString(string(recorded))
+		if err != nil {
+			return false
+		}
+		sig, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			return false
+		}
+		return verifyDigestSignature(digest, sig, conf.ArtifactTrustedKeys)
+	}
+
+	return true
+}
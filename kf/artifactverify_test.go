@@ -0,0 +1,171 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_verifyArtifact(t *testing.T) {
+	artifact := []byte("this is just a test ebpf artifact")
+	sum := sha256.Sum256(artifact)
+	digest := hex.EncodeToString(sum[:])
+
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key %v", err)
+	}
+	otherPubKey, otherPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privKey, sum[:]))
+	otherSignature := base64.StdEncoding.EncodeToString(ed25519.Sign(otherPrivKey, sum[:]))
+
+	tests := []struct {
+		name       string
+		program    models.BPFProgram
+		conf       *config.Config
+		wantDigest string
+		wantErr    bool
+	}{
+		{
+			name:       "NoVerification",
+			program:    models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz"},
+			conf:       &config.Config{},
+			wantDigest: "",
+			wantErr:    false,
+		},
+		{
+			name:    "RequiredButMissing",
+			program: models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSHA256: digest},
+			conf:    &config.Config{ArtifactRequireSignature: true},
+			wantErr: true,
+		},
+		{
+			name:       "DigestMatch",
+			program:    models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSHA256: digest},
+			conf:       &config.Config{},
+			wantDigest: digest,
+			wantErr:    false,
+		},
+		{
+			name:    "DigestMismatch",
+			program: models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSHA256: hex.EncodeToString(make([]byte, 32))},
+			conf:    &config.Config{},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidDigest",
+			program: models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSHA256: "not-a-digest"},
+			conf:    &config.Config{},
+			wantErr: true,
+		},
+		{
+			name:       "TrustedSignature",
+			program:    models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSHA256: digest, ArtifactSignature: signature},
+			conf:       &config.Config{ArtifactRequireSignature: true, ArtifactTrustedKeys: []ed25519.PublicKey{otherPubKey, pubKey}},
+			wantDigest: digest,
+			wantErr:    false,
+		},
+		{
+			name:    "UntrustedSignature",
+			program: models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSHA256: digest, ArtifactSignature: otherSignature},
+			conf:    &config.Config{ArtifactTrustedKeys: []ed25519.PublicKey{pubKey}},
+			wantErr: true,
+		},
+		{
+			name:    "NoTrustedKeys",
+			program: models.BPFProgram{Name: "foo", Artifact: "foo.tar.gz", ArtifactSignature: signature},
+			conf:    &config.Config{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: tt.program}
+			got, err := b.verifyArtifact(bytes.NewReader(artifact), tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyArtifact() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.wantDigest {
+				t.Errorf("verifyArtifact() = %v, want %v", got, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func Test_extractedArtifactTrusted(t *testing.T) {
+	sum := sha256.Sum256([]byte("this is just a test ebpf artifact"))
+	digest := hex.EncodeToString(sum[:])
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privKey, sum[:]))
+
+	tests := []struct {
+		name    string
+		program models.BPFProgram
+		saved   string
+		want    bool
+	}{
+		{
+			name:    "NotVerified",
+			program: models.BPFProgram{Name: "foo", Version: "1.0"},
+			want:    true,
+		},
+		{
+			name:    "NoDigestSaved",
+			program: models.BPFProgram{Name: "foo", Version: "1.0", ArtifactSHA256: digest},
+			want:    false,
+		},
+		{
+			name:    "DigestSaved",
+			program: models.BPFProgram{Name: "foo", Version: "1.0", ArtifactSHA256: digest},
+			saved:   digest,
+			want:    true,
+		},
+		{
+			name:    "DifferentDigestSaved",
+			program: models.BPFProgram{Name: "foo", Version: "1.0", ArtifactSHA256: digest},
+			saved:   hex.EncodeToString(make([]byte, 32)),
+			want:    false,
+		},
+		{
+			name:    "SignatureOfSavedDigest",
+			program: models.BPFProgram{Name: "foo", Version: "1.0", ArtifactSignature: signature},
+			saved:   digest,
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{BPFDir: t.TempDir(), ArtifactTrustedKeys: []ed25519.PublicKey{pubKey}}
+			b := &BPF{Program: tt.program}
+			versionDir := filepath.Join(conf.BPFDir, tt.program.Name, tt.program.Version)
+			if err := os.MkdirAll(versionDir, 0755); err != nil {
+				t.Fatalf("failed to create version directory %v", err)
+			}
+			if err := saveArtifactDigest(versionDir, tt.saved); err != nil {
+				t.Fatalf("saveArtifactDigest() error = %v", err)
+			}
+			if got := b.extractedArtifactTrusted(conf); got != tt.want {
+				t.Errorf("extractedArtifactTrusted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
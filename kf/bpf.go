@@ -5,16 +5,12 @@
 package kf
 
 import (
-	"archive/tar"
-	"archive/zip"
 	"bytes"
-	"compress/gzip"
 	"container/ring"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
@@ -22,7 +18,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"unsafe"
 
@@ -36,8 +31,7 @@ import (
 )
 
 var (
-	execCommand           = exec.Command
-	copyBufPool sync.Pool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	execCommand = exec.Command
 )
 
 //lint:ignore U1000 avoid false linter error on windows, since this variable is only used in linux code
@@ -58,9 +52,24 @@ type BPF struct {
 	ProgID          int                       // eBPF Program ID
 	BpfMaps         map[string]BPFMap         // Config maps passed as map-args, Map name is Key
 	MetricsBpfMaps  map[string]*MetricsBPFMap // Metrics map name+key+aggregator is key
+	Manifest        *ArtifactManifest         // Manifest of the extracted artifact, if any
 	Ctx             context.Context           `json:"-"`
 	Done            chan bool                 `json:"-"`
+	LastExit        *models.ProcessExit       // Last exit of the user program
 	hostConfig      *config.Config
+	state           string                   // run time state set by the process monitor, see StateRunning
+	startedAt       time.Time                // last successful start
+	restartAt       time.Time                // next restart attempt, while restarting
+	native          *nativeProgram           // kernel objects of a program loaded by l3afd, see isNative
+	watch           *processWatch            // watcher of the daemon user program
+	exits           chan<- *processExitEvent // unexpected exits are reported to the process monitor
+	logs            *programLog              // captured stdout and stderr of the user program
+	events          eventHistory             // recent events of the program
+	adopted         *programState            // user program left running by the previous l3afd instance
+	secrets         secretValues             // secrets read for the program, redacted from logs
+	secretsDir      string                   // private secrets directory of the running program
+	waitCtx         waitContext              // context of the waits of the program
+	waits           *waitRegistry            // aborts the waits of a start of the program deleted meanwhile
 }
 
 func NewBpfProgram(ctx context.Context, program models.BPFProgram, conf *config.Config) *BPF {
@@ -104,6 +113,8 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 				StartArgs:         map[string]interface{}{},
 				StopArgs:          map[string]interface{}{},
 				StatusArgs:        map[string]interface{}{},
+				ArtifactSHA256:    conf.XDPRootArtifactSHA256,
+				ArtifactSignature: conf.XDPRootArtifactSignature,
 			},
 			RestartCount:    0,
 			Cmd:             nil,
@@ -112,6 +123,12 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 			hostConfig:      conf,
 			MapNamePath:     filepath.Join(conf.BpfMapDefaultPath, conf.XDPRootMapName),
 		}
+		if conf.XDPRootNativeLoad {
+			rootProgBPF.Program.CmdStart = ""
+			rootProgBPF.Program.CmdStop = ""
+			rootProgBPF.Program.ObjectFile = conf.XDPRootObjectFile
+			rootProgBPF.Program.EntryFunctionName = conf.XDPRootEntryFunctionName
+		}
 	case models.TCType:
 		rootProgBPF = &BPF{
 			Program: models.BPFProgram{
@@ -127,6 +144,8 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 				StartArgs:         map[string]interface{}{},
 				StopArgs:          map[string]interface{}{},
 				StatusArgs:        map[string]interface{}{},
+				ArtifactSHA256:    conf.TCRootArtifactSHA256,
+				ArtifactSignature: conf.TCRootArtifactSignature,
 			},
 			RestartCount:    0,
 			Cmd:             nil,
@@ -137,9 +156,17 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 		if direction == models.IngressType {
 			rootProgBPF.Program.MapName = conf.TCRootIngressMapName
 			rootProgBPF.MapNamePath = filepath.Join(conf.BpfMapDefaultPath, conf.TCRootIngressMapName)
+			rootProgBPF.Program.ObjectFile = conf.TCRootIngressObjectFile
+			rootProgBPF.Program.EntryFunctionName = conf.TCRootIngressEntryFunctionName
 		} else if direction == models.EgressType {
 			rootProgBPF.Program.MapName = conf.TCRootEgressMapName
 			rootProgBPF.MapNamePath = filepath.Join(conf.BpfMapDefaultPath, conf.TCRootEgressMapName)
+			rootProgBPF.Program.ObjectFile = conf.TCRootEgressObjectFile
+			rootProgBPF.Program.EntryFunctionName = conf.TCRootEgressEntryFunctionName
+		}
+		if conf.TCRootNativeLoad {
+			rootProgBPF.Program.CmdStart = ""
+			rootProgBPF.Program.CmdStop = ""
 		}
 	default:
 		return nil, fmt.Errorf("unknown direction %s for root program in iface %s", direction, ifaceName)
@@ -154,9 +181,15 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 		return nil, err
 	}
 
+	if err := rootProgBPF.ApplyManifest(); err != nil {
+		log.Error().Err(err).Msg("failed to apply root artifact manifest")
+		return nil, err
+	}
+
 	// On l3afd crashing scenario verify root program are unloaded properly by checking existence of persisted maps
-	// if map file exists then root program is still running
-	if fileExists(rootProgBPF.MapNamePath) {
+	// if map file exists then root program is still running. A natively loaded root program is adopted by Start instead.
+	// A root program which left a state file is adopted by Start as well.
+	if fileExists(rootProgBPF.MapNamePath) && !rootProgBPF.isNative() && rootProgBPF.liveState(ifaceName, direction) == nil {
 		log.Warn().Msgf("previous instance of root program %s is running, stopping it ", rootProgBPF.Program.Name)
 		if err := rootProgBPF.Stop(ifaceName, direction, conf.BpfChainingEnabled); err != nil {
 			return nil, fmt.Errorf("failed to stop root program on iface %s name %s direction %s", ifaceName, rootProgBPF.Program.Name, direction)
@@ -170,27 +203,25 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 	return rootProgBPF, nil
 }
 
-// Stop the NF process if running outside l3afd
-func StopExternalRunningProcess(processName string) error {
+// Stop the NF process if running outside l3afd, processes are matched by the path of their executable.
+// The processes to keep, adopted or left to be adopted by this l3afd instance, are not stopped.
+func StopExternalRunningProcess(executable string, keep map[int]bool) error {
 	// validate process name
-	if len(processName) < 1 {
+	if len(executable) < 1 {
 		return fmt.Errorf("process name can not be empty")
 	}
 
-	// process names are truncated to 15 chars
-	psName := processName
-	if len(processName) > 15 {
-		psName = processName[:15]
-	}
-
 	myPid := os.Getpid()
 	processList, err := ps.Processes()
 	if err != nil {
 		return fmt.Errorf("failed to fetch processes list")
 	}
-	log.Info().Msgf("Searching for process %s and not ppid %d", processName, myPid)
+	log.Info().Msgf("Searching for process %s and not ppid %d", executable, myPid)
 	for _, process := range processList {
-		if strings.Contains(process.Executable(), psName) {
+		if keep[process.Pid()] || process.Pid() == myPid {
+			continue
+		}
+		if sameExecutable(process, executable) {
 			if process.PPid() != myPid {
 				log.Warn().Msgf("found process id %d name %s ppid %d, stopping it", process.Pid(), process.Executable(), process.PPid())
 				osProcess, err := os.FindProcess(process.Pid())
@@ -206,16 +237,32 @@ func StopExternalRunningProcess(processName string) error {
 	return nil
 }
 
+// sameExecutable reports whether the process runs the executable. Processes whose executable path is
+// not available are not matched, their truncated names collide with other programs.
+func sameExecutable(process ps.Process, executable string) bool {
+	path, err := processExecutable(process.Pid())
+	return err == nil && path == executable
+}
+
 // Stop returns the last error seen, but stops bpf program.
 // Clean up all map handles.
 // Verify next program pinned map file is removed
 func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
-	if b.Program.UserProgramDaemon && b.Cmd == nil {
+	// A daemon which exited unexpectedly has no process left, but is stopped still
+	if b.Program.UserProgramDaemon && b.Cmd == nil && !b.isNative() && (b.watch == nil || b.watch.stopped()) {
 		return fmt.Errorf("BPFProgram is not running %s", b.Program.Name)
 	}
 
 	log.Info().Msgf("Stopping BPF Program - %s", b.Program.Name)
 
+	// The waits of the stop get a context released once it returns
+	defer b.waitCtx.cancel()
+
+	// The exit of the user program is expected from now on
+	if b.watch != nil {
+		b.watch.stop()
+	}
+
 	// Removing maps
 	for key, val := range b.BpfMaps {
 		log.Debug().Msgf("removing BPF maps %s value map %#v", key, val)
@@ -241,17 +288,18 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 
 	// Setting NFRunning to 0, indicates not running
 	stats.SetWithVersion(0.0, stats.NFRunning, b.Program.Name, b.Program.Version, direction, ifaceName)
+	b.events.add(EventStopped, "stopped on %s %s", ifaceName, direction)
+	b.removeState(ifaceName, direction)
+
+	if b.isNative() {
+		return b.stopNative(ifaceName, direction)
+	}
 
 	if len(b.Program.CmdStop) < 1 {
-		if err := b.ProcessTerminate(); err != nil {
-			return fmt.Errorf("BPFProgram %s process terminate failed with error: %v", b.Program.Name, err)
-		}
-		if b.Cmd != nil {
-			if err := b.Cmd.Wait(); err != nil {
-				log.Error().Err(err).Msgf("cmd wait at stopping bpf program %s errored", b.Program.Name)
-			}
-			b.Cmd = nil
+		if err := b.terminateProcess(ifaceName, direction, chain); err != nil {
+			return err
 		}
+		b.removeSecrets(ifaceName, direction)
 
 		// verify pinned map file is removed.
 		if err := b.VerifyPinnedMapVanish(chain); err != nil {
@@ -275,25 +323,27 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 	}
 
 	args := make([]string, 0, len(b.Program.StopArgs)<<1)
-	args = append(args, "--iface="+ifaceName)     // detaching from iface
-	args = append(args, "--direction="+direction) // xdpingress or ingress or egress
+	args = append(args, b.attachPointArg(ifaceName)) // detaching from iface or cgroup
+	args = append(args, "--direction="+direction)    // xdpingress or ingress or egress
 
-	for k, val := range b.Program.StopArgs {
-		if v, ok := val.(string); !ok {
-			err := fmt.Errorf("stop args is not a string for the ebpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert stop args value into string for program %s", b.Program.Name)
-			return err
-		} else {
-			args = append(args, "--"+k+"="+v)
-		}
+	stopArgs, err := b.commandArgs("stop_args", b.Program.StopArgs)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid stop args for program %s", b.Program.Name)
+		return err
 	}
+	args = append(args, stopArgs...)
 
-	log.Info().Msgf("bpf program stop command : %s %v", cmd, args)
-	prog := execCommand(cmd, args...)
-	if err := prog.Run(); err != nil {
+	log.Info().Msgf("bpf program stop command : %s %v", cmd, b.redactArgs(args))
+	prog, err := b.command(cmd, args...)
+	if err != nil {
+		return fmt.Errorf("failed to stop the program %s: %v", b.Program.CmdStop, err)
+	}
+	if err := b.runStopCommand(prog, ifaceName, direction); err != nil {
 		log.Warn().Err(err).Msgf("l3afd/nf : Failed to stop the program %s", b.Program.CmdStop)
 	}
-	b.Cmd = nil
+	// The daemon is expected to exit once stopped by the stop command
+	b.awaitStop(ifaceName, direction, chain)
+	b.removeSecrets(ifaceName, direction)
 
 	// verify pinned map file is removed.
 	if err := b.VerifyPinnedMapVanish(chain); err != nil {
@@ -316,67 +366,102 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 // This method waits till prog fd entry is updated, else returns error assuming kernel program is not loaded.
 // It also verifies the next program pinned map is created or not.
 func (b *BPF) Start(ifaceName, direction string, chain bool) error {
+	defer b.startWaits(ifaceName, direction)()
+	if err := b.start(ifaceName, direction, chain); err != nil {
+		return err
+	}
+
+	// Started by the API or the config, the restarts of a program in crash loop start over
+	if b.state == StateCrashLoop {
+		b.RestartCount = 0
+		stats.SetWithVersion(0.0, stats.NFCrashLoop, b.Program.Name, b.Program.Version, direction, ifaceName)
+	}
+	b.state = StateRunning
+	b.startedAt = time.Now()
+	b.events.add(EventStarted, "started on %s %s", ifaceName, direction)
+	return nil
+}
+
+func (b *BPF) start(ifaceName, direction string, chain bool) (err error) {
 	if b.FilePath == "" {
 		return errors.New("no program binary path found")
 	}
 
-	if err := StopExternalRunningProcess(b.Program.CmdStart); err != nil {
-		return fmt.Errorf("failed to stop external instance of the program %s with error : %v", b.Program.CmdStart, err)
+	// Kernel only programs are loaded by l3afd itself
+	if b.isNative() {
+		return b.startNative(ifaceName, direction, chain)
 	}
 
+	b.adopted = nil
 	cmd := filepath.Join(b.FilePath, b.Program.CmdStart)
 	// Validate
 	if err := assertExecutable(cmd); err != nil {
 		return fmt.Errorf("no executable permissions on %s - error %v", b.Program.CmdStart, err)
 	}
 
-	// Making sure old map entry is removed before passing the prog fd map to the program.
-	if len(b.PrevMapNamePath) > 0 {
-		if err := b.RemovePrevProgFD(); err != nil {
-			log.Error().Err(err).Msgf("ProgramMap %s entry removal failed", b.PrevMapNamePath)
-		}
+	args, err := b.startArgs(ifaceName, direction, chain)
+	if err != nil {
+		return err
 	}
 
-	args := make([]string, 0, len(b.Program.StartArgs)<<1)
-	args = append(args, "--iface="+ifaceName)     // attaching to interface
-	args = append(args, "--direction="+direction) // direction xdpingress or ingress or egress
-
-	if chain {
-		if len(b.PrevMapNamePath) > 1 {
-			args = append(args, "--map-name="+b.PrevMapNamePath)
-		}
+	// The user program left running by the previous l3afd instance is adopted rather than restarted
+	if b.adoptProcess(ifaceName, direction, chain, cmd, args) {
+		return nil
 	}
 
-	if len(b.hostConfig.BPFLogDir) > 1 {
-		args = append(args, "--log-dir="+b.hostConfig.BPFLogDir)
+	if err := StopExternalRunningProcess(cmd, b.livePids()); err != nil {
+		return fmt.Errorf("failed to stop external instance of the program %s with error : %v", b.Program.CmdStart, err)
 	}
 
-	if len(b.Program.RulesFile) > 1 && len(b.Program.Rules) > 1 {
-		fileName, err := b.createUpdateRulesFile(direction)
-		if err == nil {
-			args = append(args, "--rules-file="+fileName)
+	// Making sure old map entry is removed before passing the prog fd map to the program.
+	if len(b.PrevMapNamePath) > 0 {
+		if err := b.RemovePrevProgFD(); err != nil {
+			log.Error().Err(err).Msgf("ProgramMap %s entry removal failed", b.PrevMapNamePath)
 		}
 	}
 
-	for k, val := range b.Program.StartArgs {
-		if v, ok := val.(string); !ok {
-			err := fmt.Errorf("start args is not a string for the ebpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert start args value into string for program %s", b.Program.Name)
+	if err := b.prepareSecrets(ifaceName, direction); err != nil {
+		return err
+	}
+
+	// Daemons are started in their cgroup
+	var cgroup string
+	if b.Program.UserProgramDaemon {
+		if cgroup, err = b.userCgroup(ifaceName, direction); err != nil {
+			b.removeSecrets(ifaceName, direction)
 			return err
-		} else {
-			args = append(args, "--"+k+"="+v)
 		}
 	}
 
-	log.Info().Msgf("BPF Program start command : %s %v", cmd, args)
-	b.Cmd = execCommand(cmd, args...)
+	log.Info().Msgf("BPF Program start command : %s %v", cmd, b.redactArgs(args))
+	if b.Cmd, err = b.cgroupCommand(cgroup, cmd, args...); err != nil {
+		b.removeUserCgroup(ifaceName, direction)
+		b.removeSecrets(ifaceName, direction)
+		return fmt.Errorf("failed to start : %s %v", cmd, err)
+	}
+	output := b.captureOutput(ifaceName, direction)
 	if err := b.Cmd.Start(); err != nil {
 		log.Info().Err(err).Msgf("user mode BPF program failed - %s", b.Program.Name)
-		return fmt.Errorf("failed to start : %s %v", cmd, args)
+		b.closeOutput(output)
+		b.removeUserCgroup(ifaceName, direction)
+		b.removeSecrets(ifaceName, direction)
+		return fmt.Errorf("failed to start : %s %v", cmd, b.redactArgs(args))
 	}
+	// The user program writes to its own descriptor of the log file
+	b.closeOutput(output)
+
+	// Failures of the started user program come with its last output
+	defer func() {
+		if err != nil {
+			err = b.withLogTail(err)
+		}
+	}()
+
 	if !b.Program.UserProgramDaemon {
 		log.Info().Msgf("no user mode BPF program - %s No Pid", b.Program.Name)
-		if err := b.Cmd.Wait(); err != nil {
+		err := b.Cmd.Wait()
+		b.removeSecrets(ifaceName, direction)
+		if err != nil {
 			return fmt.Errorf("cmd wait at starting of bpf program returned with error %v", err)
 		}
 		b.Cmd = nil
@@ -387,6 +472,20 @@ func (b *BPF) Start(ifaceName, direction string, chain bool) error {
 		return nil
 	}
 
+	// Exits of the daemon are detected by its watcher rather than by polling
+	b.watchProcess(ifaceName, direction, chain)
+
+	// The daemon is not left running when it fails to start
+	defer func() {
+		if err != nil {
+			b.abortStart(chain)
+		}
+	}()
+
+	if len(cgroup) == 0 {
+		b.setPrLimits()
+	}
+
 	isRunning, err := b.isRunning()
 	if !isRunning {
 		log.Error().Err(err).Msg("eBPF program failed to start")
@@ -416,23 +515,23 @@ func (b *BPF) Start(ifaceName, direction string, chain bool) error {
 
 	// Fetch when prev program map is updated
 	if len(b.PrevMapNamePath) > 0 {
-		// retry 10 times to verify entry is created
-		for i := 0; i < 10; i++ {
-			b.ProgID, err = b.GetProgID()
-			if err == nil {
-				break
-			}
-
-			log.Warn().Msg("failed to fetch the program ID, retrying after a second ... ")
-			time.Sleep(1 * time.Second)
-		}
-
+		// wait for the entry to be created
+		err = b.waitFor("program ID", func() (bool, error) {
+			var idErr error
+			b.ProgID, idErr = b.GetProgID()
+			return idErr == nil, idErr
+		}, b.PrevMapNamePath)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to fetch ebpf program FD")
 			return fmt.Errorf("failed to fetch ebpf program FD %v", err)
 		}
 	}
 
+	// Exits of the user program restart it from now on
+	if err := b.watch.arm(); err != nil {
+		return fmt.Errorf("bpf program %s failed to start %v", b.Program.Name, err)
+	}
+
 	// KFconfigs
 	if len(b.Program.CmdConfig) > 0 && len(b.Program.ConfigFilePath) > 0 {
 		log.Info().Msgf("KP specific config monitoring - %s", b.Program.ConfigFilePath)
@@ -440,23 +539,55 @@ func (b *BPF) Start(ifaceName, direction string, chain bool) error {
 		go b.RunKFConfigs()
 	}
 
-	if err := b.SetPrLimits(); err != nil {
-		log.Warn().Err(err).Msg("failed to set resource limits")
-	}
 	stats.Incr(stats.NFStartCount, b.Program.Name, direction, ifaceName)
 	stats.Set(float64(time.Now().Unix()), stats.NFStartTime, b.Program.Name, direction, ifaceName)
 
+	if err := b.saveState(ifaceName, direction, args); err != nil {
+		log.Warn().Err(err).Msgf("failed to save state of bpf program %s", b.Program.Name)
+	}
+
 	log.Info().Msgf("BPF program - %s started Process id %d Program ID %d", b.Program.Name, b.Cmd.Process.Pid, b.ProgID)
 	return nil
 }
 
+// startArgs returns the args of the start command of the user program
+func (b *BPF) startArgs(ifaceName, direction string, chain bool) ([]string, error) {
+	args := make([]string, 0, len(b.Program.StartArgs)<<1)
+	args = append(args, b.attachPointArg(ifaceName)) // attaching to interface or cgroup
+	args = append(args, "--direction="+direction)    // direction xdpingress or ingress or egress
+
+	if chain {
+		if len(b.PrevMapNamePath) > 1 {
+			args = append(args, "--map-name="+b.PrevMapNamePath)
+		}
+	}
+
+	if len(b.hostConfig.BPFLogDir) > 1 {
+		args = append(args, "--log-dir="+b.hostConfig.BPFLogDir)
+	}
+
+	if len(b.Program.RulesFile) > 1 && len(b.Program.Rules) > 1 {
+		fileName, err := b.createUpdateRulesFile(direction)
+		if err == nil {
+			args = append(args, "--rules-file="+fileName)
+		}
+	}
+
+	startArgs, err := b.commandArgs("start_args", b.Program.StartArgs)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid start args for program %s", b.Program.Name)
+		return nil, err
+	}
+	return append(args, startArgs...), nil
+}
+
 // UpdateBPFMaps - Update the config ebpf maps via map arguments
 func (b *BPF) UpdateBPFMaps(ifaceName, direction string) error {
 	for k, val := range b.Program.MapArgs {
 
-		if v, ok := val.(string); !ok {
-			err := fmt.Errorf("update map args is not a string for the ebpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert map args value into string for program %s", b.Program.Name)
+		if v, err := mapArgValue(val); err != nil {
+			err = fmt.Errorf("update map args key %s of the ebpf program %s: %v", k, b.Program.Name, err)
+			log.Error().Err(err).Msgf("invalid map args for program %s", b.Program.Name)
 			return err
 		} else {
 			log.Info().Msgf("Update map args key %s val %s", k, v)
@@ -488,29 +619,29 @@ func (b *BPF) UpdateArgs(ifaceName, direction string) error {
 	}
 
 	args := make([]string, 0, len(b.Program.UpdateArgs)<<1)
-	args = append(args, "--iface="+ifaceName)       // attaching to interface
-	args = append(args, "--direction="+direction)   // direction xdpingress or ingress or egress
-	args = append(args, "--cmd="+models.UpdateType) // argument cmd to update configs
+	args = append(args, b.attachPointArg(ifaceName)) // attaching to interface or cgroup
+	args = append(args, "--direction="+direction)    // direction xdpingress or ingress or egress
+	args = append(args, "--cmd="+models.UpdateType)  // argument cmd to update configs
 
 	if len(b.hostConfig.BPFLogDir) > 1 {
 		args = append(args, "--log-dir="+b.hostConfig.BPFLogDir)
 	}
 
-	for k, val := range b.Program.UpdateArgs {
-		if v, ok := val.(string); !ok {
-			err := fmt.Errorf("update args is not a string for the ebpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert update args value into string for program %s", b.Program.Name)
-			return err
-		} else {
-			args = append(args, "--"+k+"="+v)
-		}
+	updateArgs, err := b.commandArgs("update_args", b.Program.UpdateArgs)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid update args for program %s", b.Program.Name)
+		return err
 	}
+	args = append(args, updateArgs...)
 
-	log.Info().Msgf("BPF Program update command : %s %v", cmd, args)
-	UpdateCmd := execCommand(cmd, args...)
+	log.Info().Msgf("BPF Program update command : %s %v", cmd, b.redactArgs(args))
+	UpdateCmd, err := b.command(cmd, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update : %s %v", cmd, err)
+	}
 	if err := UpdateCmd.Start(); err != nil {
 		log.Info().Err(err).Msgf("user mode BPF program failed - %s", b.Program.Name)
-		return fmt.Errorf("failed to start : %s %v", cmd, args)
+		return fmt.Errorf("failed to start : %s %v", cmd, b.redactArgs(args))
 	}
 
 	if err := UpdateCmd.Wait(); err != nil {
@@ -525,6 +656,10 @@ func (b *BPF) UpdateArgs(ifaceName, direction string) error {
 
 // Status of user program is running
 func (b *BPF) isRunning() (bool, error) {
+	if b.isNative() {
+		return b.nativeRunning()
+	}
+
 	// No user program or may be disabled
 	if len(b.Program.CmdStatus) > 1 {
 		cmd := filepath.Join(b.FilePath, b.Program.CmdStatus)
@@ -533,19 +668,16 @@ func (b *BPF) isRunning() (bool, error) {
 			return false, fmt.Errorf("failed to execute %s with error: %v", b.Program.CmdStatus, err)
 		}
 
-		args := make([]string, 0, len(b.Program.StatusArgs)<<1)
-
-		for k, val := range b.Program.StatusArgs {
-			if v, ok := val.(string); !ok {
-				err := fmt.Errorf("status args is not a string for the ebpf program %s", b.Program.Name)
-				log.Error().Err(err).Msgf("failed to convert status args value into string for program %s", b.Program.Name)
-				return false, err
-			} else {
-				args = append(args, "--"+k+"="+v)
-			}
+		args, err := b.commandArgs("status_args", b.Program.StatusArgs)
+		if err != nil {
+			log.Error().Err(err).Msgf("invalid status args for program %s", b.Program.Name)
+			return false, err
 		}
 
-		prog := execCommand(cmd, args...)
+		prog, err := b.command(cmd, args...)
+		if err != nil {
+			return false, fmt.Errorf("failed to execute %s with error: %v", b.Program.CmdStatus, err)
+		}
 		var out bytes.Buffer
 		prog.Stdout = &out
 		prog.Stderr = &out
@@ -570,184 +702,156 @@ func (b *BPF) isRunning() (bool, error) {
 		return false, errors.New("no process id found")
 	}
 
+	// Adopted processes are not children of l3afd, their pid may be reused once they exit
+	if b.adopted != nil && !processMatches(b.adopted) {
+		return false, fmt.Errorf("BPF Program not running %s, adopted process %d exited", b.Program.Name, b.adopted.Pid)
+	}
+
+	// The watcher reaps the process once it exits
+	if b.watch != nil {
+		if exit := b.watch.exited(); exit != nil {
+			return false, fmt.Errorf("BPF Program not running %s, %s", b.Program.Name, exitString(exit))
+		}
+	}
+
 	return IsProcessRunning(b.Cmd.Process.Pid, b.Program.Name)
 }
 
 // Check binary already exists
 func (b *BPF) VerifyAndGetArtifacts(conf *config.Config) error {
 
-	fPath := filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version, strings.Split(b.Program.Artifact, ".")[0])
-	if _, err := os.Stat(fPath); os.IsNotExist(err) {
-		return b.GetArtifacts(conf)
+	if err := b.validateObjectArtifact(); err != nil {
+		return err
 	}
 
-	b.FilePath = fPath
-	return nil
+	if err := b.validateRestartPolicy(); err != nil {
+		return err
+	}
+
+	if err := b.validateSecurity(); err != nil {
+		return err
+	}
+
+	if err := b.validateResourceLimits(); err != nil {
+		return err
+	}
+
+	if err := b.validateArgs(); err != nil {
+		return err
+	}
+
+	if err := b.validateSecrets(); err != nil {
+		return err
+	}
+
+	// A prefetch of the same version may be in progress, wait for it instead of downloading again
+	defer lockArtifact(b.Program.Name, b.Program.Version)()
+
+	fPath := filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version, artifactBaseName(b.Program.Artifact))
+	_, err := os.Stat(fPath)
+	switch {
+	case os.IsNotExist(err):
+		err = b.GetArtifacts(conf)
+	case !b.extractedArtifactComplete(conf):
+		log.Warn().Msgf("extracted artifact of program %s is incomplete, downloading again", b.Program.Name)
+		err = b.GetArtifacts(conf)
+	case !b.extractedArtifactTrusted(conf):
+		log.Warn().Msgf("extracted artifact of program %s does not match the expected digest, downloading again", b.Program.Name)
+		err = b.GetArtifacts(conf)
+	default:
+		b.FilePath = fPath
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.markArtifactUsed(conf)
 }
 
-// GetArtifacts downloads artifacts from the specified eBPF repo
+// GetArtifacts downloads artifacts from the specified eBPF repo. The mirrors of the repository
+// are tried in order, mirrors which failed recently are tried last.
 func (b *BPF) GetArtifacts(conf *config.Config) error {
 
-	buf := &bytes.Buffer{}
-	isDefaultURLUsed := false
-	platform, err := GetPlatform()
+	platform, err := ResolvePlatform(conf)
 	if err != nil {
 		return fmt.Errorf("failed to identify platform type: %v", err)
 	}
 
-	RepoURL := b.Program.EPRURL
-	if len(b.Program.EPRURL) == 0 {
-		RepoURL = conf.EBPFRepoURL
-		isDefaultURLUsed = true
+	repoURLs, isDefaultURLUsed := b.repoURLs(conf)
+	if len(repoURLs) == 0 {
+		return fmt.Errorf("no eBPF package repository configured for program %s", b.Program.Name)
+	}
+
+	repoURLs = mirrorHealth.order(repoURLs)
+	for i, repoURL := range repoURLs {
+		var artifact *FetchedArtifact
+		var digest string
+		artifact, digest, err = b.fetchArtifact(repoURL, isDefaultURLUsed, platform, conf)
+		if err != nil {
+			if i < len(repoURLs)-1 {
+				log.Warn().Err(err).Msgf("failed to get artifact %s of program %s from %s, trying next mirror", b.Program.Artifact, b.Program.Name, repoURL)
+				// The next mirror may not serve the same bytes, do not resume from this one
+				os.Remove(b.partialDownloadPath(conf))
+			}
+			continue
+		}
+		defer artifact.Close()
+		return b.extractArtifact(artifact.File, digest, conf)
+	}
+	if len(repoURLs) > 1 {
+		return fmt.Errorf("failed to get artifact %s of program %s from any of %d repositories, last error: %w", b.Program.Artifact, b.Program.Name, len(repoURLs), err)
 	}
+	return err
+}
 
-	URL, err := url.Parse(RepoURL)
+// fetchArtifact fetches the artifact from the repository trying the platform directories in order,
+// and verifies it. Repositories failing with other errors than a missing artifact are put into
+// cooldown, artifacts failing verification are not a failure of the repository.
+func (b *BPF) fetchArtifact(repoURL string, isDefaultURLUsed bool, platform models.Platform, conf *config.Config) (*FetchedArtifact, string, error) {
+	URL, err := url.Parse(repoURL)
 	if err != nil {
 		if isDefaultURLUsed {
-			return fmt.Errorf("unknown ebpf-repo format : %v", err)
+			return nil, "", fmt.Errorf("unknown ebpf-repo format : %v", err)
 		} else {
-			return fmt.Errorf("unknown ebpf_package_repo_url format : %v", err)
+			return nil, "", fmt.Errorf("unknown ebpf_package_repo_url format : %v", err)
 		}
 	}
 
-	URL.Path = path.Join(URL.Path, b.Program.Name, b.Program.Version, platform, b.Program.Artifact)
-	log.Info().Msgf("Retrieving artifact - %s", URL)
-	switch URL.Scheme {
-	case httpsScheme, httpScheme:
-		{
-			timeOut := time.Duration(conf.HttpClientTimeout) * time.Second
-			var netTransport = &http.Transport{
-				ResponseHeaderTimeout: timeOut,
-			}
-			client := http.Client{Transport: netTransport, Timeout: timeOut}
-
-			// Get the data
-			resp, err := client.Get(URL.String())
-			if err != nil {
-				return fmt.Errorf("download failed: %v", err)
-			}
-			defer resp.Body.Close()
+	source, err := getArtifactSource(URL.Scheme)
+	if err != nil {
+		return nil, "", err
+	}
 
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("get request returned unexpected status code: %d (%s), %d was expected\n\tResponse Body: %s", resp.StatusCode, http.StatusText(resp.StatusCode), http.StatusOK, buf.Bytes())
-			}
-			buf.ReadFrom(resp.Body)
+	log.Info().Msgf("Retrieving artifact %s of program %s from %s", b.Program.Artifact, b.Program.Name, URL)
+	var artifact *FetchedArtifact
+	for _, candidate := range platform.Candidates {
+		artifact, err = source.Fetch(URL, b, candidate, conf)
+		if err == nil {
+			log.Info().Msgf("Retrieved artifact %s of program %s for platform %s", b.Program.Artifact, b.Program.Name, candidate)
+			break
 		}
-	case fileScheme:
-		{
-			if fileExists(URL.Path) {
-				f, err := os.Open(URL.Path)
-				if err != nil {
-					return fmt.Errorf("opening err : %v", err)
-				}
-				buf.ReadFrom(f)
-				f.Close()
-			} else {
-				return fmt.Errorf("artifact is not found")
-			}
+		if !errors.Is(err, errArtifactNotFound) {
+			mirrorHealth.recordFailure(repoURL, conf.EBPFRepoFailureCooldown)
+			return nil, "", err
 		}
+		log.Info().Msgf("artifact %s of program %s is not found for platform %s", b.Program.Artifact, b.Program.Name, candidate)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("artifact %s of program %s is not found for platforms %v: %w", b.Program.Artifact, b.Program.Name, platform.Candidates, err)
 	}
 
-	switch artifact := b.Program.Artifact; {
-	case strings.HasSuffix(artifact, ".zip"):
-		{
-			c := bytes.NewReader(buf.Bytes())
-			zipReader, err := zip.NewReader(c, int64(c.Len()))
-			if err != nil {
-				return fmt.Errorf("failed to create zip reader: %v", err)
-			}
-			tempDir := filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version)
-
-			for _, file := range zipReader.File {
-
-				zippedFile, err := file.Open()
-				if err != nil {
-					return fmt.Errorf("unzip failed: %v", err)
-				}
-				defer zippedFile.Close()
-
-				extractedFilePath, err := ValidatePath(file.Name, tempDir)
-				if err != nil {
-					return err
-				}
-
-				if file.FileInfo().IsDir() {
-					os.MkdirAll(extractedFilePath, file.Mode())
-				} else {
-					outputFile, err := os.OpenFile(
-						extractedFilePath,
-						os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-						file.Mode(),
-					)
-					if err != nil {
-						return fmt.Errorf("unzip failed to create file: %v", err)
-					}
-					defer outputFile.Close()
-
-					buf := copyBufPool.Get().(*bytes.Buffer)
-					_, err = io.CopyBuffer(outputFile, zippedFile, buf.Bytes())
-					if err != nil {
-						return fmt.Errorf("GetArtifacts failed to copy files: %v", err)
-					}
-					copyBufPool.Put(buf)
-				}
-			}
-			newDir := strings.Split(b.Program.Artifact, ".")
-			b.FilePath = filepath.Join(tempDir, newDir[0])
-			return nil
-		}
-	case strings.HasSuffix(b.Program.Artifact, ".tar.gz"):
-		{
-			archive, err := gzip.NewReader(buf)
-			if err != nil {
-				return fmt.Errorf("failed to create Gzip reader: %v", err)
-			}
-			defer archive.Close()
-			tarReader := tar.NewReader(archive)
-			tempDir := filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version)
-
-			for {
-				header, err := tarReader.Next()
-
-				if err == io.EOF {
-					break
-				} else if err != nil {
-					return fmt.Errorf("untar failed: %v", err)
-				}
-
-				fPath, err := ValidatePath(header.Name, tempDir)
-				if err != nil {
-					return err
-				}
-
-				info := header.FileInfo()
-				if info.IsDir() {
-					if err = os.MkdirAll(fPath, info.Mode()); err != nil {
-						return fmt.Errorf("untar failed to create directories: %v", err)
-					}
-					continue
-				}
-
-				file, err := os.OpenFile(fPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
-				if err != nil {
-					return fmt.Errorf("untar failed to create file: %v", err)
-				}
-				defer file.Close()
-
-				buf := copyBufPool.Get().(*bytes.Buffer)
-				_, err = io.CopyBuffer(file, tarReader, buf.Bytes())
-				if err != nil {
-					return fmt.Errorf("GetArtifacts failed to copy files: %v", err)
-				}
-				copyBufPool.Put(buf)
-			}
-			newDir := strings.Split(b.Program.Artifact, ".")
-			b.FilePath = filepath.Join(tempDir, newDir[0])
-			return nil
-		}
-	default:
-		return fmt.Errorf("unknown artifact format")
+	digest, err := b.verifyArtifact(artifact, conf)
+	if err != nil {
+		artifact.Close()
+		return nil, "", fmt.Errorf("artifact verification failed: %v", err)
+	}
+	if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+		artifact.Close()
+		return nil, "", fmt.Errorf("failed to seek artifact: %v", err)
 	}
+	mirrorHealth.recordSuccess(repoURL)
+	return artifact, digest, nil
 }
 
 // create rules file
@@ -791,8 +895,26 @@ func (b *BPF) AddBPFMap(mapName string) error {
 func (b *BPF) GetBPFMap(mapName string) (*BPFMap, error) {
 	var newBPFMap BPFMap
 
-	// TC maps are pinned by default
-	if b.Program.ProgType == models.TCType {
+	// Maps of programs loaded by l3afd
+	if ebpfMap := b.nativeMap(mapName); ebpfMap != nil {
+		ebpfInfo, err := ebpfMap.Info()
+		if err != nil {
+			return nil, fmt.Errorf("fetching map info failed %v", err)
+		}
+
+		tempMapID, ok := ebpfInfo.ID()
+		if !ok {
+			return nil, fmt.Errorf("fetching map id of %s failed", mapName)
+		}
+
+		newBPFMap = BPFMap{
+			Name:    mapName,
+			MapID:   tempMapID,
+			Type:    ebpfInfo.Type,
+			BPFProg: b,
+		}
+	} else if b.Program.ProgType == models.TCType {
+		// TC maps are pinned by default
 		ebpfMap, err := ebpf.LoadPinnedMap(mapName, nil)
 		if err != nil {
 			return nil, fmt.Errorf("ebpf LoadPinnedMap failed %v", err)
@@ -816,9 +938,9 @@ func (b *BPF) GetBPFMap(mapName string) (*BPFMap, error) {
 			BPFProg: b,
 		}
 
-	} else if b.Program.ProgType == models.XDPType {
+	} else if b.Program.ProgType == models.XDPType || b.isUnchained() {
 
-		// XDP maps
+		// XDP, cgroup and tracing maps
 		// map names are truncated to 15 chars
 		mpName := mapName
 		if len(mapName) > 15 {
@@ -1006,16 +1128,13 @@ func (b *BPF) VerifyPinnedMapExists(chain bool) error {
 	if len(b.Program.MapName) > 0 {
 		log.Debug().Msgf("VerifyPinnedMapExists : Program %s MapName %s", b.Program.Name, b.Program.MapName)
 
-		for i := 0; i < 10; i++ {
-			if _, err = os.Stat(b.MapNamePath); err == nil {
-				log.Info().Msgf("VerifyPinnedMapExists : map file created %s", b.MapNamePath)
-				return nil
-			}
-			log.Warn().Msgf("failed to find pinned file, checking again after a second ... ")
-			time.Sleep(1 * time.Second)
-		}
-
-		if err != nil {
+		err = b.waitFor("pinned map "+b.MapNamePath, func() (bool, error) {
+			_, statErr := os.Stat(b.MapNamePath)
+			return statErr == nil, statErr
+		}, b.MapNamePath)
+		if err == nil {
+			log.Info().Msgf("VerifyPinnedMapExists : map file created %s", b.MapNamePath)
+		} else {
 			err = fmt.Errorf("failed to find pinned file %s err %v", b.MapNamePath, err)
 			log.Error().Err(err).Msg("")
 			return err
@@ -1032,19 +1151,21 @@ func (b *BPF) VerifyPinnedMapVanish(chain bool) error {
 		return nil
 	}
 
-	var err error
 	log.Debug().Msgf("VerifyPinnedMapVanish : Program %s MapName %s", b.Program.Name, b.Program.MapName)
 
-	for i := 0; i < 10; i++ {
-		if _, err = os.Stat(b.MapNamePath); os.IsNotExist(err) {
-			log.Info().Msgf("VerifyPinnedMapVanish : map file removed successfully - %s ", b.MapNamePath)
-			return nil
-		} else if err != nil {
-			log.Warn().Err(err).Msg("VerifyPinnedMapVanish: Error checking for map file")
-		} else {
-			log.Warn().Msg("VerifyPinnedMapVanish: program pinned file still exists, checking again after a second")
+	err := b.waitFor("removal of pinned map "+b.MapNamePath, func() (bool, error) {
+		_, statErr := os.Stat(b.MapNamePath)
+		if os.IsNotExist(statErr) {
+			return true, nil
+		} else if statErr != nil {
+			log.Warn().Err(statErr).Msg("VerifyPinnedMapVanish: Error checking for map file")
+			return false, statErr
 		}
-		time.Sleep(1 * time.Second)
+		return false, errors.New("program pinned file still exists")
+	}, b.MapNamePath)
+	if err == nil {
+		log.Info().Msgf("VerifyPinnedMapVanish : map file removed successfully - %s ", b.MapNamePath)
+		return nil
 	}
 
 	err = fmt.Errorf("%s map file was never removed by BPF program %s err %v", b.MapNamePath, b.Program.Name, err)
@@ -1061,41 +1182,35 @@ func (b *BPF) VerifyProcessObject() error {
 		return err
 	}
 
-	for i := 0; i < 10; i++ {
-		if b.Cmd.Process != nil {
-			return nil
-		}
-		log.Warn().Msgf("VerifyProcessObject: process object not found, checking again after a second")
-		time.Sleep(1 * time.Second)
+	if err := b.waitFor("process object", func() (bool, error) {
+		return b.Cmd.Process != nil, nil
+	}); err != nil {
+		err = fmt.Errorf("process object is nil - %s", b.Program.Name)
+		log.Error().Err(err).Msg("")
+		return err
 	}
-	err := fmt.Errorf("process object is nil - %s", b.Program.Name)
-	log.Error().Err(err).Msg("")
-	return err
+	return nil
 }
 
 // VerifyMetricsMapsVanish - checks for all metrics maps references are removed from the kernel
 func (b *BPF) VerifyMetricsMapsVanish() error {
 
-	for i := 0; i < 10; i++ {
-		mapExists := false
+	// map references are not visible in bpffs, they are polled
+	if err := b.waitFor("removal of metrics maps", func() (bool, error) {
 		for _, v := range b.BpfMaps {
-			_, err := ebpf.NewMapFromID(v.MapID)
-			if err == nil {
-				log.Warn().Msgf("VerifyMetricsMapsVanish: bpf map reference still exists - %s", v.Name)
-				mapExists = true
+			if m, err := ebpf.NewMapFromID(v.MapID); err == nil {
+				m.Close()
+				return false, fmt.Errorf("bpf map reference still exists - %s", v.Name)
 			}
 		}
-		if !mapExists {
-			return nil
-		}
-
-		log.Warn().Msgf("VerifyMetricsMapsVanish: bpf map reference still exists - %s, checking again after a second", b.Program.Name)
-		time.Sleep(1 * time.Second)
+		return true, nil
+	}); err != nil {
+		log.Warn().Err(err).Msgf("VerifyMetricsMapsVanish: %s", b.Program.Name)
+		err = fmt.Errorf("metrics maps are never removed by Kernel %s", b.Program.Name)
+		log.Error().Err(err).Msg("")
+		return err
 	}
-
-	err := fmt.Errorf("metrics maps are never removed by Kernel %s", b.Program.Name)
-	log.Error().Err(err).Msg("")
-	return err
+	return nil
 }
 
 func ValidatePath(filePath string, destination string) (string, error) {
@@ -14,13 +14,10 @@ import (
 	"os"
 	"os/exec"
 	"reflect"
-	"runtime"
 	"strings"
 	"testing"
 
-	"github.com/golang/mock/gomock"
 	"github.com/l3af-project/l3afd/config"
-	"github.com/l3af-project/l3afd/mocks"
 	"github.com/l3af-project/l3afd/models"
 )
 
@@ -526,14 +523,6 @@ func TestBPF_GetArtifacts(t *testing.T) {
 				FilePath:     tt.fields.FilePath,
 				RestartCount: tt.fields.RestartCount,
 			}
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-			m := mocks.NewMockplatformInterface(ctrl)
-			if runtime.GOOS == "windows" {
-				m.EXPECT().GetPlatform().Return("windows", nil).AnyTimes()
-			} else {
-				m.EXPECT().GetPlatform().Return("focal", nil).AnyTimes()
-			}
 			err := b.GetArtifacts(tt.args.conf)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("BPF.download() error = %v, wantErr %v", err, tt.wantErr)
@@ -665,7 +654,7 @@ func Test_StopExternalRunningProcess(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		err := StopExternalRunningProcess(tt.processName)
+		err := StopExternalRunningProcess(tt.processName, nil)
 		if (err != nil) != tt.wantErr {
 			t.Errorf("Error During execution StopExternalRunningProcess : %v", err)
 		}
@@ -0,0 +1,81 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// isNative reports whether l3afd loads the program itself, i.e. the program has an object file
+// and no user program to start it
+func (b *BPF) isNative() bool {
+	return len(b.Program.CmdStart) == 0 && (len(b.Program.ObjectFile) > 0 || isObjectArtifact(b.Program.Artifact))
+}
+
+// objectFilePath returns the path of the object file of a natively loaded program
+func (b *BPF) objectFilePath() string {
+	if len(b.Program.ObjectFile) > 0 {
+		return filepath.Join(b.FilePath, b.Program.ObjectFile)
+	}
+	return filepath.Join(b.FilePath, b.Program.Artifact)
+}
+
+// nativePinPath returns the directory the maps of a natively loaded program are pinned in. A
+// cgroup or tracing program is attached to many targets, the maps of each attachment are pinned
+// apart.
+func (b *BPF) nativePinPath(attachPoint, direction string) string {
+	pinPath := filepath.Join(b.hostConfig.BpfMapDefaultPath, b.Program.Name)
+	if b.isUnchained() {
+		return filepath.Join(pinPath, pinName(attachPoint)+"_"+direction)
+	}
+	return pinPath
+}
+
+// nativeLinkPath returns the pin of the link attaching the program to the interface, cgroup or
+// tracing target in the direction
+func (b *BPF) nativeLinkPath(attachPoint, direction string) string {
+	return filepath.Join(b.nativePinPath(attachPoint, direction), "link_"+pinName(attachPoint)+"_"+direction)
+}
+
+// pinnableMap reports whether the map can be pinned by name, maps of data sections like .rodata
+// can not
+func pinnableMap(name string) bool {
+	return len(name) > 0 && !strings.Contains(name, ".")
+}
+
+// containsMapID reports whether the map IDs contain mapID
+func containsMapID(mapIDs []ebpf.MapID, mapID ebpf.MapID) bool {
+	for _, id := range mapIDs {
+		if id == mapID {
+			return true
+		}
+	}
+	return false
+}
+
+// entryProgramName returns the program of the object file to attach, the entry function if
+// configured, otherwise the only program of the object file
+func entryProgramName(spec *ebpf.CollectionSpec, entryFunctionName string) (string, error) {
+	if len(entryFunctionName) > 0 {
+		if _, ok := spec.Programs[entryFunctionName]; !ok {
+			return "", fmt.Errorf("entry function %s is not found in object file", entryFunctionName)
+		}
+		return entryFunctionName, nil
+	}
+
+	names := make([]string, 0, len(spec.Programs))
+	for name := range spec.Programs {
+		names = append(names, name)
+	}
+	if len(names) != 1 {
+		sort.Strings(names)
+		return "", fmt.Errorf("object file has %d programs %v, entry_function_name is required", len(names), names)
+	}
+	return names[0], nil
+}
@@ -0,0 +1,136 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestBPF_isNative(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  models.BPFProgram
+		want     bool
+		wantPath string
+	}{
+		{
+			name:    "UserProgram",
+			program: models.BPFProgram{CmdStart: "foo", ObjectFile: "foo_kern.o", Artifact: "foo.tar.gz"},
+		},
+		{
+			name:     "ObjectFile",
+			program:  models.BPFProgram{ObjectFile: "foo_kern.o", Artifact: "foo.tar.gz"},
+			want:     true,
+			wantPath: "/opt/foo/foo_kern.o",
+		},
+		{
+			name:     "BareObject",
+			program:  models.BPFProgram{Artifact: "foo.o"},
+			want:     true,
+			wantPath: "/opt/foo/foo.o",
+		},
+		{
+			name:    "NoObjectFile",
+			program: models.BPFProgram{Artifact: "foo.tar.gz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: tt.program, FilePath: "/opt/foo"}
+			if got := b.isNative(); got != tt.want {
+				t.Errorf("isNative() = %v, want %v", got, tt.want)
+			}
+			if got := b.objectFilePath(); tt.want && got != tt.wantPath {
+				t.Errorf("objectFilePath() = %v, want %v", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func Test_entryProgramName(t *testing.T) {
+	single := &ebpf.CollectionSpec{Programs: map[string]*ebpf.ProgramSpec{"xdp_foo": {}}}
+	multiple := &ebpf.CollectionSpec{Programs: map[string]*ebpf.ProgramSpec{"xdp_foo": {}, "xdp_bar": {}}}
+	tests := []struct {
+		name              string
+		spec              *ebpf.CollectionSpec
+		entryFunctionName string
+		want              string
+		wantErr           bool
+	}{
+		{name: "SingleProgram", spec: single, want: "xdp_foo"},
+		{name: "EntryFunction", spec: multiple, entryFunctionName: "xdp_bar", want: "xdp_bar"},
+		{name: "MissingEntryFunction", spec: single, entryFunctionName: "xdp_bar", wantErr: true},
+		{name: "AmbiguousPrograms", spec: multiple, wantErr: true},
+		{name: "NoPrograms", spec: &ebpf.CollectionSpec{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := entryProgramName(tt.spec, tt.entryFunctionName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("entryProgramName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("entryProgramName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_StartNativeMissingObject(t *testing.T) {
+	dir := t.TempDir()
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", Artifact: "foo.o", ProgType: models.XDPType},
+		FilePath:   dir,
+		hostConfig: &config.Config{BpfMapDefaultPath: dir},
+	}
+	if err := b.Start("lo", models.XDPIngressType, false); err == nil {
+		t.Errorf("Start() succeeded without object file %s", filepath.Join(dir, "foo.o"))
+	}
+	if running, _ := b.isRunning(); running {
+		t.Errorf("isRunning() = true for a program failing to load")
+	}
+}
+
+func Test_pinnableMap(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "xdp_root_array", want: true},
+		{name: ".rodata"},
+		{name: ".data.config"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pinnableMap(tt.name); got != tt.want {
+				t.Errorf("pinnableMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_nativeLinkPath(t *testing.T) {
+	b := &BPF{Program: models.BPFProgram{Name: "xdp-root"}, hostConfig: &config.Config{BpfMapDefaultPath: "/sys/fs/bpf"}}
+	if got, want := b.nativeLinkPath("eth0.100", models.XDPIngressType), "/sys/fs/bpf/xdp-root/link_eth0_100_xdpingress"; got != want {
+		t.Errorf("nativeLinkPath() = %v, want %v", got, want)
+	}
+}
+
+func TestBPF_nativeLinkPathCgroup(t *testing.T) {
+	b := &BPF{Program: models.BPFProgram{Name: "egress-policy", ProgType: models.CgroupSKBType}, hostConfig: &config.Config{BpfMapDefaultPath: "/sys/fs/bpf"}}
+	pinPath := "/sys/fs/bpf/egress-policy/sys_fs_cgroup_app_slice_cgroup_skb_egress"
+	if got := b.nativePinPath("/sys/fs/cgroup/app.slice", models.CgroupSKBEgressType); got != pinPath {
+		t.Errorf("nativePinPath() = %v, want %v", got, pinPath)
+	}
+	if got, want := b.nativeLinkPath("/sys/fs/cgroup/app.slice", models.CgroupSKBEgressType), pinPath+"/link_sys_fs_cgroup_app_slice_cgroup_skb_egress"; got != want {
+		t.Errorf("nativeLinkPath() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,463 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/stats"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/rs/zerolog/log"
+	"github.com/vishvananda/netlink"
+)
+
+// nativeProgram holds the kernel objects of a program loaded by l3afd
+type nativeProgram struct {
+	collection *ebpf.Collection
+	program    *ebpf.Program
+	link       link.Link          // pinned attachment to the interface, nil when chained
+	filter     *netlink.BpfFilter // clsact filter attaching the TC program on kernels without TCX
+	attachType ebpf.AttachType    // attach type declared by the section of the entry function
+	chained    bool               // program is inserted into the chaining map of the previous program
+	pinned     []string           // map and link pins created by l3afd
+}
+
+// startNative loads the object file of the program and attaches the entry function. A chained
+// program is inserted into the chaining map of the previous program, otherwise it is attached to
+// the interface through a pinned bpf_link. The chaining map is pinned at MapNamePath, the other
+// maps under the pin directory of the program. A program left attached by a previous l3afd
+// instance is adopted as is, so that restarting l3afd does not disturb the data path.
+func (b *BPF) startNative(ifaceName, direction string, chain bool) error {
+	if b.native != nil {
+		if err := b.stopNative(ifaceName, direction); err != nil {
+			log.Warn().Err(err).Msgf("failed to unload previous instance of program %s", b.Program.Name)
+		}
+	}
+
+	objectFile := b.objectFilePath()
+	spec, err := ebpf.LoadCollectionSpec(objectFile)
+	if err != nil {
+		return fmt.Errorf("failed to load object file %s of program %s: %v", objectFile, b.Program.Name, err)
+	}
+
+	progName, err := entryProgramName(spec, b.Program.EntryFunctionName)
+	if err != nil {
+		return fmt.Errorf("program %s: %v", b.Program.Name, err)
+	}
+
+	// fentry programs are verified against the kernel function they trace at load time
+	if b.Program.ProgType == models.FentryType {
+		spec.Programs[progName].AttachTo = ifaceName
+	}
+
+	chainMapName := ""
+	if len(b.Program.MapName) > 0 {
+		chainMapName = filepath.Base(b.Program.MapName)
+		if _, ok := spec.Maps[chainMapName]; !ok {
+			return fmt.Errorf("chaining map %s of program %s is not found in object file %s", chainMapName, b.Program.Name, objectFile)
+		}
+	}
+
+	pinPath := b.nativePinPath(ifaceName, direction)
+	if err := os.MkdirAll(pinPath, 0750); err != nil {
+		return fmt.Errorf("failed to create map pin directory %s: %v", pinPath, err)
+	}
+
+	native, err := b.adoptNative(spec, progName, chainMapName, ifaceName, direction, chain)
+	if err == nil {
+		log.Info().Msgf("adopted program %s left attached by previous l3afd instance", b.Program.Name)
+	} else {
+		log.Debug().Err(err).Msgf("no program %s to adopt, loading it", b.Program.Name)
+		coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
+			Maps: ebpf.MapOptions{PinPath: pinPath},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load program %s into the kernel: %v", b.Program.Name, err)
+		}
+
+		native = &nativeProgram{collection: coll, program: coll.Programs[progName], attachType: spec.Programs[progName].AttachType}
+		if err := native.pinMaps(chainMapName, b.MapNamePath, pinPath); err != nil {
+			native.close()
+			return fmt.Errorf("failed to pin maps of program %s: %v", b.Program.Name, err)
+		}
+
+		if err := b.attachNative(native, ifaceName, direction, chain); err != nil {
+			native.close()
+			return err
+		}
+	}
+
+	info, err := native.program.Info()
+	if err != nil {
+		native.close()
+		return fmt.Errorf("failed to fetch info of program %s: %v", b.Program.Name, err)
+	}
+	progID, _ := info.ID()
+	b.ProgID = int(progID)
+	b.native = native
+
+	// BPF map config values
+	if len(b.Program.MapArgs) > 0 {
+		if err := b.UpdateBPFMaps(ifaceName, direction); err != nil {
+			log.Error().Err(err).Msg("failed to update ebpf program BPF maps")
+			// The program is not left loaded without its config
+			if stopErr := b.stopNative(ifaceName, direction); stopErr != nil {
+				log.Warn().Err(stopErr).Msgf("failed to unload program %s", b.Program.Name)
+			}
+			for key := range b.BpfMaps {
+				delete(b.BpfMaps, key)
+			}
+			b.ProgID = 0
+			return fmt.Errorf("failed to update ebpf program BPF maps %v", err)
+		}
+	}
+
+	stats.Incr(stats.NFStartCount, b.Program.Name, direction, ifaceName)
+	stats.Set(float64(time.Now().Unix()), stats.NFStartTime, b.Program.Name, direction, ifaceName)
+
+	log.Info().Msgf("BPF program - %s loaded natively from %s Program ID %d", b.Program.Name, objectFile, b.ProgID)
+	return nil
+}
+
+// adoptNative returns the program left attached by a previous l3afd instance, i.e. attached
+// through the pinned link or clsact filter, or inserted into the chaining map of the previous program, along with
+// its pinned maps. It fails unless the attached program is the entry function of the object
+// file and uses the pinned chaining map.
+func (b *BPF) adoptNative(spec *ebpf.CollectionSpec, progName, chainMapName, ifaceName, direction string, chain bool) (*nativeProgram, error) {
+	native := &nativeProgram{collection: &ebpf.Collection{
+		Programs: map[string]*ebpf.Program{},
+		Maps:     map[string]*ebpf.Map{},
+	}}
+	adopted := false
+	defer func() {
+		if !adopted {
+			native.release()
+		}
+	}()
+
+	var progID ebpf.ProgramID
+	if chain && len(b.PrevMapNamePath) > 0 {
+		if !fileExists(b.PrevMapNamePath) {
+			return nil, fmt.Errorf("prev prog map %s is not pinned", b.PrevMapNamePath)
+		}
+		id, err := b.GetProgID()
+		if err != nil {
+			return nil, err
+		}
+		progID = ebpf.ProgramID(id)
+		native.chained = true
+	} else {
+		id, err := b.adoptAttachment(native, ifaceName, direction)
+		if err != nil {
+			return nil, err
+		}
+		progID = id
+	}
+
+	prog, err := ebpf.NewProgramFromID(progID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attached program %d: %v", progID, err)
+	}
+	native.program = prog
+	native.collection.Programs[progName] = prog
+
+	info, err := prog.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch info of program %d: %v", progID, err)
+	}
+	if info.Type != spec.Programs[progName].Type || !strings.HasPrefix(progName, info.Name) || len(info.Name) == 0 {
+		return nil, fmt.Errorf("attached program %s is not %s", info.Name, progName)
+	}
+	mapIDs, _ := info.MapIDs()
+
+	pinPath := b.nativePinPath(ifaceName, direction)
+	for name, mapSpec := range spec.Maps {
+		if !pinnableMap(name) {
+			continue
+		}
+		fPath := filepath.Join(pinPath, name)
+		if name == chainMapName {
+			fPath = b.MapNamePath
+		}
+		m, err := ebpf.LoadPinnedMap(fPath, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pinned map %s: %v", fPath, err)
+		}
+		native.collection.Maps[name] = m
+		if mapSpec.Pinning != ebpf.PinByName {
+			native.pinned = append(native.pinned, fPath)
+		}
+		if err := mapSpec.Compatible(m); err != nil {
+			return nil, fmt.Errorf("pinned map %s is incompatible: %v", fPath, err)
+		}
+		if name != chainMapName {
+			continue
+		}
+		mapInfo, err := m.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch info of map %s: %v", fPath, err)
+		}
+		if mapID, ok := mapInfo.ID(); !ok || !containsMapID(mapIDs, mapID) {
+			return nil, fmt.Errorf("attached program %s does not use chaining map %s", info.Name, fPath)
+		}
+	}
+	adopted = true
+	return native, nil
+}
+
+// attachNative inserts the program into the chaining map of the previous program, or attaches it
+// to the interface, cgroup or tracing target through a pinned link when it is not chained. A link left pinned by a previous
+// l3afd instance is updated to the program, which replaces the attached program atomically.
+func (b *BPF) attachNative(native *nativeProgram, ifaceName, direction string, chain bool) error {
+	if chain && len(b.PrevMapNamePath) > 0 {
+		prevMap, err := ebpf.LoadPinnedMap(b.PrevMapNamePath, nil)
+		if err != nil {
+			return fmt.Errorf("unable to access pinned prev prog map %s %v", b.PrevMapNamePath, err)
+		}
+		defer prevMap.Close()
+		if err := prevMap.Update(uint32(0), uint32(native.program.FD()), ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("unable to update prev prog map %s with program %s %v", b.PrevMapNamePath, b.Program.Name, err)
+		}
+		native.chained = true
+		return nil
+	}
+
+	linkPath := b.nativeLinkPath(ifaceName, direction)
+	if fileExists(linkPath) {
+		l, err := link.LoadPinnedLink(linkPath, nil)
+		if err == nil {
+			if err = l.Update(native.program); err == nil {
+				native.link = l
+				native.pinned = append(native.pinned, linkPath)
+				return nil
+			}
+			l.Close()
+		}
+		log.Warn().Err(err).Msgf("failed to reuse pinned link %s, replacing it", linkPath)
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf("failed to remove stale link %s: %v", linkPath, err)
+		}
+	}
+
+	switch b.Program.ProgType {
+	case models.XDPType:
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return fmt.Errorf("failed to find interface %s: %v", ifaceName, err)
+		}
+		l, err := link.AttachXDP(link.XDPOptions{Program: native.program, Interface: iface.Index})
+		if err != nil {
+			return fmt.Errorf("failed to attach XDP program %s to interface %s: %v", b.Program.Name, ifaceName, err)
+		}
+		native.link = l
+		if err := l.Pin(linkPath); err != nil {
+			return fmt.Errorf("failed to pin link of program %s at %s: %v", b.Program.Name, linkPath, err)
+		}
+		native.pinned = append(native.pinned, linkPath)
+		return nil
+	case models.TCType:
+		return b.attachTC(native, ifaceName, direction, linkPath)
+	case models.CgroupSKBType, models.CgroupSockAddrType, models.SockOpsType:
+		return b.attachCgroup(native, ifaceName, direction, linkPath)
+	case models.KprobeType, models.TracepointType, models.FentryType:
+		return b.attachTracing(native, ifaceName, direction, linkPath)
+	default:
+		return fmt.Errorf("native attach of %s program %s is not supported", b.Program.ProgType, b.Program.Name)
+	}
+}
+
+// adoptAttachment returns the ID of the program attached to the interface through the pinned
+// link, or the clsact filter of l3afd
+func (b *BPF) adoptAttachment(native *nativeProgram, ifaceName, direction string) (ebpf.ProgramID, error) {
+	linkPath := b.nativeLinkPath(ifaceName, direction)
+	if !fileExists(linkPath) {
+		if b.Program.ProgType == models.TCType {
+			return b.adoptTCFilter(native, ifaceName, direction)
+		}
+		return 0, fmt.Errorf("link %s is not pinned", linkPath)
+	}
+
+	l, err := link.LoadPinnedLink(linkPath, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pinned link %s: %v", linkPath, err)
+	}
+	native.link = l
+	native.pinned = append(native.pinned, linkPath)
+	info, err := l.Info()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch info of link %s: %v", linkPath, err)
+	}
+	if b.Program.ProgType == models.XDPType {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find interface %s: %v", ifaceName, err)
+		}
+		if xdp := info.XDP(); xdp == nil || int(xdp.Ifindex) != iface.Index {
+			return 0, fmt.Errorf("link %s is not attached to interface %s", linkPath, ifaceName)
+		}
+	}
+	return info.Program, nil
+}
+
+// pinMaps pins the chaining map at chainMapPath and the other maps not pinned by the object file
+// itself under pinPath
+func (n *nativeProgram) pinMaps(chainMapName, chainMapPath, pinPath string) error {
+	for name, m := range n.collection.Maps {
+		if !pinnableMap(name) {
+			continue
+		}
+		fPath := filepath.Join(pinPath, name)
+		if name == chainMapName {
+			fPath = chainMapPath
+		} else if m.IsPinned() {
+			continue
+		}
+		// A previous instance may not have been unloaded cleanly
+		if err := os.Remove(fPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale pin %s: %v", fPath, err)
+		}
+		if err := m.Pin(fPath); err != nil {
+			return fmt.Errorf("failed to pin map %s at %s: %v", name, fPath, err)
+		}
+		n.pinned = append(n.pinned, fPath)
+	}
+	return nil
+}
+
+// close removes the pins and filter created by l3afd, which detaches the program, and releases the kernel objects
+func (n *nativeProgram) close() error {
+	var errs []error
+	for _, fPath := range n.pinned {
+		if err := os.Remove(fPath); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to remove pin %s: %v", fPath, err))
+		}
+	}
+	n.pinned = nil
+	if n.filter != nil {
+		if err := netlink.FilterDel(n.filter); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete clsact filter: %v", err))
+		}
+		n.filter = nil
+	}
+	n.release()
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// release closes the file descriptors of the program, pinned links and maps stay in the kernel
+func (n *nativeProgram) release() {
+	if n.link != nil {
+		if err := n.link.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close link")
+		}
+	}
+	n.collection.Close()
+}
+
+// stopNative removes the program from the chaining map of the previous program, unless it was
+// replaced meanwhile, and unloads it. Without loaded program, e.g. after l3afd restarted, the
+// stale chaining map, link pins and clsact filter of the program are removed.
+func (b *BPF) stopNative(ifaceName, direction string) error {
+	native := b.native
+	if native == nil {
+		if b.Program.ProgType == models.TCType {
+			b.removeTCFilter(ifaceName, direction)
+		}
+		// The pin directory of a cgroup or tracing attachment holds the link and maps of the attachment only
+		if b.isUnchained() {
+			if err := os.RemoveAll(b.nativePinPath(ifaceName, direction)); err != nil {
+				return fmt.Errorf("failed to remove stale pins of program %s: %v", b.Program.Name, err)
+			}
+		}
+		stalePins := []string{b.nativeLinkPath(ifaceName, direction)}
+		if len(b.Program.MapName) > 0 {
+			stalePins = append(stalePins, b.MapNamePath)
+		}
+		for _, fPath := range stalePins {
+			if err := os.Remove(fPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove stale pin %s: %v", fPath, err)
+			}
+		}
+		return nil
+	}
+	b.native = nil
+
+	if native.chained {
+		if progID, err := b.GetProgID(); err == nil && native.isProgram(progID) {
+			if err := b.RemovePrevProgFD(); err != nil {
+				log.Warn().Err(err).Msgf("failed to remove program %s from prev prog map", b.Program.Name)
+			}
+		}
+	}
+
+	if err := native.close(); err != nil {
+		return fmt.Errorf("failed to unload program %s: %v", b.Program.Name, err)
+	}
+	if b.isUnchained() {
+		// Maps pinned by the object file itself stay, along with the directory
+		os.Remove(b.nativePinPath(ifaceName, direction))
+	}
+	return nil
+}
+
+// isProgram reports whether progID is the ID of the loaded program
+func (n *nativeProgram) isProgram(progID int) bool {
+	info, err := n.program.Info()
+	if err != nil {
+		return false
+	}
+	id, ok := info.ID()
+	return ok && int(id) == progID
+}
+
+// nativeRunning reports whether the program is loaded and still inserted in the chaining map of
+// the previous program
+func (b *BPF) nativeRunning() (bool, error) {
+	if b.native == nil {
+		return false, fmt.Errorf("program %s is not loaded", b.Program.Name)
+	}
+	if !b.native.chained {
+		return true, nil
+	}
+	progID, err := b.GetProgID()
+	if err != nil {
+		return false, err
+	}
+	if !b.native.isProgram(progID) {
+		return false, errors.New("prev prog map does not refer to the program")
+	}
+	return true, nil
+}
+
+// releaseNative leaves the program attached and releases it, the next l3afd instance adopts it
+func (b *BPF) releaseNative() {
+	if b.native == nil {
+		return
+	}
+	log.Info().Msgf("leaving program %s attached", b.Program.Name)
+	b.native.release()
+	b.native = nil
+}
+
+// nativeMap returns the map of the loaded program, nil if the program is not loaded natively
+func (b *BPF) nativeMap(mapName string) *ebpf.Map {
+	if b.native == nil {
+		return nil
+	}
+	return b.native.collection.Maps[filepath.Base(mapName)]
+}
@@ -0,0 +1,39 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build WINDOWS
+// +build WINDOWS
+
+package kf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// nativeProgram holds the kernel objects of a program loaded by l3afd
+type nativeProgram struct{}
+
+// startNative - native loading of programs is not supported on Windows
+func (b *BPF) startNative(ifaceName, direction string, chain bool) error {
+	return fmt.Errorf("native loading of program %s is not supported on Windows, cmd_start is required", b.Program.Name)
+}
+
+// stopNative - native loading of programs is not supported on Windows
+func (b *BPF) stopNative(ifaceName, direction string) error {
+	return nil
+}
+
+// releaseNative - native loading of programs is not supported on Windows
+func (b *BPF) releaseNative() {}
+
+// nativeRunning - native loading of programs is not supported on Windows
+func (b *BPF) nativeRunning() (bool, error) {
+	return false, fmt.Errorf("program %s is not loaded", b.Program.Name)
+}
+
+// nativeMap - native loading of programs is not supported on Windows
+func (b *BPF) nativeMap(mapName string) *ebpf.Map {
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cgroupHooks are the directions of the programs attached to cgroups
+var cgroupHooks = []string{models.CgroupSKBIngressType, models.CgroupSKBEgressType, models.CgroupSockAddrType, models.SockOpsType}
+
+// newCgroupBpfs returns the empty program lists of all cgroup hooks
+func newCgroupBpfs() map[string]map[string]*list.List {
+	return newHookBpfs(cgroupHooks)
+}
+
+// isCgroup reports whether the program is attached to a cgroup rather than an interface
+func (b *BPF) isCgroup() bool {
+	switch b.Program.ProgType {
+	case models.CgroupSKBType, models.CgroupSockAddrType, models.SockOpsType:
+		return true
+	}
+	return false
+}
+
+// cgroupPrograms returns the programs of the config per cgroup hook
+func cgroupPrograms(bpfProgs *models.BPFPrograms) map[string][]*models.BPFProgram {
+	return map[string][]*models.BPFProgram{
+		models.CgroupSKBIngressType: bpfProgs.CgroupSKBIngress,
+		models.CgroupSKBEgressType:  bpfProgs.CgroupSKBEgress,
+		models.CgroupSockAddrType:   bpfProgs.CgroupSockAddr,
+		models.SockOpsType:          bpfProgs.SockOps,
+	}
+}
+
+// cgroupProgramNames returns the program names of the config per cgroup hook
+func cgroupProgramNames(bpfProgs *models.BPFProgramNames) map[string][]string {
+	return map[string][]string{
+		models.CgroupSKBIngressType: bpfProgs.CgroupSKBIngress,
+		models.CgroupSKBEgressType:  bpfProgs.CgroupSKBEgress,
+		models.CgroupSockAddrType:   bpfProgs.CgroupSockAddr,
+		models.SockOpsType:          bpfProgs.SockOps,
+	}
+}
+
+// verifyCgroupConfig checks the host name, the cgroup path and that only cgroup programs are
+// configured for the cgroup
+func (c *NFConfigs) verifyCgroupConfig(cgroupPath, HostName string, bpfProgs *models.BPFPrograms) error {
+	if HostName != c.HostName {
+		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if bpfProgs == nil {
+		errOut := fmt.Errorf("cgroup %s bpf programs are empty", cgroupPath)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if !filepath.IsAbs(cgroupPath) {
+		errOut := fmt.Errorf("cgroup path %s is not absolute", cgroupPath)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if len(bpfProgs.XDPIngress)+len(bpfProgs.TCIngress)+len(bpfProgs.TCEgress)+len(bpfProgs.Kprobe)+len(bpfProgs.Tracepoint)+len(bpfProgs.Fentry) > 0 {
+		errOut := fmt.Errorf("only cgroup programs can be attached to cgroup %s", cgroupPath)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	info, err := os.Stat(cgroupPath)
+	if err != nil || !info.IsDir() {
+		errOut := fmt.Errorf("%s cgroup not found in the host", cgroupPath)
+		log.Error().Err(errOut)
+		return errOut
+	}
+	return nil
+}
+
+// DeployCgroup starts, updates and stops the programs of the cgroup according to the config
+func (c *NFConfigs) DeployCgroup(cgroupPath, HostName string, bpfProgs *models.BPFPrograms) error {
+	if err := c.verifyCgroupConfig(cgroupPath, HostName, bpfProgs); err != nil {
+		return err
+	}
+
+	progs := cgroupPrograms(bpfProgs)
+	// The disabled programs may be starting, holding the lock until they are up
+	c.waits.abort(cgroupPath, disabledProgramNames(progs))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.deployUnchained(cgroupPath, cgroupHooks, progs)
+}
+
+// AddProgramsOnCgroup attaches the programs to the cgroup unless they are running
+func (c *NFConfigs) AddProgramsOnCgroup(cgroupPath, HostName string, bpfProgs *models.BPFPrograms) error {
+	if err := c.verifyCgroupConfig(cgroupPath, HostName, bpfProgs); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.addUnchained(cgroupPath, cgroupHooks, cgroupPrograms(bpfProgs))
+}
+
+// DeleteProgramsOnCgroup detaches the programs from the cgroup
+func (c *NFConfigs) DeleteProgramsOnCgroup(cgroupPath, HostName string, bpfProgs *models.BPFProgramNames) error {
+	if bpfProgs == nil {
+		errOut := fmt.Errorf("cgroup %s bpf programs are empty", cgroupPath)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if HostName != c.HostName {
+		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	names := cgroupProgramNames(bpfProgs)
+	// The programs may be starting, holding the lock until they are up
+	c.waits.abort(cgroupPath, names)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, direction := range cgroupHooks {
+		sort.Strings(names[direction])
+		if err := c.stopUnchainedBPFs(cgroupPath, direction, func(name string) bool {
+			return BinarySearch(names[direction], name)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopNRemoveAllCgroupBPFs stops the programs of all hooks of the cgroup
+func (c *NFConfigs) StopNRemoveAllCgroupBPFs(cgroupPath string) error {
+	return c.stopNRemoveAllUnchainedBPFs(cgroupPath, cgroupHooks)
+}
+
+// RemoveMissingCgroupsNBPFProgsInConfig - Stops the cgroup programs which are missing in the config
+func (c *NFConfigs) RemoveMissingCgroupsNBPFProgsInConfig(bpfProgCfgs []models.L3afBPFPrograms) error {
+	tempCgroups := map[string]bool{}
+	for _, bpfProgCfg := range bpfProgCfgs {
+		if len(bpfProgCfg.CgroupPath) == 0 || bpfProgCfg.BpfPrograms == nil {
+			continue
+		}
+		tempCgroups[bpfProgCfg.CgroupPath] = true
+		c.removeMissingUnchainedBPFs(bpfProgCfg.CgroupPath, cgroupHooks, cgroupPrograms(bpfProgCfg.BpfPrograms))
+	}
+
+	for _, cgroupPath := range c.cgroups {
+		if _, ok := tempCgroups[cgroupPath]; !ok {
+			log.Info().Msgf("Missing cgroup %s in the configs, stopping", cgroupPath)
+			if err := c.StopNRemoveAllCgroupBPFs(cgroupPath); err != nil {
+				log.Error().Err(err).Msgf("Failed to stop all the programs of cgroup %s", cgroupPath)
+			}
+			delete(c.cgroups, cgroupPath)
+		}
+	}
+	return nil
+}
+
+// CgroupEBPFPrograms - Method provides list of eBPF Programs attached to the cgroup
+func (c *NFConfigs) CgroupEBPFPrograms(cgroupPath string) models.L3afBPFPrograms {
+	progs := c.unchainedPrograms(cgroupPath, cgroupHooks)
+	return models.L3afBPFPrograms{
+		HostName:   c.HostName,
+		CgroupPath: cgroupPath,
+		BpfPrograms: &models.BPFPrograms{
+			CgroupSKBIngress: progs[models.CgroupSKBIngressType],
+			CgroupSKBEgress:  progs[models.CgroupSKBEgressType],
+			CgroupSockAddr:   progs[models.CgroupSockAddrType],
+			SockOps:          progs[models.SockOpsType],
+		},
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestNFConfigs_DeployCgroup(t *testing.T) {
+	cgroupPath := t.TempDir()
+	prog := &models.BPFProgram{Name: "foo", ProgType: models.CgroupSKBType, AdminStatus: models.Enabled}
+	tests := []struct {
+		name       string
+		hostName   string
+		cgroupPath string
+		bpfProgs   *models.BPFPrograms
+	}{
+		{name: "NilPrograms", hostName: machineHostname, cgroupPath: cgroupPath},
+		{name: "OtherHost", hostName: "other", cgroupPath: cgroupPath, bpfProgs: &models.BPFPrograms{}},
+		{name: "RelativePath", hostName: machineHostname, cgroupPath: "app", bpfProgs: &models.BPFPrograms{}},
+		{name: "MissingCgroup", hostName: machineHostname, cgroupPath: filepath.Join(cgroupPath, "missing"), bpfProgs: &models.BPFPrograms{}},
+		{name: "XDPProgram", hostName: machineHostname, cgroupPath: cgroupPath, bpfProgs: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{prog}}},
+		{name: "ProgTypeMismatch", hostName: machineHostname, cgroupPath: cgroupPath, bpfProgs: &models.BPFPrograms{SockOps: []*models.BPFProgram{prog}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NFConfigs{
+				HostName:   machineHostname,
+				HostConfig: &config.Config{},
+				CgroupBpfs: newCgroupBpfs(),
+				cgroups:    map[string]string{},
+				mu:         new(sync.Mutex),
+			}
+			if err := c.DeployCgroup(tt.cgroupPath, tt.hostName, tt.bpfProgs); err == nil {
+				t.Errorf("DeployCgroup() succeeded, want error")
+			}
+			if l := c.CgroupBpfs[models.SockOpsType][tt.cgroupPath]; l != nil && l.Len() > 0 {
+				t.Errorf("DeployCgroup() started %d programs", l.Len())
+			}
+		})
+	}
+}
+
+func TestNFConfigs_CgroupEBPFPrograms(t *testing.T) {
+	cgroupPath := "/sys/fs/cgroup/app"
+	ingress := &BPF{Program: models.BPFProgram{Name: "foo", ProgType: models.CgroupSKBType}}
+	sockOps := &BPF{Program: models.BPFProgram{Name: "bar", ProgType: models.SockOpsType}}
+	c := &NFConfigs{HostName: machineHostname, CgroupBpfs: newCgroupBpfs()}
+	c.CgroupBpfs[models.CgroupSKBIngressType][cgroupPath] = list.New()
+	c.CgroupBpfs[models.CgroupSKBIngressType][cgroupPath].PushBack(ingress)
+	c.CgroupBpfs[models.SockOpsType][cgroupPath] = list.New()
+	c.CgroupBpfs[models.SockOpsType][cgroupPath].PushBack(sockOps)
+
+	want := models.L3afBPFPrograms{
+		HostName:   machineHostname,
+		CgroupPath: cgroupPath,
+		BpfPrograms: &models.BPFPrograms{
+			CgroupSKBIngress: []*models.BPFProgram{&ingress.Program},
+			SockOps:          []*models.BPFProgram{&sockOps.Program},
+		},
+	}
+	if got := c.CgroupEBPFPrograms(cgroupPath); !reflect.DeepEqual(got, want) {
+		t.Errorf("CgroupEBPFPrograms() = %#v, want %#v", got, want)
+	}
+}
+
+func TestNFConfigs_DeleteEbpfProgramsOnCgroup(t *testing.T) {
+	cgroupPath := "/sys/fs/cgroup/app"
+	tests := []struct {
+		name       string
+		remaining  bool
+		wantCgroup bool
+	}{
+		{name: "LastProgram"},
+		{name: "RemainingProgram", remaining: true, wantCgroup: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NFConfigs{
+				HostName:       machineHostname,
+				HostConfig:     &config.Config{L3afConfigStoreFileName: filepath.Join(t.TempDir(), "l3af-config.json")},
+				CgroupBpfs:     newCgroupBpfs(),
+				TracingBpfs:    newTracingBpfs(),
+				cgroups:        map[string]string{cgroupPath: cgroupPath},
+				tracingTargets: map[string]string{},
+				mu:             new(sync.Mutex),
+			}
+			if tt.remaining {
+				c.CgroupBpfs[models.SockOpsType][cgroupPath] = list.New()
+				c.CgroupBpfs[models.SockOpsType][cgroupPath].PushBack(&BPF{Program: models.BPFProgram{Name: "bar", ProgType: models.SockOpsType}})
+			}
+			err := c.DeleteEbpfPrograms([]models.L3afBPFProgramNames{{
+				HostName:        machineHostname,
+				CgroupPath:      cgroupPath,
+				BpfProgramNames: &models.BPFProgramNames{CgroupSKBIngress: []string{"foo"}},
+			}})
+			if err != nil {
+				t.Fatalf("DeleteEbpfPrograms() error = %v", err)
+			}
+			if _, ok := c.cgroups[cgroupPath]; ok != tt.wantCgroup {
+				t.Errorf("DeleteEbpfPrograms() cgroup tracked = %v, want %v", ok, tt.wantCgroup)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"fmt"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// cgroupAttachType returns the attach type of the cgroup hook. Sock_addr programs hook the socket
+// operation declared by the section of their entry function, e.g. SEC("cgroup/connect4").
+func cgroupAttachType(direction string, sectionAttachType ebpf.AttachType) (ebpf.AttachType, error) {
+	switch direction {
+	case models.CgroupSKBIngressType:
+		return ebpf.AttachCGroupInetIngress, nil
+	case models.CgroupSKBEgressType:
+		return ebpf.AttachCGroupInetEgress, nil
+	case models.SockOpsType:
+		return ebpf.AttachCGroupSockOps, nil
+	case models.CgroupSockAddrType:
+		switch sectionAttachType {
+		case ebpf.AttachCGroupInet4Bind, ebpf.AttachCGroupInet6Bind,
+			ebpf.AttachCGroupInet4Connect, ebpf.AttachCGroupInet6Connect,
+			ebpf.AttachCGroupUDP4Sendmsg, ebpf.AttachCGroupUDP6Sendmsg,
+			ebpf.AttachCGroupUDP4Recvmsg, ebpf.AttachCGroupUDP6Recvmsg,
+			ebpf.AttachCgroupInet4GetPeername, ebpf.AttachCgroupInet6GetPeername,
+			ebpf.AttachCgroupInet4GetSockname, ebpf.AttachCgroupInet6GetSockname:
+			return sectionAttachType, nil
+		}
+		return 0, fmt.Errorf("section of sock_addr program does not declare the socket operation, e.g. cgroup/connect4")
+	default:
+		return 0, fmt.Errorf("unknown cgroup hook %s", direction)
+	}
+}
+
+// attachCgroup attaches the program to the cgroup through a link pinned at linkPath. Programs
+// attached by other tools to the cgroup keep running alongside.
+func (b *BPF) attachCgroup(native *nativeProgram, cgroupPath, direction, linkPath string) error {
+	attachType, err := cgroupAttachType(direction, native.attachType)
+	if err != nil {
+		return fmt.Errorf("program %s: %v", b.Program.Name, err)
+	}
+
+	l, err := link.AttachCgroup(link.CgroupOptions{
+		Path:    cgroupPath,
+		Attach:  attachType,
+		Program: native.program,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach %s program %s to cgroup %s: %v", b.Program.ProgType, b.Program.Name, cgroupPath, err)
+	}
+	native.link = l
+	// Kernels without cgroup bpf_link attach the program with BPF_F_ALLOW_MULTI, which can not be pinned
+	if err := l.Pin(linkPath); err != nil {
+		return fmt.Errorf("failed to pin link of program %s at %s: %v", b.Program.Name, linkPath, err)
+	}
+	native.pinned = append(native.pinned, linkPath)
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/cilium/ebpf"
+)
+
+func Test_cgroupAttachType(t *testing.T) {
+	tests := []struct {
+		name              string
+		direction         string
+		sectionAttachType ebpf.AttachType
+		want              ebpf.AttachType
+		wantErr           bool
+	}{
+		{name: "SKBIngress", direction: models.CgroupSKBIngressType, want: ebpf.AttachCGroupInetIngress},
+		{name: "SKBEgress", direction: models.CgroupSKBEgressType, sectionAttachType: ebpf.AttachCGroupInetEgress, want: ebpf.AttachCGroupInetEgress},
+		{name: "SockOps", direction: models.SockOpsType, want: ebpf.AttachCGroupSockOps},
+		{name: "Connect4", direction: models.CgroupSockAddrType, sectionAttachType: ebpf.AttachCGroupInet4Connect, want: ebpf.AttachCGroupInet4Connect},
+		{name: "SockAddrWithoutOperation", direction: models.CgroupSockAddrType, wantErr: true},
+		{name: "SockAddrSockCreate", direction: models.CgroupSockAddrType, sectionAttachType: ebpf.AttachCGroupInetSockCreate, wantErr: true},
+		{name: "UnknownHook", direction: models.IngressType, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cgroupAttachType(tt.direction, tt.sectionAttachType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cgroupAttachType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("cgroupAttachType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,10 +8,10 @@
 package kf
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -61,7 +61,8 @@ func prLimit(pid int, limit uintptr, rlimit *unix.Rlimit) error {
 	return nil
 }
 
-// Set process resource limits only non-zero value
+// Set process resource limits only non-zero value, without cgroup v2 only the address space of the
+// process is limited, RLIMIT_CPU would kill it rather than throttle it
 func (b *BPF) SetPrLimits() error {
 	var rlimit unix.Rlimit
 
@@ -78,25 +79,28 @@ func (b *BPF) SetPrLimits() error {
 		}
 	}
 
-	if b.Program.CPU != 0 {
-		rlimit.Cur = uint64(b.Program.CPU)
-		rlimit.Max = uint64(b.Program.CPU)
-		if err := prLimit(b.Cmd.Process.Pid, unix.RLIMIT_CPU, &rlimit); err != nil {
-			log.Error().Err(err).Msgf("Failed to set CPU limits - %s", b.Program.Name)
-		}
-	}
-
 	return nil
 }
 
 // ProcessTerminate - Send sigterm to the process
 func (b *BPF) ProcessTerminate() error {
 	if err := b.Cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) { // exited and reaped by its watcher already
+			return nil
+		}
 		return fmt.Errorf("BPFProgram %s SIGTERM failed with error: %v", b.Program.Name, err)
 	}
 	return nil
 }
 
+// exitSignal returns the name of the signal which terminated the process, if any
+func exitSignal(state *os.ProcessState) string {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return unix.SignalName(status.Signal())
+	}
+	return ""
+}
+
 // VerifyNMountBPFFS - Mounting bpf filesystem
 func VerifyNMountBPFFS() error {
 	dstPath := "/sys/fs/bpf"
@@ -147,20 +151,13 @@ func VerifyNMountTraceFS() error {
 	return nil
 }
 
-// This method get the Linux distribution Codename. This logic works on ubuntu
-// Here assumption is all edge nodes are running with lsb modules.
-// It returns empty string in case of error
-func GetPlatform() (string, error) {
-
-	linuxDistrib := execCommand("lsb_release", "-cs")
-	var out bytes.Buffer
-	linuxDistrib.Stdout = &out
-
-	if err := linuxDistrib.Run(); err != nil {
-		return "", fmt.Errorf("l3afd/nf : Failed to run command with error: %v", err)
+// hostPlatforms returns the os-release fields of the node and the matching platform directories
+func hostPlatforms() (map[string]string, []string, error) {
+	osRelease, err := readOSRelease()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return strings.TrimSpace(out.String()), nil
+	return osReleaseFields(osRelease), osReleasePlatforms(osRelease), nil
 }
 
 func IsProcessRunning(pid int, name string) (bool, error) {
@@ -194,3 +191,87 @@ func VerifyNCreateTCDirs() error {
 	}
 	return nil
 }
+
+// KernelVersion returns the release of the running kernel, e.g. 5.15.0-76-generic
+func KernelVersion() (string, error) {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "", fmt.Errorf("failed to read kernel release: %v", err)
+	}
+	return strings.TrimSpace(string(release)), nil
+}
+
+// watchDirs notifies the entries created, removed or renamed in the directories, such as pinned
+// objects of bpffs. The returned function stops the notifications.
+func watchDirs(dirs []string) (<-chan struct{}, func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inotify init failed: %v", err)
+	}
+	for _, dir := range dirs {
+		if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CREATE|unix.IN_DELETE|unix.IN_MOVED_FROM|unix.IN_MOVED_TO); err != nil {
+			unix.Close(fd)
+			return nil, nil, fmt.Errorf("inotify watch of %s failed: %v", dir, err)
+		}
+	}
+
+	// non-blocking, reads are handled by the runtime poller and unblocked by Close
+	f := os.NewFile(uintptr(fd), "inotify")
+	events := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := f.Read(buf); err != nil {
+				return
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, func() { f.Close() }, nil
+}
+
+// processStartTime returns the start time of the process in clock ticks since boot
+func processStartTime(pid int) (uint64, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// the fields following the command name, which may contain spaces, start with the state
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	const startTimeField = 22 - 3
+	if len(fields) <= startTimeField {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	return strconv.ParseUint(fields[startTimeField], 10, 64)
+}
+
+// processExecutable returns the path of the executable of the process
+func processExecutable(pid int) (string, error) {
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(path, " (deleted)"), nil
+}
+
+// mountSecrets mounts a tmpfs, which is never swapped, on the secrets directory of a user program,
+// only accessible by its user
+func mountSecrets(dir string, uid, gid int) error {
+	opts := fmt.Sprintf("mode=0700,size=1m,uid=%d,gid=%d", uid, gid)
+	return unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, opts)
+}
+
+// unmountSecrets unmounts the secrets directory of a user program, unless it is not mounted
+func unmountSecrets(dir string) error {
+	if err := unix.Unmount(dir, unix.MNT_DETACH); err != nil && err != unix.EINVAL {
+		return err
+	}
+	return nil
+}
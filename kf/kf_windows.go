@@ -31,8 +31,9 @@ func VerifyNMountBPFFS() error {
 	return nil
 }
 
-func GetPlatform() (string, error) {
-	return "Windows", nil
+// hostPlatforms returns the platform directories of Windows nodes
+func hostPlatforms() (map[string]string, []string, error) {
+	return nil, []string{"Windows", genericPlatform}, nil
 }
 
 func IsProcessRunning(pid int, name string) (bool, error) {
@@ -46,12 +47,50 @@ func IsProcessRunning(pid int, name string) (bool, error) {
 // ProcessTerminate - Kills the process
 func (b *BPF) ProcessTerminate() error {
 	if err := b.Cmd.Process.Kill(); err != nil {
+		if errors.Is(err, os.ErrProcessDone) { // exited and reaped by its watcher already
+			return nil
+		}
 		return fmt.Errorf("BPFProgram %s kill failed with error: %v", b.Program.Name, err)
 	}
 	return nil
 }
 
+// exitSignal - processes are not terminated by signals on Windows
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
+
 // VerifyNCreateTCDirs - Creating BPF sudo FS for pinning TC maps
 func VerifyNCreateTCDirs() error {
 	return nil
 }
+
+// KernelVersion - kernel version requirements do not apply on Windows
+func KernelVersion() (string, error) {
+	return "", nil
+}
+
+// watchDirs - directories are polled on Windows
+func watchDirs(dirs []string) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("directory notifications are not supported on Windows")
+}
+
+// processStartTime - user programs are not adopted on Windows
+func processStartTime(pid int) (uint64, error) {
+	return 0, errors.New("process start time is not supported on Windows")
+}
+
+// processExecutable - external processes are not matched on Windows
+func processExecutable(pid int) (string, error) {
+	return "", errors.New("process executable is not supported on Windows")
+}
+
+// mountSecrets - secret files are not supported on Windows
+func mountSecrets(dir string, uid, gid int) error {
+	return errors.New("secret files are not supported on Windows")
+}
+
+// unmountSecrets - secret files are not supported on Windows
+func unmountSecrets(dir string) error {
+	return nil
+}
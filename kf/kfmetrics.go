@@ -26,13 +26,19 @@ func NewpKFMetrics(chain bool, interval int) *kfMetrics {
 	return m
 }
 
-func (c *kfMetrics) kfMetricsStart(xdpProgs, ingressTCProgs, egressTCProgs map[string]*list.List) {
-	go c.kfMetricsWorker(xdpProgs, models.XDPIngressType)
-	go c.kfMetricsWorker(ingressTCProgs, models.IngressType)
-	go c.kfMetricsWorker(egressTCProgs, models.EgressType)
+func (c *kfMetrics) kfMetricsStart(xdpProgs, ingressTCProgs, egressTCProgs map[string]*list.List, hookProgs ...map[string]map[string]*list.List) {
+	go c.kfMetricsWorker(xdpProgs, models.XDPIngressType, c.Chain)
+	go c.kfMetricsWorker(ingressTCProgs, models.IngressType, c.Chain)
+	go c.kfMetricsWorker(egressTCProgs, models.EgressType, c.Chain)
+	// cgroup and tracing programs are not chained
+	for _, progs := range hookProgs {
+		for direction, bpfProgs := range progs {
+			go c.kfMetricsWorker(bpfProgs, direction, false)
+		}
+	}
 }
 
-func (c *kfMetrics) kfMetricsWorker(bpfProgs map[string]*list.List, direction string) {
+func (c *kfMetrics) kfMetricsWorker(bpfProgs map[string]*list.List, direction string, chain bool) {
 	for range time.NewTicker(1 * time.Second).C {
 		for ifaceName, bpfList := range bpfProgs {
 			if bpfList == nil { // no bpf programs are running
@@ -40,7 +46,7 @@ func (c *kfMetrics) kfMetricsWorker(bpfProgs map[string]*list.List, direction st
 			}
 			for e := bpfList.Front(); e != nil; e = e.Next() {
 				bpf := e.Value.(*BPF)
-				if c.Chain && bpf.Program.SeqID == 0 { // do not monitor root program
+				if chain && bpf.Program.SeqID == 0 { // do not monitor root program
 					continue
 				}
 				if bpf.Program.AdminStatus == models.Disabled {
@@ -49,6 +55,7 @@ func (c *kfMetrics) kfMetricsWorker(bpfProgs map[string]*list.List, direction st
 				if err := bpf.MonitorMaps(ifaceName, c.Intervals); err != nil {
 					log.Error().Err(err).Msgf("pMonitor monitor maps failed - %s", bpf.Program.Name)
 				}
+				bpf.MonitorCgroup(ifaceName, direction)
 			}
 		}
 	}
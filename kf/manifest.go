@@ -0,0 +1,215 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// artifactManifestFile is the optional manifest shipped inside the artifact
+const artifactManifestFile = "l3af-manifest.json"
+
+// ArtifactManifest describes the BPF program shipped in an artifact. The fields declared by the
+// manifest are defaults for the BPF program payload, and payloads setting a different value are
+// rejected.
+type ArtifactManifest struct {
+	CmdStart          string                     `json:"cmd_start"`
+	CmdStop           string                     `json:"cmd_stop"`
+	CmdStatus         string                     `json:"cmd_status"`
+	CmdConfig         string                     `json:"cmd_config"`
+	CmdUpdate         string                     `json:"cmd_update"`
+	MapName           string                     `json:"map_name"`
+	ObjectFile        string                     `json:"object_file"`
+	EntryFunctionName string                     `json:"entry_function_name"`
+	ProgType          string                     `json:"prog_type"`
+	MonitorMaps       []models.L3afDNFMetricsMap `json:"monitor_maps"`
+	MinKernelVersion  string                     `json:"min_kernel_version"` // e.g. 5.15
+	AllowedArgs       map[string][]string        `json:"allowed_args"`       // Allowed keys of start_args, stop_args, status_args, update_args, map_args and config_args
+}
+
+// loadArtifactManifest reads the manifest from the extracted artifact, it returns nil if the artifact has none
+func loadArtifactManifest(filePath string) (*ArtifactManifest, error) {
+	for _, dir := range []string{filePath, filepath.Dir(filePath)} {
+		f, err := os.Open(filepath.Join(dir, artifactManifestFile))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to open artifact manifest: %v", err)
+		}
+		defer f.Close()
+
+		manifest := &ArtifactManifest{}
+		decoder := json.NewDecoder(f)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(manifest); err != nil {
+			return nil, fmt.Errorf("failed to decode artifact manifest %s: %v", f.Name(), err)
+		}
+		for field := range manifest.AllowedArgs {
+			if _, err := programArgs(&models.BPFProgram{}, field); err != nil {
+				return nil, fmt.Errorf("invalid artifact manifest %s: %v", f.Name(), err)
+			}
+		}
+		return manifest, nil
+	}
+	return nil, nil
+}
+
+// ApplyManifest reads the manifest of the extracted artifact, fills in the program fields it
+// declares and validates the program against it.
+func (b *BPF) ApplyManifest() error {
+	manifest, err := loadArtifactManifest(b.FilePath)
+	if err != nil {
+		return err
+	}
+	b.Manifest = manifest
+	if manifest == nil {
+		return nil
+	}
+
+	mapName := b.Program.MapName
+	if err := manifest.Apply(&b.Program); err != nil {
+		return fmt.Errorf("program %s does not match its artifact manifest: %v", b.Program.Name, err)
+	}
+	if mapName != b.Program.MapName && b.hostConfig != nil {
+		b.MapNamePath = filepath.Join(b.hostConfig.BpfMapDefaultPath, b.Program.MapName)
+	}
+	log.Info().Msgf("applied artifact manifest of program %s version %s", b.Program.Name, b.Program.Version)
+	return nil
+}
+
+// Apply fills in the empty program fields declared by the manifest, and validates the program
+// against the manifest.
+func (m *ArtifactManifest) Apply(prog *models.BPFProgram) error {
+	fields := []struct {
+		name     string
+		value    *string
+		declared string
+	}{
+		{"cmd_start", &prog.CmdStart, m.CmdStart},
+		{"cmd_stop", &prog.CmdStop, m.CmdStop},
+		{"cmd_status", &prog.CmdStatus, m.CmdStatus},
+		{"cmd_config", &prog.CmdConfig, m.CmdConfig},
+		{"cmd_update", &prog.CmdUpdate, m.CmdUpdate},
+		{"map_name", &prog.MapName, m.MapName},
+		{"object_file", &prog.ObjectFile, m.ObjectFile},
+		{"entry_function_name", &prog.EntryFunctionName, m.EntryFunctionName},
+		{"prog_type", &prog.ProgType, m.ProgType},
+	}
+	for _, f := range fields {
+		if len(f.declared) == 0 {
+			continue
+		}
+		if len(*f.value) == 0 {
+			*f.value = f.declared
+		} else if *f.value != f.declared {
+			return fmt.Errorf("%s %q differs from %q declared by the artifact manifest", f.name, *f.value, f.declared)
+		}
+	}
+	if len(prog.MonitorMaps) == 0 && len(m.MonitorMaps) > 0 {
+		prog.MonitorMaps = append([]models.L3afDNFMetricsMap{}, m.MonitorMaps...)
+	}
+
+	for field, allowed := range m.AllowedArgs {
+		args, err := programArgs(prog, field)
+		if err != nil {
+			return err
+		}
+		for key := range args {
+			if !containsString(allowed, key) {
+				return fmt.Errorf("%s key %q is not allowed by the artifact manifest, allowed keys are %v", field, key, allowed)
+			}
+		}
+	}
+
+	if len(m.MinKernelVersion) > 0 {
+		kernelVersion, err := KernelVersion()
+		if err != nil {
+			return err
+		}
+		if len(kernelVersion) > 0 {
+			ok, err := kernelVersionAtLeast(kernelVersion, m.MinKernelVersion)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("kernel version %s is older than %s required by the artifact manifest", kernelVersion, m.MinKernelVersion)
+			}
+		}
+	}
+	return nil
+}
+
+// programArgs returns the program arguments of the payload field
+func programArgs(prog *models.BPFProgram, field string) (models.L3afDNFArgs, error) {
+	switch field {
+	case "start_args":
+		return prog.StartArgs, nil
+	case "stop_args":
+		return prog.StopArgs, nil
+	case "status_args":
+		return prog.StatusArgs, nil
+	case "update_args":
+		return prog.UpdateArgs, nil
+	case "map_args":
+		return prog.MapArgs, nil
+	case "config_args":
+		return prog.ConfigArgs, nil
+	default:
+		return nil, fmt.Errorf("unknown args field %q", field)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelVersionAtLeast reports whether the kernel release is at least the major.minor[.patch] version
+func kernelVersionAtLeast(release, minVersion string) (bool, error) {
+	have, err := parseKernelVersion(release)
+	if err != nil {
+		return false, err
+	}
+	want, err := parseKernelVersion(minVersion)
+	if err != nil {
+		return false, err
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			return have[i] > want[i], nil
+		}
+	}
+	return true, nil
+}
+
+// parseKernelVersion parses the numeric major, minor and patch version of a kernel release like 5.15.0-76-generic
+func parseKernelVersion(release string) ([3]int, error) {
+	var version [3]int
+	release = strings.SplitN(release, "-", 2)[0]
+	parts := strings.Split(release, ".")
+	if len(parts) < 2 {
+		return version, fmt.Errorf("invalid kernel version %q", release)
+	}
+	for i := 0; i < len(parts) && i < len(version); i++ {
+		n, err := strconv.Atoi(strings.TrimRightFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' }))
+		if err != nil {
+			return version, fmt.Errorf("invalid kernel version %q: %v", release, err)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
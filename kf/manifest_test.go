@@ -0,0 +1,177 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestArtifactManifest_Apply(t *testing.T) {
+	manifest := &ArtifactManifest{
+		CmdStart:          "foo",
+		CmdStop:           "foo",
+		MapName:           "foo_next_prog_array",
+		ObjectFile:        "foo_kern.o",
+		EntryFunctionName: "foo",
+		MonitorMaps:       []models.L3afDNFMetricsMap{{Name: "foo_count_map", Key: 0, Aggregator: "scalar"}},
+		MinKernelVersion:  "1.0",
+		AllowedArgs:       map[string][]string{"start_args": {"verbose", "collector_ip"}},
+	}
+
+	tests := []struct {
+		name    string
+		prog    models.BPFProgram
+		want    models.BPFProgram
+		wantErr bool
+	}{
+		{
+			name: "Defaults",
+			prog: models.BPFProgram{Name: "foo", StartArgs: models.L3afDNFArgs{"verbose": "2"}},
+			want: models.BPFProgram{
+				Name:              "foo",
+				CmdStart:          "foo",
+				CmdStop:           "foo",
+				MapName:           "foo_next_prog_array",
+				ObjectFile:        "foo_kern.o",
+				EntryFunctionName: "foo",
+				StartArgs:         models.L3afDNFArgs{"verbose": "2"},
+				MonitorMaps:       []models.L3afDNFMetricsMap{{Name: "foo_count_map", Key: 0, Aggregator: "scalar"}},
+			},
+		},
+		{
+			name: "MatchingFields",
+			prog: models.BPFProgram{Name: "foo", CmdStart: "foo", MapName: "foo_next_prog_array", CmdStatus: "foo-status"},
+			want: models.BPFProgram{
+				Name:              "foo",
+				CmdStart:          "foo",
+				CmdStop:           "foo",
+				CmdStatus:         "foo-status",
+				MapName:           "foo_next_prog_array",
+				ObjectFile:        "foo_kern.o",
+				EntryFunctionName: "foo",
+				MonitorMaps:       []models.L3afDNFMetricsMap{{Name: "foo_count_map", Key: 0, Aggregator: "scalar"}},
+			},
+		},
+		{
+			name: "KeepMonitorMaps",
+			prog: models.BPFProgram{Name: "foo", MonitorMaps: []models.L3afDNFMetricsMap{{Name: "bar_map", Key: 1, Aggregator: "avg"}}},
+			want: models.BPFProgram{
+				Name:              "foo",
+				CmdStart:          "foo",
+				CmdStop:           "foo",
+				MapName:           "foo_next_prog_array",
+				ObjectFile:        "foo_kern.o",
+				EntryFunctionName: "foo",
+				MonitorMaps:       []models.L3afDNFMetricsMap{{Name: "bar_map", Key: 1, Aggregator: "avg"}},
+			},
+		},
+		{
+			name:    "MismatchedObjectFile",
+			prog:    models.BPFProgram{Name: "foo", ObjectFile: "bar_kern.o"},
+			wantErr: true,
+		},
+		{
+			name:    "ArgNotAllowed",
+			prog:    models.BPFProgram{Name: "foo", StartArgs: models.L3afDNFArgs{"verbos": "2"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := manifest.Apply(&tt.prog)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.prog, tt.want) {
+				t.Errorf("Apply() = %#v, want %#v", tt.prog, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_ApplyManifest(t *testing.T) {
+	tests := []struct {
+		name        string
+		manifest    string
+		wantErr     bool
+		wantMapPath string
+	}{
+		{
+			name:        "NoManifest",
+			wantMapPath: "/sys/fs/bpf",
+		},
+		{
+			name:        "Manifest",
+			manifest:    `{"cmd_start": "foo", "map_name": "foo_next_prog_array"}`,
+			wantMapPath: "/sys/fs/bpf/foo_next_prog_array",
+		},
+		{
+			name:     "UnknownField",
+			manifest: `{"cmd_strat": "foo"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownArgsField",
+			manifest: `{"allowed_args": {"begin_args": ["verbose"]}}`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{BpfMapDefaultPath: "/sys/fs/bpf"}
+			b := NewBpfProgram(context.Background(), models.BPFProgram{Name: "foo"}, conf)
+			b.FilePath = filepath.Join(t.TempDir(), "foo")
+			if err := os.MkdirAll(b.FilePath, 0755); err != nil {
+				t.Fatalf("failed to create artifact directory %v", err)
+			}
+			if len(tt.manifest) > 0 {
+				if err := os.WriteFile(filepath.Join(b.FilePath, artifactManifestFile), []byte(tt.manifest), 0644); err != nil {
+					t.Fatalf("failed to write manifest %v", err)
+				}
+			}
+
+			err := b.ApplyManifest()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && b.MapNamePath != tt.wantMapPath {
+				t.Errorf("ApplyManifest() MapNamePath = %v, want %v", b.MapNamePath, tt.wantMapPath)
+			}
+		})
+	}
+}
+
+func Test_kernelVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		release    string
+		minVersion string
+		want       bool
+		wantErr    bool
+	}{
+		{release: "5.15.0-76-generic", minVersion: "5.15", want: true},
+		{release: "5.15.0-76-generic", minVersion: "5.4", want: true},
+		{release: "5.4.0-150-generic", minVersion: "5.15", want: false},
+		{release: "6.1.0", minVersion: "5.15.100", want: true},
+		{release: "5.15.90+", minVersion: "5.15.100", want: false},
+		{release: "5", minVersion: "5.15", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.release+">="+tt.minVersion, func(t *testing.T) {
+			got, err := kernelVersionAtLeast(tt.release, tt.minVersion)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kernelVersionAtLeast() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("kernelVersionAtLeast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
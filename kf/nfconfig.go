@@ -34,15 +34,28 @@ type NFConfigs struct {
 	IngressXDPBpfs map[string]*list.List
 	IngressTCBpfs  map[string]*list.List
 	EgressTCBpfs   map[string]*list.List
-
-	HostConfig   *config.Config
-	processMon   *pCheck
-	kfMetricsMon *kfMetrics
+	// These hold bpf programs attached to cgroups, map keys are the cgroup hooks and the
+	// cgroup paths. Cgroup programs are neither chained nor ordered.
+	CgroupBpfs map[string]map[string]*list.List
+	// These hold tracing programs, map keys are the tracing hooks and the attach targets
+	TracingBpfs map[string]map[string]*list.List
+
+	HostConfig    *config.Config
+	processMon    *pCheck
+	kfMetricsMon  *kfMetrics
+	artifactCache *ArtifactCache
+	prefetcher    *ArtifactPrefetcher
 
 	// keep track of interfaces
 	ifaces map[string]string
+	// keep track of cgroups
+	cgroups map[string]string
+	// keep track of tracing attach targets
+	tracingTargets map[string]string
 
 	mu *sync.Mutex
+	// waits of the programs being started, aborted by deletes without holding mu
+	waits *waitRegistry
 }
 
 var shutdownInterval = 900 * time.Millisecond
@@ -55,7 +68,12 @@ func NewNFConfigs(ctx context.Context, host string, hostConf *config.Config, pMo
 		IngressXDPBpfs: make(map[string]*list.List),
 		IngressTCBpfs:  make(map[string]*list.List),
 		EgressTCBpfs:   make(map[string]*list.List),
+		CgroupBpfs:     newCgroupBpfs(),
+		TracingBpfs:    newTracingBpfs(),
+		cgroups:        make(map[string]string),
+		tracingTargets: make(map[string]string),
 		mu:             new(sync.Mutex),
+		waits:          newWaitRegistry(),
 	}
 
 	var err error
@@ -65,10 +83,16 @@ func NewNFConfigs(ctx context.Context, host string, hostConf *config.Config, pMo
 		return nil, errOut
 	}
 
+	if hostConf != nil {
+		nfConfigs.artifactCache = NewArtifactCache(hostConf)
+		nfConfigs.prefetcher = NewArtifactPrefetcher(hostConf)
+	}
+
 	nfConfigs.processMon = pMon
-	nfConfigs.processMon.pCheckStart(nfConfigs.IngressXDPBpfs, nfConfigs.IngressTCBpfs, nfConfigs.EgressTCBpfs)
+	nfConfigs.processMon.configs = nfConfigs
+	nfConfigs.processMon.pCheckStart(nfConfigs.IngressXDPBpfs, nfConfigs.IngressTCBpfs, nfConfigs.EgressTCBpfs, nfConfigs.CgroupBpfs, nfConfigs.TracingBpfs)
 	nfConfigs.kfMetricsMon = metricsMon
-	nfConfigs.kfMetricsMon.kfMetricsStart(nfConfigs.IngressXDPBpfs, nfConfigs.IngressTCBpfs, nfConfigs.EgressTCBpfs)
+	nfConfigs.kfMetricsMon.kfMetricsStart(nfConfigs.IngressXDPBpfs, nfConfigs.IngressTCBpfs, nfConfigs.EgressTCBpfs, nfConfigs.CgroupBpfs, nfConfigs.TracingBpfs)
 	return nfConfigs, nil
 }
 
@@ -79,6 +103,10 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 	doneCh := make(chan struct{})
 	var wg sync.WaitGroup
 
+	if c.HostConfig != nil && c.HostConfig.KeepAttachedOnShutdown {
+		c.releaseNativePrograms()
+	}
+
 	// wait for waitGroup to shut down
 	go func() {
 		wg.Wait()
@@ -118,6 +146,32 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, bpfLists := range c.CgroupBpfs {
+			for cgroupPath := range bpfLists {
+				if err := c.StopNRemoveAllCgroupBPFs(cgroupPath); err != nil {
+					log.Warn().Err(err).Msg("failed to Close cgroup BPF Program")
+				}
+				delete(bpfLists, cgroupPath)
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, bpfLists := range c.TracingBpfs {
+			for target := range bpfLists {
+				if err := c.StopNRemoveAllTracingBPFs(target); err != nil {
+					log.Warn().Err(err).Msg("failed to Close tracing BPF Program")
+				}
+				delete(bpfLists, target)
+			}
+		}
+	}()
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -131,6 +185,40 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 	return nil
 }
 
+// releaseNativePrograms leaves the programs loaded by l3afd attached and the user programs with a
+// state file running and removes them from the lists, the next l3afd instance adopts them
+func (c *NFConfigs) releaseNativePrograms() {
+	for _, bpfLists := range c.allBpfLists() {
+		for _, bpfList := range bpfLists {
+			if bpfList == nil {
+				continue
+			}
+			for e := bpfList.Front(); e != nil; {
+				next := e.Next()
+				if bpf := e.Value.(*BPF); bpf.isNative() {
+					bpf.releaseNative()
+					bpfList.Remove(e)
+				} else if bpf.releaseProcess() {
+					bpfList.Remove(e)
+				}
+				e = next
+			}
+		}
+	}
+}
+
+// allBpfLists returns the program lists of all interface, cgroup and tracing hooks
+func (c *NFConfigs) allBpfLists() []map[string]*list.List {
+	bpfLists := []map[string]*list.List{c.IngressXDPBpfs, c.IngressTCBpfs, c.EgressTCBpfs}
+	for _, direction := range cgroupHooks {
+		bpfLists = append(bpfLists, c.CgroupBpfs[direction])
+	}
+	for _, direction := range tracingHooks {
+		bpfLists = append(bpfLists, c.TracingBpfs[direction])
+	}
+	return bpfLists
+}
+
 // Check for XDP programs are not loaded then initialise the array
 // Check for XDP root program is running for a interface. if not loaded it
 func (c *NFConfigs) VerifyAndStartXDPRootProgram(ifaceName, direction string) error {
@@ -165,8 +253,11 @@ func (c *NFConfigs) VerifyAndStartTCRootProgram(ifaceName, direction string) err
 	if err := VerifyNMountBPFFS(); err != nil {
 		return fmt.Errorf("failed to mount bpf file system")
 	}
-	if err := VerifyNCreateTCDirs(); err != nil {
-		return fmt.Errorf("failed to create tc/global diretories")
+	// tc/globals is the pin directory of iproute2, root programs loaded by l3afd pin their maps themselves
+	if !c.HostConfig.TCRootNativeLoad {
+		if err := VerifyNCreateTCDirs(); err != nil {
+			return fmt.Errorf("failed to create tc/global diretories")
+		}
 	}
 	// Check for chaining flag
 	if !c.HostConfig.BpfChainingEnabled {
@@ -196,11 +287,22 @@ func (c *NFConfigs) VerifyAndStartTCRootProgram(ifaceName, direction string) err
 	return nil
 }
 
+// newBPF returns the runtime details of the program, unexpected exits of its user program are
+// reported to the process monitor
+func (c *NFConfigs) newBPF(bpfProg *models.BPFProgram) *BPF {
+	bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig)
+	if c.processMon != nil {
+		bpf.exits = c.processMon.exits
+	}
+	bpf.waits = c.waits
+	return bpf
+}
+
 // This method inserts the element at the end of the list
 func (c *NFConfigs) PushBackAndStartBPF(bpfProg *models.BPFProgram, ifaceName, direction string) error {
 
 	log.Info().Msgf("PushBackAndStartBPF : iface %s, direction %s", ifaceName, direction)
-	bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig)
+	bpf := c.newBPF(bpfProg)
 	var bpfList *list.List
 
 	switch direction {
@@ -239,6 +341,10 @@ func (c *NFConfigs) DownloadAndStartBPFProgram(element *list.Element, ifaceName,
 		return fmt.Errorf("failed to get artifacts %s with error: %v", bpf.Program.Artifact, err)
 	}
 
+	if err := bpf.ApplyManifest(); err != nil {
+		return fmt.Errorf("failed to apply artifact manifest %s with error: %v", bpf.Program.Artifact, err)
+	}
+
 	if err := bpf.Start(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 		return fmt.Errorf("failed to start bpf program %s with error: %v", bpf.Program.Name, err)
 	}
@@ -315,6 +421,13 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 			continue
 		}
 
+		// Fill in the fields declared by the manifest of the running version, so they are not mistaken for changes
+		if data.Manifest != nil && data.Program.Version == bpfProg.Version {
+			if err := data.Manifest.Apply(bpfProg); err != nil {
+				return fmt.Errorf("BPF %s does not match its artifact manifest: %v", bpfProg.Name, err)
+			}
+		}
+
 		if reflect.DeepEqual(data.Program, *bpfProg) {
 			// Nothing to do
 			return nil
@@ -518,7 +631,7 @@ func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceNa
 		return nil
 	}
 
-	bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig)
+	bpf := c.newBPF(bpfProg)
 
 	switch direction {
 	case models.XDPIngressType:
@@ -659,6 +772,13 @@ func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFProgr
 		return errOut
 	}
 
+	// The disabled programs may be starting, holding the lock until they are up
+	c.waits.abort(ifaceName, disabledProgramNames(map[string][]*models.BPFProgram{
+		models.XDPIngressType: bpfProgs.XDPIngress,
+		models.IngressType:    bpfProgs.TCIngress,
+		models.EgressType:     bpfProgs.TCEgress,
+	}))
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -720,6 +840,26 @@ func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFProgr
 // DeployeBPFPrograms - Starts eBPF programs on the node if they are not running
 func (c *NFConfigs) DeployeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error {
 	for _, bpfProg := range bpfProgs {
+		if len(bpfProg.CgroupPath) > 0 {
+			if err := c.DeployCgroup(bpfProg.CgroupPath, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
+				if err := c.SaveConfigsToConfigStore(); err != nil {
+					return fmt.Errorf("deploy eBPF Programs failed to save configs %v", err)
+				}
+				return fmt.Errorf("failed to deploy BPF program on cgroup %s with error: %v", bpfProg.CgroupPath, err)
+			}
+			c.cgroups[bpfProg.CgroupPath] = bpfProg.CgroupPath
+			continue
+		}
+		if len(bpfProg.AttachTarget) > 0 {
+			if err := c.DeployTracing(bpfProg.AttachTarget, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
+				if err := c.SaveConfigsToConfigStore(); err != nil {
+					return fmt.Errorf("deploy eBPF Programs failed to save configs %v", err)
+				}
+				return fmt.Errorf("failed to deploy BPF program on attach target %s with error: %v", bpfProg.AttachTarget, err)
+			}
+			c.tracingTargets[bpfProg.AttachTarget] = bpfProg.AttachTarget
+			continue
+		}
 		if err := c.Deploy(bpfProg.Iface, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
 			if err := c.SaveConfigsToConfigStore(); err != nil {
 				return fmt.Errorf("deploy eBPF Programs failed to save configs %v", err)
@@ -732,9 +872,16 @@ func (c *NFConfigs) DeployeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error
 	if err := c.RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgs); err != nil {
 		log.Warn().Err(err).Msgf("Remove missing interfaces and BPF programs in the config failed with error ")
 	}
+	if err := c.RemoveMissingCgroupsNBPFProgsInConfig(bpfProgs); err != nil {
+		log.Warn().Err(err).Msgf("Remove missing cgroups and BPF programs in the config failed with error ")
+	}
+	if err := c.RemoveMissingTracingNBPFProgsInConfig(bpfProgs); err != nil {
+		log.Warn().Err(err).Msgf("Remove missing attach targets and BPF programs in the config failed with error ")
+	}
 	if err := c.SaveConfigsToConfigStore(); err != nil {
 		return fmt.Errorf("deploy eBPF Programs failed to save configs %v", err)
 	}
+	c.CollectArtifacts()
 	return nil
 }
 
@@ -749,6 +896,16 @@ func (c *NFConfigs) SaveConfigsToConfigStore() error {
 		bpfProgs = append(bpfProgs, bpfPrograms)
 	}
 
+	for _, cgroupPath := range c.cgroups {
+		log.Info().Msgf("SaveConfigsToConfigStore - cgroup %s", cgroupPath)
+		bpfProgs = append(bpfProgs, c.CgroupEBPFPrograms(cgroupPath))
+	}
+
+	for _, target := range c.tracingTargets {
+		log.Info().Msgf("SaveConfigsToConfigStore - attach target %s", target)
+		bpfProgs = append(bpfProgs, c.TracingEBPFPrograms(target))
+	}
+
 	file, err := json.MarshalIndent(bpfProgs, "", " ")
 	if err != nil {
 		log.Error().Err(err).Msgf("failed to marshal configs to save")
@@ -813,10 +970,109 @@ func (c *NFConfigs) EBPFProgramsAll() []models.L3afBPFPrograms {
 		BPFProgram := c.EBPFPrograms(iface)
 		BPFPrograms = append(BPFPrograms, BPFProgram)
 	}
+	for cgroupPath := range c.cgroups {
+		BPFPrograms = append(BPFPrograms, c.CgroupEBPFPrograms(cgroupPath))
+	}
+	for target := range c.tracingTargets {
+		BPFPrograms = append(BPFPrograms, c.TracingEBPFPrograms(target))
+	}
 
 	return BPFPrograms
 }
 
+// directionBpfLists returns the program lists of all directions and hooks
+func (c *NFConfigs) directionBpfLists() map[string]map[string]*list.List {
+	directions := map[string]map[string]*list.List{
+		models.XDPIngressType: c.IngressXDPBpfs,
+		models.IngressType:    c.IngressTCBpfs,
+		models.EgressType:     c.EgressTCBpfs,
+	}
+	for _, direction := range cgroupHooks {
+		directions[direction] = c.CgroupBpfs[direction]
+	}
+	for _, direction := range tracingHooks {
+		directions[direction] = c.TracingBpfs[direction]
+	}
+	return directions
+}
+
+// hasBPF reports whether the program is still attached to the attach point in the direction
+func (c *NFConfigs) hasBPF(bpf *BPF, attachPoint, direction string) bool {
+	bpfList := c.directionBpfLists()[direction][attachPoint]
+	if bpfList == nil {
+		return false
+	}
+	for e := bpfList.Front(); e != nil; e = e.Next() {
+		if e.Value.(*BPF) == bpf {
+			return true
+		}
+	}
+	return false
+}
+
+// ProgramStatus returns the run time state of all the programs, sorted by attach point and direction
+// and in chain order
+func (c *NFConfigs) ProgramStatus() []models.BPFProgramStatus {
+	status := make([]models.BPFProgramStatus, 0)
+	for direction, bpfLists := range c.directionBpfLists() {
+		for attachPoint, bpfList := range bpfLists {
+			if bpfList == nil {
+				continue
+			}
+			for e := bpfList.Front(); e != nil; e = e.Next() {
+				status = append(status, e.Value.(*BPF).status(attachPoint, direction))
+			}
+		}
+	}
+	sort.SliceStable(status, func(i, j int) bool {
+		if status[i].AttachPoint != status[j].AttachPoint {
+			return status[i].AttachPoint < status[j].AttachPoint
+		}
+		return status[i].Direction < status[j].Direction
+	})
+	return status
+}
+
+// ProgramLogs returns the last lines of the captured output of the user programs with the name,
+// optionally only the program attached to the attach point or direction
+func (c *NFConfigs) ProgramLogs(name, attachPoint, direction string, lines int) ([]models.BPFProgramLog, error) {
+	logs := make([]models.BPFProgramLog, 0)
+	for dir, bpfLists := range c.directionBpfLists() {
+		if len(direction) > 0 && dir != direction {
+			continue
+		}
+		for ap, bpfList := range bpfLists {
+			if bpfList == nil || (len(attachPoint) > 0 && ap != attachPoint) {
+				continue
+			}
+			for e := bpfList.Front(); e != nil; e = e.Next() {
+				bpf := e.Value.(*BPF)
+				if bpf.Program.Name != name || bpf.logs == nil {
+					continue
+				}
+				tail, err := bpf.logs.tail(lines)
+				if err != nil {
+					return nil, err
+				}
+				for i := range tail {
+					tail[i] = bpf.redact(tail[i])
+				}
+				if tail == nil {
+					tail = []string{}
+				}
+				logs = append(logs, models.BPFProgramLog{Name: name, AttachPoint: ap, Direction: dir, Lines: tail})
+			}
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].AttachPoint != logs[j].AttachPoint {
+			return logs[i].AttachPoint < logs[j].AttachPoint
+		}
+		return logs[i].Direction < logs[j].Direction
+	})
+	return logs, nil
+}
+
 // RemoveMissingNetIfacesNBPFProgsInConfig - Stops running eBPF programs which are missing in the config
 func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models.L3afBPFPrograms) error {
 
@@ -996,7 +1252,7 @@ func (c *NFConfigs) AddAndStartBPF(bpfProg *models.BPFProgram, ifaceName string,
 	for e := bpfList.Front(); e != nil; e = e.Next() {
 		data := e.Value.(*BPF)
 		if data.Program.SeqID > bpfProg.SeqID {
-			bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig)
+			bpf := c.newBPF(bpfProg)
 			tmpBPF := bpfList.InsertBefore(bpf, e)
 			if err := c.DownloadAndStartBPFProgram(tmpBPF, ifaceName, direction); err != nil {
 				return fmt.Errorf("failed to download and start eBPF program %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
@@ -1169,6 +1425,26 @@ func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs
 // AddeBPFPrograms - Starts eBPF programs on the node if they are not running
 func (c *NFConfigs) AddeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error {
 	for _, bpfProg := range bpfProgs {
+		if len(bpfProg.CgroupPath) > 0 {
+			if err := c.AddProgramsOnCgroup(bpfProg.CgroupPath, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
+				if err := c.SaveConfigsToConfigStore(); err != nil {
+					return fmt.Errorf("add eBPF Programs failed to save configs %v", err)
+				}
+				return fmt.Errorf("failed to Add BPF program on cgroup %s with error: %v", bpfProg.CgroupPath, err)
+			}
+			c.cgroups[bpfProg.CgroupPath] = bpfProg.CgroupPath
+			continue
+		}
+		if len(bpfProg.AttachTarget) > 0 {
+			if err := c.AddTracingPrograms(bpfProg.AttachTarget, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
+				if err := c.SaveConfigsToConfigStore(); err != nil {
+					return fmt.Errorf("add eBPF Programs failed to save configs %v", err)
+				}
+				return fmt.Errorf("failed to Add BPF program on attach target %s with error: %v", bpfProg.AttachTarget, err)
+			}
+			c.tracingTargets[bpfProg.AttachTarget] = bpfProg.AttachTarget
+			continue
+		}
 		if err := c.AddProgramsOnInterface(bpfProg.Iface, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
 			if err := c.SaveConfigsToConfigStore(); err != nil {
 				return fmt.Errorf("add eBPF Programs failed to save configs %v", err)
@@ -1180,6 +1456,7 @@ func (c *NFConfigs) AddeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error {
 	if err := c.SaveConfigsToConfigStore(); err != nil {
 		return fmt.Errorf("AddeBPFPrograms failed to save configs %v", err)
 	}
+	c.CollectArtifacts()
 	return nil
 }
 
@@ -1203,6 +1480,9 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 		return errOut
 	}
 
+	// The programs may be starting, holding the lock until they are up
+	c.waits.abort(ifaceName, ifaceProgramNames(bpfProgs))
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -1264,6 +1544,28 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 	return nil
 }
 
+// ifaceProgramNames returns the names of the programs of the interface by direction
+func ifaceProgramNames(bpfProgs *models.BPFProgramNames) map[string][]string {
+	return map[string][]string{
+		models.XDPIngressType: bpfProgs.XDPIngress,
+		models.IngressType:    bpfProgs.TCIngress,
+		models.EgressType:     bpfProgs.TCEgress,
+	}
+}
+
+// disabledProgramNames returns the names of the disabled programs of the config by direction
+func disabledProgramNames(bpfProgs map[string][]*models.BPFProgram) map[string][]string {
+	names := make(map[string][]string, len(bpfProgs))
+	for direction, progs := range bpfProgs {
+		for _, bpfProg := range progs {
+			if bpfProg.AdminStatus == models.Disabled {
+				names[direction] = append(names[direction], bpfProg.Name)
+			}
+		}
+	}
+	return names
+}
+
 // DeleteProgramsOnInterfaceHelper : helper function for DeleteProgramsOnInterface function
 func (c *NFConfigs) DeleteProgramsOnInterfaceHelper(e *list.Element, ifaceName string, direction string, bpfList *list.List) error {
 	if e == nil {
@@ -1301,6 +1603,30 @@ func (c *NFConfigs) DeleteProgramsOnInterfaceHelper(e *list.Element, ifaceName s
 // DeleteEbpfPrograms - Delete eBPF programs on the node if they are running
 func (c *NFConfigs) DeleteEbpfPrograms(bpfProgs []models.L3afBPFProgramNames) error {
 	for _, bpfProg := range bpfProgs {
+		if len(bpfProg.CgroupPath) > 0 {
+			if err := c.DeleteProgramsOnCgroup(bpfProg.CgroupPath, bpfProg.HostName, bpfProg.BpfProgramNames); err != nil {
+				if err := c.SaveConfigsToConfigStore(); err != nil {
+					return fmt.Errorf("SaveConfigsToConfigStore failed to save configs %v", err)
+				}
+				return fmt.Errorf("failed to Remove eBPF program on cgroup %s with error: %v", bpfProg.CgroupPath, err)
+			}
+			if !c.hasUnchainedBPFs(bpfProg.CgroupPath, cgroupHooks) {
+				delete(c.cgroups, bpfProg.CgroupPath)
+			}
+			continue
+		}
+		if len(bpfProg.AttachTarget) > 0 {
+			if err := c.DeleteTracingPrograms(bpfProg.AttachTarget, bpfProg.HostName, bpfProg.BpfProgramNames); err != nil {
+				if err := c.SaveConfigsToConfigStore(); err != nil {
+					return fmt.Errorf("SaveConfigsToConfigStore failed to save configs %v", err)
+				}
+				return fmt.Errorf("failed to Remove eBPF program on attach target %s with error: %v", bpfProg.AttachTarget, err)
+			}
+			if !c.hasUnchainedBPFs(bpfProg.AttachTarget, tracingHooks) {
+				delete(c.tracingTargets, bpfProg.AttachTarget)
+			}
+			continue
+		}
 		if err := c.DeleteProgramsOnInterface(bpfProg.Iface, bpfProg.HostName, bpfProg.BpfProgramNames); err != nil {
 			if err := c.SaveConfigsToConfigStore(); err != nil {
 				return fmt.Errorf("SaveConfigsToConfigStore failed to save configs %v", err)
@@ -1312,6 +1638,7 @@ func (c *NFConfigs) DeleteEbpfPrograms(bpfProgs []models.L3afBPFProgramNames) er
 	if err := c.SaveConfigsToConfigStore(); err != nil {
 		return fmt.Errorf("DeleteEbpfPrograms failed to save configs %v", err)
 	}
+	c.CollectArtifacts()
 	return nil
 }
 
@@ -1332,3 +1659,68 @@ func BinarySearch(names []string, target string) bool {
 	}
 	return false
 }
+
+// inUseArtifacts returns the package versions of the BPF programs on all interfaces, the caller must hold c.mu
+func (c *NFConfigs) inUseArtifacts() map[string]bool {
+	inUse := make(map[string]bool)
+	for _, bpfLists := range c.allBpfLists() {
+		for _, bpfList := range bpfLists {
+			if bpfList == nil {
+				continue
+			}
+			for e := bpfList.Front(); e != nil; e = e.Next() {
+				bpf := e.Value.(*BPF)
+				inUse[artifactKey(bpf.Program.Name, bpf.Program.Version)] = true
+			}
+		}
+	}
+	return inUse
+}
+
+// CollectArtifacts evicts the unused package versions from the artifact cache
+func (c *NFConfigs) CollectArtifacts() {
+	if c.artifactCache == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	inUse := c.inUseArtifacts()
+	if c.prefetcher != nil {
+		c.prefetcher.inFlight(inUse)
+	}
+	if err := c.artifactCache.GC(inUse); err != nil {
+		log.Warn().Err(err).Msg("artifact cache garbage collection failed")
+	}
+}
+
+// ArtifactCacheEntries returns the contents of the artifact cache
+func (c *NFConfigs) ArtifactCacheEntries() ([]models.ArtifactCacheEntry, error) {
+	if c.artifactCache == nil {
+		return []models.ArtifactCacheEntry{}, nil
+	}
+	c.mu.Lock()
+	inUse := c.inUseArtifacts()
+	c.mu.Unlock()
+	return c.artifactCache.Entries(inUse)
+}
+
+// PrefetchArtifacts downloads the eBPF packages in the background ahead of their deployment
+func (c *NFConfigs) PrefetchArtifacts(refs []models.ArtifactRef) ([]models.ArtifactPrefetchStatus, error) {
+	if c.prefetcher == nil {
+		return nil, fmt.Errorf("artifact prefetch is not configured")
+	}
+	return c.prefetcher.Prefetch(refs)
+}
+
+// PrefetchStatus returns the status of the prefetched eBPF packages
+func (c *NFConfigs) PrefetchStatus() []models.ArtifactPrefetchStatus {
+	if c.prefetcher == nil {
+		return []models.ArtifactPrefetchStatus{}
+	}
+	return c.prefetcher.Status()
+}
+
+// Platform returns the platform resolution of the node used to fetch eBPF packages
+func (c *NFConfigs) Platform() (models.Platform, error) {
+	return ResolvePlatform(c.HostConfig)
+}
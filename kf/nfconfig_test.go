@@ -156,10 +156,15 @@ func TestNewNFConfigs(t *testing.T) {
 				IngressXDPBpfs: ingressXDPBpfs,
 				IngressTCBpfs:  ingressTCBpfs,
 				EgressTCBpfs:   egressTCBpfs,
+				CgroupBpfs:     newCgroupBpfs(),
+				TracingBpfs:    newTracingBpfs(),
 				HostConfig:     nil,
 				processMon:     pMon,
 				kfMetricsMon:   mMon,
+				cgroups:        map[string]string{},
+				tracingTargets: map[string]string{},
 				mu:             new(sync.Mutex),
+				waits:          newWaitRegistry(),
 			},
 			wantErr: false,
 		},
@@ -1076,3 +1081,20 @@ func TestAddProgramWithoutChaining(t *testing.T) {
 		})
 	}
 }
+
+func TestNFConfigs_releaseNativePrograms(t *testing.T) {
+	xdpList := list.New()
+	xdpList.PushBack(&BPF{Program: models.BPFProgram{Name: "xdp-root", ObjectFile: "xdp_root_kern.o"}})
+	xdpList.PushBack(&BPF{Program: models.BPFProgram{Name: "ratelimiting", CmdStart: "ratelimiting"}})
+	xdpList.PushBack(&BPF{Program: models.BPFProgram{Name: "connection-limit", Artifact: "connection_limit.o"}})
+	cfg := &NFConfigs{
+		IngressXDPBpfs: map[string]*list.List{"fakeif0": xdpList},
+		IngressTCBpfs:  map[string]*list.List{"fakeif0": nil},
+		EgressTCBpfs:   map[string]*list.List{},
+	}
+
+	cfg.releaseNativePrograms()
+	if xdpList.Len() != 1 || xdpList.Front().Value.(*BPF).Program.Name != "ratelimiting" {
+		t.Errorf("releaseNativePrograms() left %d programs, want the user program only", xdpList.Len())
+	}
+}
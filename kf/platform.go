@@ -0,0 +1,147 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// genericPlatform is the platform directory of artifacts built for any distribution
+const genericPlatform = "generic"
+
+// osReleasePaths are the locations of the os-release file, see os-release(5)
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// osReleaseKeys are the os-release fields reported by the platform API
+var osReleaseKeys = []string{"ID", "ID_LIKE", "VERSION_ID", "VERSION_CODENAME"}
+
+// ResolvePlatform returns the platform directories of the eBPF package repository to try in order.
+// The platform configured in l3afd.cfg overrides the detection, otherwise the directories are
+// derived from the os-release of the node and end with the generic platform.
+func ResolvePlatform(conf *config.Config) (models.Platform, error) {
+	if conf != nil && len(conf.Platforms) > 0 {
+		for _, platform := range conf.Platforms {
+			if !validPlatform(platform) {
+				return models.Platform{}, fmt.Errorf("invalid platform %q configured", platform)
+			}
+		}
+		return models.Platform{
+			Platform:   conf.Platforms[0],
+			Candidates: conf.Platforms,
+			Override:   true,
+		}, nil
+	}
+
+	osRelease, platforms, err := hostPlatforms()
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to detect platform, using %s platform", genericPlatform)
+		platforms = []string{genericPlatform}
+	}
+	return models.Platform{
+		Platform:   platforms[0],
+		Candidates: platforms,
+		OSRelease:  osRelease,
+	}, nil
+}
+
+// readOSRelease reads the os-release file of the node
+func readOSRelease() (map[string]string, error) {
+	for _, fPath := range osReleasePaths {
+		f, err := os.Open(fPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", fPath, err)
+		}
+		defer f.Close()
+		return parseOSRelease(f)
+	}
+	return nil, fmt.Errorf("os-release file is not found in %v", osReleasePaths)
+}
+
+// parseOSRelease parses the KEY=value assignments of an os-release file
+func parseOSRelease(r io.Reader) (map[string]string, error) {
+	osRelease := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		osRelease[strings.TrimSpace(key)] = unquoteOSReleaseValue(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read os-release: %v", err)
+	}
+	return osRelease, nil
+}
+
+// unquoteOSReleaseValue removes the shell quoting of an os-release value
+func unquoteOSReleaseValue(value string) string {
+	if len(value) < 2 || (value[0] != '"' && value[0] != '\'') || value[len(value)-1] != value[0] {
+		return value
+	}
+	quote := value[0]
+	value = value[1 : len(value)-1]
+	if quote == '\'' {
+		return value
+	}
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && strings.IndexByte("\"\\$`", value[i+1]) >= 0 {
+			i++
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
+
+// osReleasePlatforms returns the platform directories matching the os-release, most specific
+// first: the codename, the distribution, the distributions it derives from and generic.
+func osReleasePlatforms(osRelease map[string]string) []string {
+	codename := osRelease["VERSION_CODENAME"]
+	if len(codename) == 0 {
+		codename = osRelease["UBUNTU_CODENAME"]
+	}
+	candidates := append([]string{codename, osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+	candidates = append(candidates, genericPlatform)
+
+	var platforms []string
+	for _, platform := range candidates {
+		platform = strings.ToLower(platform)
+		if validPlatform(platform) && !containsString(platforms, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// osReleaseFields returns the os-release fields reported by the platform API
+func osReleaseFields(osRelease map[string]string) map[string]string {
+	fields := map[string]string{}
+	for _, key := range osReleaseKeys {
+		if value, ok := osRelease[key]; ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// validPlatform reports whether the platform is usable as a directory of the repository
+func validPlatform(platform string) bool {
+	return len(platform) > 0 && platform != "." && platform != ".." && !strings.ContainsAny(platform, `/\`)
+}
@@ -0,0 +1,142 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_osReleasePlatforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		osRelease string
+		want      []string
+	}{
+		{
+			name: "Ubuntu",
+			osRelease: `NAME="Ubuntu"
+VERSION="20.04.6 LTS (Focal Fossa)"
+ID=ubuntu
+ID_LIKE=debian
+VERSION_ID="20.04"
+VERSION_CODENAME=focal
+UBUNTU_CODENAME=focal`,
+			want: []string{"focal", "ubuntu", "debian", "generic"},
+		},
+		{
+			name: "Rocky",
+			osRelease: `# comment
+NAME="Rocky Linux"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.2"`,
+			want: []string{"rocky", "rhel", "centos", "fedora", "generic"},
+		},
+		{
+			name:      "UbuntuCodenameOnly",
+			osRelease: `ID='ubuntu'` + "\n" + `UBUNTU_CODENAME="jammy"`,
+			want:      []string{"jammy", "ubuntu", "generic"},
+		},
+		{
+			name:      "InvalidID",
+			osRelease: `ID="../etc"`,
+			want:      []string{"generic"},
+		},
+		{
+			name: "Empty",
+			want: []string{"generic"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osRelease, err := parseOSRelease(strings.NewReader(tt.osRelease))
+			if err != nil {
+				t.Fatalf("parseOSRelease() error = %v", err)
+			}
+			if got := osReleasePlatforms(osRelease); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("osReleasePlatforms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_unquoteOSReleaseValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: `focal`, want: `focal`},
+		{value: `"Ubuntu 20.04"`, want: `Ubuntu 20.04`},
+		{value: `'single $quoted'`, want: `single $quoted`},
+		{value: `"escaped \"quote\" \$HOME"`, want: `escaped "quote" $HOME`},
+		{value: `"unterminated`, want: `"unterminated`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := unquoteOSReleaseValue(tt.value); got != tt.want {
+				t.Errorf("unquoteOSReleaseValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePlatform(t *testing.T) {
+	got, err := ResolvePlatform(&config.Config{Platforms: []string{"focal", "generic"}})
+	if err != nil {
+		t.Fatalf("ResolvePlatform() error = %v", err)
+	}
+	want := models.Platform{Platform: "focal", Candidates: []string{"focal", "generic"}, Override: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolvePlatform() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ResolvePlatform(&config.Config{Platforms: []string{"focal/../.."}}); err == nil {
+		t.Errorf("ResolvePlatform() accepted an invalid platform")
+	}
+
+	got, err = ResolvePlatform(nil)
+	if err != nil {
+		t.Fatalf("ResolvePlatform() error = %v", err)
+	}
+	if len(got.Candidates) == 0 || got.Candidates[len(got.Candidates)-1] != genericPlatform {
+		t.Errorf("ResolvePlatform() candidates = %v, want generic platform last", got.Candidates)
+	}
+}
+
+func TestBPF_GetArtifactsPlatformFallback(t *testing.T) {
+	repoDir := t.TempDir()
+	genericDir := filepath.Join(repoDir, "foo", "1.0", genericPlatform)
+	if err := os.MkdirAll(genericDir, 0755); err != nil {
+		t.Fatalf("failed to create repository %v", err)
+	}
+	writeTestTarGz(t, genericDir, []testArchiveEntry{
+		{name: "foo/foo", typeflag: tar.TypeReg, body: "userspace program"},
+	}).Close()
+
+	conf := &config.Config{
+		BPFDir:      t.TempDir(),
+		EBPFRepoURL: "file://" + repoDir,
+		Platforms:   []string{"focal", "ubuntu", genericPlatform},
+	}
+	b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0", Artifact: "foo.tar.gz"}}
+	if err := b.GetArtifacts(conf); err != nil {
+		t.Fatalf("GetArtifacts() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.FilePath, "foo")); err != nil {
+		t.Errorf("GetArtifacts() missing extracted file %v", err)
+	}
+
+	conf.Platforms = []string{"focal"}
+	if err := b.GetArtifacts(conf); err == nil {
+		t.Errorf("GetArtifacts() succeeded without an artifact for the platform")
+	}
+}
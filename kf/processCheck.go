@@ -6,6 +6,7 @@ package kf
 
 import (
 	"container/list"
+	"sync"
 	"time"
 
 	"github.com/l3af-project/l3afd/models"
@@ -18,6 +19,13 @@ type pCheck struct {
 	MaxRetryCount     int
 	Chain             bool
 	retryMonitorDelay time.Duration
+	exits             chan *processExitEvent // unexpected exits of daemon user programs
+	restartMu         sync.Mutex             // serializes restarts of the monitor and exit workers
+	backoff           time.Duration          // wait time before the second restart, doubled on every following restart
+	maxBackoff        time.Duration
+	successWindow     time.Duration  // programs running for the window get their restart count reset
+	budget            *restartBudget // host-wide restarts
+	configs           *NFConfigs     // restarts run under its lock, serialized with the API updates
 }
 
 func NewpCheck(rc int, chain bool, interval time.Duration) *pCheck {
@@ -29,13 +37,21 @@ func NewpCheck(rc int, chain bool, interval time.Duration) *pCheck {
 	return c
 }
 
-func (c *pCheck) pCheckStart(xdpProgs, ingressTCProgs, egressTCProgs map[string]*list.List) {
-	go c.pMonitorWorker(xdpProgs, models.XDPIngressType)
-	go c.pMonitorWorker(ingressTCProgs, models.IngressType)
-	go c.pMonitorWorker(egressTCProgs, models.EgressType)
+func (c *pCheck) pCheckStart(xdpProgs, ingressTCProgs, egressTCProgs map[string]*list.List, hookProgs ...map[string]map[string]*list.List) {
+	c.exits = make(chan *processExitEvent, 16)
+	go c.pExitWorker()
+	go c.pMonitorWorker(xdpProgs, models.XDPIngressType, c.Chain)
+	go c.pMonitorWorker(ingressTCProgs, models.IngressType, c.Chain)
+	go c.pMonitorWorker(egressTCProgs, models.EgressType, c.Chain)
+	// cgroup and tracing programs are not chained
+	for _, progs := range hookProgs {
+		for direction, bpfProgs := range progs {
+			go c.pMonitorWorker(bpfProgs, direction, false)
+		}
+	}
 }
 
-func (c *pCheck) pMonitorWorker(bpfProgs map[string]*list.List, direction string) {
+func (c *pCheck) pMonitorWorker(bpfProgs map[string]*list.List, direction string, chain bool) {
 	for range time.NewTicker(c.retryMonitorDelay).C {
 		for ifaceName, bpfList := range bpfProgs {
 			if bpfList == nil { // no bpf programs are running
@@ -43,29 +59,78 @@ func (c *pCheck) pMonitorWorker(bpfProgs map[string]*list.List, direction string
 			}
 			for e := bpfList.Front(); e != nil; e = e.Next() {
 				bpf := e.Value.(*BPF)
-				if c.Chain && bpf.Program.SeqID == 0 { // do not monitor root program
+				bpf.rotateLogs()
+				if chain && bpf.Program.SeqID == 0 { // do not monitor root program
 					continue
 				}
 				if bpf.Program.AdminStatus == models.Disabled {
 					continue
 				}
+				// exits of daemons are handled by pExitWorker, polling is left to status commands
+				if bpf.exitWatched() {
+					if bpf.watch.exited() != nil && bpf.watch.isQueued() {
+						continue
+					}
+					if len(bpf.Program.CmdStatus) <= 1 {
+						stats.SetWithVersion(1.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+						continue
+					}
+				}
 				isRunning, _ := bpf.isRunning()
 				if isRunning {
 					stats.SetWithVersion(1.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
 					continue
 				}
-				// Not running trying to restart
-				if bpf.RestartCount < c.MaxRetryCount && bpf.Program.AdminStatus == models.Enabled {
-					bpf.RestartCount++
-					log.Warn().Msgf("pMonitor BPF Program is not running. Restart attempt: %d, program name: %s, iface: %s",
-						bpf.RestartCount, bpf.Program.Name, ifaceName)
-					if err := bpf.Start(ifaceName, direction, c.Chain); err != nil {
-						log.Error().Err(err).Msgf("pMonitor BPF Program start failed for program %s", bpf.Program.Name)
-					}
-				} else {
-					stats.SetWithVersion(0.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+				// Not running, restart according to the restart policy, retried on the next ticks
+				var exit *models.ProcessExit
+				if bpf.watch != nil {
+					exit = bpf.watch.exited()
 				}
+				c.restart(bpf, nil, ifaceName, direction, chain, exit)
 			}
 		}
 	}
 }
+
+// pExitWorker restarts the daemon user programs as soon as their watcher reports an unexpected exit,
+// according to their restart policy. Restarts are delayed by the backoff and the host restart budget.
+func (c *pCheck) pExitWorker() {
+	for ev := range c.exits {
+		ev.watch.setQueued(false)
+		if wait := c.restart(ev.bpf, ev.watch, ev.ifaceName, ev.direction, ev.chain, ev.exit); wait > 0 {
+			retry := ev
+			retry.watch.setQueued(true)
+			time.AfterFunc(wait, func() { queueExit(c.exits, retry) })
+		}
+	}
+}
+
+// restart applies the restart policy to the program under the lock of the configs, unless it was
+// removed meanwhile. The exit of the watch is reported, unless the program was stopped or already
+// restarted meanwhile.
+func (c *pCheck) restart(bpf *BPF, watch *processWatch, ifaceName, direction string, chain bool, exit *models.ProcessExit) time.Duration {
+	if c.configs != nil {
+		c.configs.mu.Lock()
+		defer c.configs.mu.Unlock()
+		if !c.configs.hasBPF(bpf, ifaceName, direction) {
+			log.Info().Msgf("pMonitor BPF Program %s was removed, not restarted", bpf.Program.Name)
+			return 0
+		}
+	}
+	// The process of the program is gone once its watcher reaped it
+	if bpf.watch != nil && bpf.watch.exited() != nil {
+		bpf.Cmd = nil
+	}
+	if watch != nil {
+		if bpf.watch != watch || watch.stopped() || watch.exited() == nil {
+			// stopped or already restarted meanwhile
+			return 0
+		}
+		bpf.LastExit = exit
+		if bpf.Program.AdminStatus != models.Enabled {
+			stats.SetWithVersion(0.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+			return 0
+		}
+	}
+	return c.tryRestart(bpf, ifaceName, direction, chain, exit)
+}
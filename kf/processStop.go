@@ -0,0 +1,168 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/stats"
+
+	"github.com/rs/zerolog/log"
+)
+
+// killTimeout bounds the wait for a user program to exit after SIGKILL
+const killTimeout = 5 * time.Second
+
+// stopGracePeriod returns the time given to the user program to exit once stopped
+func (b *BPF) stopGracePeriod() time.Duration {
+	if b.Program.StopGracePeriod > 0 {
+		return time.Duration(b.Program.StopGracePeriod) * time.Second
+	}
+	if b.hostConfig != nil {
+		return b.hostConfig.StopGracePeriod
+	}
+	return 0
+}
+
+// waitDone returns a channel closed once wait returns
+func waitDone(wait func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	return done
+}
+
+// abortStart kills the daemon which failed to start and removes its chaining entries. Its exit is
+// not reported, and its watcher removes its cgroup and secrets once it exited.
+func (b *BPF) abortStart(chain bool) {
+	b.watch.stop()
+	pid := b.Cmd.Process.Pid
+	if err := b.Cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Error().Err(err).Msgf("failed to kill process %d of bpf program %s", pid, b.Program.Name)
+	}
+	select {
+	case <-waitDone(func() { b.LastExit = b.watch.wait() }):
+	case <-time.After(killTimeout):
+		log.Error().Msgf("BPF program %s process %d did not exit after SIGKILL", b.Program.Name, pid)
+	}
+	b.removeChainingMap(chain)
+}
+
+// awaitExit waits for the user program asked to stop to exit. The program is killed once the stop
+// grace period expires, and its pinned chaining map is removed on its behalf.
+func (b *BPF) awaitExit(ifaceName, direction string, chain bool) {
+	done := waitDone(b.waitProcess)
+	grace := b.stopGracePeriod()
+	if grace <= 0 {
+		<-done
+		return
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	pid := b.Cmd.Process.Pid
+	log.Warn().Msgf("BPF program %s process %d did not exit within the stop grace period of %s, killing it", b.Program.Name, pid, grace)
+	if err := b.Cmd.Process.Kill(); err != nil {
+		log.Error().Err(err).Msgf("failed to kill process %d of bpf program %s", pid, b.Program.Name)
+	}
+	stats.Incr(stats.NFForcedKillCount, b.Program.Name, direction, ifaceName)
+	b.events.add(EventKilled, "process %d killed after the stop grace period of %s", pid, grace)
+
+	select {
+	case <-done:
+	case <-time.After(killTimeout):
+		log.Error().Msgf("BPF program %s process %d did not exit after SIGKILL", b.Program.Name, pid)
+	}
+	b.removeChainingMap(chain)
+}
+
+// terminateProcess terminates the user program and waits for it to exit. A user program which
+// exited already is not signaled, its watcher reaped it.
+func (b *BPF) terminateProcess(ifaceName, direction string, chain bool) error {
+	if b.Cmd == nil {
+		return nil
+	}
+	if b.watch == nil || b.watch.exited() == nil {
+		if err := b.ProcessTerminate(); err != nil {
+			return fmt.Errorf("BPFProgram %s process terminate failed with error: %v", b.Program.Name, err)
+		}
+	}
+	b.awaitExit(ifaceName, direction, chain)
+	b.Cmd = nil
+	return nil
+}
+
+// awaitStop waits for the daemon stopped by its stop command to exit. Adopted daemons are not
+// watched, their process is polled until it exits, they are killed once the stop grace period expires.
+func (b *BPF) awaitStop(ifaceName, direction string, chain bool) {
+	if b.Cmd != nil && b.Cmd.Process != nil && (b.watch != nil || b.adopted != nil) {
+		b.awaitExit(ifaceName, direction, chain)
+	}
+	b.Cmd = nil
+}
+
+// runStopCommand runs the stop command of the program, killed once the stop grace period expires
+func (b *BPF) runStopCommand(prog *exec.Cmd, ifaceName, direction string) error {
+	if err := prog.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- prog.Wait() }()
+
+	grace := b.stopGracePeriod()
+	if grace <= 0 {
+		return <-done
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	log.Warn().Msgf("stop command %s of bpf program %s did not complete within the stop grace period of %s, killing it", b.Program.CmdStop, b.Program.Name, grace)
+	if err := prog.Process.Kill(); err != nil {
+		log.Error().Err(err).Msgf("failed to kill stop command of bpf program %s", b.Program.Name)
+	}
+	stats.Incr(stats.NFForcedKillCount, b.Program.Name, direction, ifaceName)
+	b.events.add(EventKilled, "stop command %s killed after the stop grace period of %s", b.Program.CmdStop, grace)
+	return <-done
+}
+
+// removeChainingMap removes the chaining entries left behind by a killed user program. Its entry in
+// the chaining map of the previous program is deleted, so that the chain no longer runs its kernel
+// program. Its own pinned chaining map is removed for XDP programs only, TC programs do not remove
+// it on exit either (see VerifyPinnedMapVanish) and the next start reuses it.
+func (b *BPF) removeChainingMap(chain bool) {
+	if !chain {
+		return
+	}
+	if len(b.PrevMapNamePath) > 0 {
+		if err := b.RemovePrevProgFD(); err != nil {
+			log.Warn().Err(err).Msgf("failed to remove the chaining entry of bpf program %s", b.Program.Name)
+		}
+	}
+	if len(b.Program.MapName) <= 0 || b.Program.ProgType != models.XDPType {
+		return
+	}
+	if err := os.Remove(b.MapNamePath); err == nil {
+		log.Info().Msgf("removed pinned map %s left by bpf program %s", b.MapNamePath, b.Program.Name)
+	} else if !os.IsNotExist(err) {
+		log.Error().Err(err).Msgf("failed to remove pinned map %s left by bpf program %s", b.MapNamePath, b.Program.Name)
+	}
+}
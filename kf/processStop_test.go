@@ -0,0 +1,204 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_stopGracePeriod(t *testing.T) {
+	tests := []struct {
+		name       string
+		seconds    int
+		hostConfig *config.Config
+		want       time.Duration
+	}{
+		{name: "NoConfig"},
+		{name: "HostDefault", hostConfig: &config.Config{StopGracePeriod: 5 * time.Second}, want: 5 * time.Second},
+		{name: "Program", seconds: 30, hostConfig: &config.Config{StopGracePeriod: 5 * time.Second}, want: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: models.BPFProgram{StopGracePeriod: tt.seconds}, hostConfig: tt.hostConfig}
+			if got := b.stopGracePeriod(); got != tt.want {
+				t.Errorf("stopGracePeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_awaitExit(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperDaemon", "--")
+	cmd.Env = []string{"GO_WANT_HELPER_DAEMON=1"}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("StdinPipe() error = %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", UserProgramDaemon: true},
+		Cmd:        cmd,
+		hostConfig: &config.Config{StopGracePeriod: 10 * time.Second},
+	}
+	b.watchProcess("eth0", models.XDPIngressType, true)
+	b.watch.stop()
+	stdin.Close()
+
+	b.awaitExit("eth0", models.XDPIngressType, true)
+	if b.LastExit == nil || b.LastExit.ExitCode != daemonExitStatus {
+		t.Errorf("LastExit = %+v, want exit code %d", b.LastExit, daemonExitStatus)
+	}
+	if events := b.events.list(); len(events) != 0 {
+		t.Errorf("events = %+v, want none", events)
+	}
+}
+
+func TestBPF_abortStart(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperDaemon", "--")
+	cmd.Env = []string{"GO_WANT_HELPER_DAEMON=1"}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("StdinPipe() error = %v", err)
+	}
+	defer stdin.Close()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	exits := make(chan *processExitEvent, 1)
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", UserProgramDaemon: true},
+		Cmd:        cmd,
+		exits:      exits,
+		hostConfig: &config.Config{},
+	}
+	b.watchProcess("eth0", models.XDPIngressType, true)
+
+	b.abortStart(false)
+	if b.LastExit == nil || len(b.LastExit.Signal) == 0 {
+		t.Errorf("LastExit = %+v, want killed", b.LastExit)
+	}
+	if running, _ := b.isRunning(); running {
+		t.Errorf("isRunning() = true after abortStart()")
+	}
+	select {
+	case ev := <-exits:
+		t.Errorf("exit %+v of the aborted start reported", ev.exit)
+	default:
+	}
+}
+
+func TestBPF_terminateProcess(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperDaemon", "--")
+	cmd.Env = []string{"GO_WANT_HELPER_DAEMON=1"}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("StdinPipe() error = %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", UserProgramDaemon: true},
+		Cmd:        cmd,
+		hostConfig: &config.Config{StopGracePeriod: 10 * time.Second},
+	}
+	b.watchProcess("eth0", models.XDPIngressType, true)
+	if err := b.watch.arm(); err != nil {
+		t.Fatalf("arm() error = %v", err)
+	}
+	// the program crashed, its watcher reaped it
+	stdin.Close()
+	b.watch.wait()
+
+	if err := b.ProcessTerminate(); err != nil {
+		t.Errorf("ProcessTerminate() error = %v for an exited process", err)
+	}
+	b.watch.stop()
+	if err := b.terminateProcess("eth0", models.XDPIngressType, true); err != nil {
+		t.Fatalf("terminateProcess() error = %v", err)
+	}
+	if b.Cmd != nil {
+		t.Errorf("terminateProcess() left the command of the exited process")
+	}
+	if b.LastExit == nil || b.LastExit.ExitCode != daemonExitStatus {
+		t.Errorf("LastExit = %+v, want exit code %d", b.LastExit, daemonExitStatus)
+	}
+}
+
+func TestBPF_awaitStop(t *testing.T) {
+	executable, process := startExternalProcess(t)
+	startTime, err := processStartTime(process.Pid)
+	if err != nil {
+		t.Skipf("process start time not available: %v", err)
+	}
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", UserProgramDaemon: true},
+		Cmd:        &exec.Cmd{Path: executable, Process: process},
+		hostConfig: &config.Config{StopGracePeriod: 10 * time.Second},
+		adopted:    &programState{Name: "foo", Executable: executable, Pid: process.Pid, StartTime: startTime},
+	}
+	// the stop command stops the adopted process after a while
+	time.AfterFunc(200*time.Millisecond, func() { _ = process.Kill() })
+
+	start := time.Now()
+	b.awaitStop("eth0", models.XDPIngressType, false)
+	if externalRunning(process.Pid, executable) {
+		t.Errorf("awaitStop() returned while the adopted process %d runs", process.Pid)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed >= 10*time.Second {
+		t.Errorf("awaitStop() returned after %s", elapsed)
+	}
+	if b.Cmd != nil {
+		t.Errorf("awaitStop() left the command of the stopped process")
+	}
+}
+
+func TestBPF_removeChainingMap(t *testing.T) {
+	pin := filepath.Join(t.TempDir(), "foo_next_prog_array")
+	if err := os.WriteFile(pin, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	b := &BPF{Program: models.BPFProgram{Name: "foo", MapName: "foo_next_prog_array", ProgType: models.XDPType}, MapNamePath: pin}
+
+	b.removeChainingMap(false)
+	if _, err := os.Stat(pin); err != nil {
+		t.Errorf("pinned map of unchained program removed: %v", err)
+	}
+	b.Program.ProgType = models.TCType
+	b.removeChainingMap(true)
+	if _, err := os.Stat(pin); err != nil {
+		t.Errorf("pinned map of TC program removed: %v", err)
+	}
+	b.Program.ProgType = models.XDPType
+	b.removeChainingMap(true)
+	if _, err := os.Stat(pin); !os.IsNotExist(err) {
+		t.Errorf("pinned map not removed: %v", err)
+	}
+}
+
+func TestEventHistory(t *testing.T) {
+	var h eventHistory
+	if events := h.list(); events != nil {
+		t.Errorf("list() = %+v, want nil", events)
+	}
+	for i := 0; i < maxProgramEvents+2; i++ {
+		h.add(EventRestarted, "restart attempt %d", i)
+	}
+	events := h.list()
+	if len(events) != maxProgramEvents {
+		t.Fatalf("list() = %d events, want %d", len(events), maxProgramEvents)
+	}
+	if events[0].Message != "restart attempt 2" || events[maxProgramEvents-1].Message != "restart attempt 33" {
+		t.Errorf("list() = %s ... %s, want the most recent events", events[0].Message, events[maxProgramEvents-1].Message)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package kf provides primitives for NF process monitoring.
+package kf
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// exitString describes how the user program exited
+func exitString(e *models.ProcessExit) string {
+	if len(e.Signal) > 0 {
+		return fmt.Sprintf("process %d terminated by signal %s", e.Pid, e.Signal)
+	}
+	return fmt.Sprintf("process %d exited with code %d", e.Pid, e.ExitCode)
+}
+
+// exitFailed reports whether the user program failed, that is exited with a non-zero code or was
+// terminated by a signal. Programs found not running by their status command have no exit and failed.
+func exitFailed(e *models.ProcessExit) bool {
+	return e == nil || e.ExitCode != 0 || len(e.Signal) > 0
+}
+
+// processExitEvent is sent to the process monitor when a user program exits unexpectedly
+type processExitEvent struct {
+	bpf       *BPF
+	watch     *processWatch
+	ifaceName string
+	direction string
+	chain     bool
+	exit      *models.ProcessExit
+}
+
+// processWatch is the watcher of a daemon user program, blocked on Cmd.Wait until it exits
+type processWatch struct {
+	mu       sync.Mutex
+	done     chan struct{} // closed once the process exited
+	exit     *models.ProcessExit
+	armed    bool // start completed, exits are reported from now on
+	stopping bool // l3afd is stopping the program, the exit is expected
+	queued   bool // the exit is queued to the exit worker or its retry is scheduled
+}
+
+// watchProcess starts the watcher of the user program just started by Start. Exits are reported
+// on the exits channel once the watch is armed and unless the program is being stopped.
+func (b *BPF) watchProcess(ifaceName, direction string, chain bool) {
+	w := &processWatch{done: make(chan struct{})}
+	b.watch = w
+	cmd, exits := b.Cmd, b.exits
+
+	go func() {
+		err := cmd.Wait()
+		b.removeUserCgroup(ifaceName, direction)
+		b.removeSecrets(ifaceName, direction)
+		exit := &models.ProcessExit{Pid: cmd.Process.Pid, ExitCode: -1, Time: time.Now()}
+		if cmd.ProcessState != nil {
+			exit.ExitCode = cmd.ProcessState.ExitCode()
+			exit.Signal = exitSignal(cmd.ProcessState)
+		} else if err != nil {
+			log.Error().Err(err).Msgf("cmd wait of bpf program %s errored", b.Program.Name)
+		}
+
+		w.mu.Lock()
+		w.exit = exit
+		close(w.done)
+		report := w.armed && !w.stopping
+		w.mu.Unlock()
+
+		if !report {
+			log.Info().Msgf("BPF program %s user program %s", b.Program.Name, exitString(exit))
+			return
+		}
+		log.Warn().Msgf("BPF program %s user program %s unexpectedly, iface %s direction %s", b.Program.Name, exitString(exit), ifaceName, direction)
+		b.events.add(EventExited, "user program %s", exitString(exit))
+		if exits != nil {
+			queueExit(exits, &processExitEvent{bpf: b, watch: w, ifaceName: ifaceName, direction: direction, chain: chain, exit: exit})
+		}
+	}()
+}
+
+// queueExit reports the exit to the exit worker without blocking. When the queue is full the exit
+// is left to the process monitor, which restarts the programs whose exit is not queued.
+func queueExit(exits chan<- *processExitEvent, ev *processExitEvent) {
+	ev.watch.setQueued(true)
+	select {
+	case exits <- ev:
+	default:
+		ev.watch.setQueued(false)
+		log.Warn().Msgf("exit queue full, exit of BPF program %s left to the process monitor", ev.bpf.Program.Name)
+	}
+}
+
+// arm reports the exits of the watched process from now on, it fails if the process already exited
+func (w *processWatch) arm() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.exit != nil {
+		return fmt.Errorf("user program %s right after start", exitString(w.exit))
+	}
+	w.armed = true
+	return nil
+}
+
+// isArmed reports whether the exits of the watched process are reported
+func (w *processWatch) isArmed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.armed
+}
+
+// stop marks the exit of the watched process as expected
+func (w *processWatch) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopping = true
+}
+
+// setQueued records whether the exit is queued to the exit worker
+func (w *processWatch) setQueued(queued bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.queued = queued
+}
+
+// isQueued reports whether the exit is queued to the exit worker
+func (w *processWatch) isQueued() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.queued
+}
+
+// wait blocks until the watched process exited and returns how it exited
+func (w *processWatch) wait() *models.ProcessExit {
+	<-w.done
+	return w.exit
+}
+
+// exited returns how the watched process exited, nil while it is running
+func (w *processWatch) exited() *models.ProcessExit {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.exit
+}
+
+// stopped reports whether l3afd stopped the watched process
+func (w *processWatch) stopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stopping
+}
+
+// exitWatched reports whether the exits of the user program are reported by its watcher, that is
+// the daemon started successfully
+func (b *BPF) exitWatched() bool {
+	return b.watch != nil && b.watch.isArmed()
+}
+
+// waitProcess waits for the user program to exit after it was asked to terminate
+func (b *BPF) waitProcess() {
+	if b.adopted != nil {
+		// adopted processes are not children of l3afd, they are polled
+		for processMatches(b.adopted) {
+			time.Sleep(waitPollInterval)
+		}
+		return
+	}
+	if b.watch == nil {
+		if err := b.Cmd.Wait(); err != nil {
+			log.Error().Err(err).Msgf("cmd wait at stopping bpf program %s errored", b.Program.Name)
+		}
+		return
+	}
+	b.LastExit = b.watch.wait()
+}
@@ -0,0 +1,107 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+const daemonExitStatus = 3
+
+// TestHelperDaemon is a user program which echoes its stdin until it is closed
+func TestHelperDaemon(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_DAEMON") != "1" {
+		return
+	}
+	_, _ = io.Copy(os.Stdout, os.Stdin)
+	os.Exit(daemonExitStatus)
+}
+
+func TestBPF_watchProcess(t *testing.T) {
+	tests := []struct {
+		name       string
+		stop       bool
+		wantReport bool
+	}{
+		{name: "UnexpectedExit", wantReport: true},
+		{name: "Stopped", stop: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=TestHelperDaemon", "--")
+			cmd.Env = []string{"GO_WANT_HELPER_DAEMON=1"}
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatalf("StdinPipe() error = %v", err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			exits := make(chan *processExitEvent, 1)
+			b := &BPF{Program: models.BPFProgram{Name: "foo", UserProgramDaemon: true}, Cmd: cmd, exits: exits}
+			b.watchProcess("eth0", models.XDPIngressType, true)
+			if err := b.watch.arm(); err != nil {
+				t.Fatalf("arm() error = %v", err)
+			}
+			if !b.exitWatched() {
+				t.Errorf("exitWatched() = false, want true")
+			}
+			if tt.stop {
+				b.watch.stop()
+			}
+			stdin.Close()
+
+			exit := b.watch.wait()
+			if exit.ExitCode != daemonExitStatus || exit.Pid != cmd.Process.Pid {
+				t.Errorf("exit = %+v, want process %d exited with code %d", exit, cmd.Process.Pid, daemonExitStatus)
+			}
+			if running, _ := b.isRunning(); running {
+				t.Errorf("isRunning() = true after exit")
+			}
+			if err := b.watch.arm(); err == nil {
+				t.Errorf("arm() after exit succeeded, want error")
+			}
+
+			select {
+			case ev := <-exits:
+				if !tt.wantReport {
+					t.Errorf("exit %+v reported while stopping", ev.exit)
+				} else if ev.bpf != b || ev.watch != b.watch || ev.ifaceName != "eth0" || ev.exit != exit {
+					t.Errorf("exit event = %+v, want exit %+v of eth0", ev, exit)
+				} else if !ev.watch.isQueued() {
+					t.Errorf("isQueued() = false for a queued exit")
+				}
+			case <-time.After(time.Second):
+				if tt.wantReport {
+					t.Errorf("exit was not reported")
+				}
+			}
+		})
+	}
+}
+
+func TestQueueExit(t *testing.T) {
+	exits := make(chan *processExitEvent, 1)
+	b := &BPF{Program: models.BPFProgram{Name: "foo"}}
+	first := &processExitEvent{bpf: b, watch: &processWatch{}}
+	second := &processExitEvent{bpf: b, watch: &processWatch{}}
+
+	queueExit(exits, first)
+	queueExit(exits, second) // queue full, must not block
+	if !first.watch.isQueued() {
+		t.Errorf("isQueued() = false for the queued exit")
+	}
+	if second.watch.isQueued() {
+		t.Errorf("isQueued() = true for the exit left to the process monitor")
+	}
+	if ev := <-exits; ev != first {
+		t.Errorf("queued exit = %+v, want %+v", ev, first)
+	}
+}
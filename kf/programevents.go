@@ -0,0 +1,56 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+// maxProgramEvents bounds the events kept per program, the oldest are dropped first
+const maxProgramEvents = 32
+
+// Events of the life cycle of the programs
+const (
+	EventStarted   = "started"
+	EventStopped   = "stopped"
+	EventExited    = "exited" // the user program exited unexpectedly
+	EventRestarted = "restarted"
+	EventCrashLoop = "crash-loop"
+	EventKilled    = "killed" // the user program did not exit within its stop grace period
+)
+
+// eventHistory is the recent events of a program
+type eventHistory struct {
+	mu     sync.Mutex
+	events []models.BPFProgramEvent
+}
+
+// add records an event of the program
+func (h *eventHistory) add(event, format string, args ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.events) == maxProgramEvents {
+		copy(h.events, h.events[1:])
+		h.events = h.events[:maxProgramEvents-1]
+	}
+	h.events = append(h.events, models.BPFProgramEvent{Time: time.Now(), Event: event, Message: fmt.Sprintf(format, args...)})
+}
+
+// list returns a copy of the events, oldest first
+func (h *eventHistory) list() []models.BPFProgramEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.events) == 0 {
+		return nil
+	}
+	events := make([]models.BPFProgramEvent, len(h.events))
+	copy(events, h.events)
+	return events
+}
@@ -0,0 +1,240 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxTailBytes bounds the bytes read from the end of a log file to find its last lines
+const maxTailBytes = 1 << 20
+
+// programLog is the log file capturing the stdout and stderr of a user program. The user program
+// writes to the file through its own descriptor, so that its output is captured across the restarts
+// of l3afd. The file is rotated by copy and truncate once it reaches the max size, <path>.1 being the
+// most recent rotated file.
+type programLog struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64 // 0 means unlimited
+	maxFiles int   // rotated files kept
+}
+
+func newProgramLog(path string, maxSize int64, maxFiles int) *programLog {
+	return &programLog{path: path, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// programLogPath returns the log file of the user program attached to the attach point
+func programLogPath(logDir, name, attachPoint, direction string) string {
+	return filepath.Join(logDir, name, pinName(attachPoint)+"_"+direction+".log")
+}
+
+// open opens the log file to be appended to by the user program, rotated first once it reached
+// the max size
+func (l *programLog) open() (*os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.rotateFull(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory of %s: %v", l.path, err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file %s: %v", l.path, err)
+	}
+	return f, nil
+}
+
+// rotate rotates the log file once it reached the max size, it is called periodically while the
+// user program runs
+func (l *programLog) rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rotateFull()
+}
+
+// rotateFull shifts the rotated files, dropping the oldest one, copies the full log file to <path>.1
+// and truncates it. The user program keeps appending to the truncated file, the output written
+// during the copy is lost.
+func (l *programLog) rotateFull() error {
+	if l.maxSize <= 0 {
+		return nil
+	}
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat log file %s: %v", l.path, err)
+	}
+	if info.Size() < l.maxSize {
+		return nil
+	}
+
+	if l.maxFiles >= 1 {
+		for i := l.maxFiles - 1; i > 0; i-- {
+			if err := os.Rename(l.rotatedPath(i), l.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate log file %s: %v", l.rotatedPath(i), err)
+			}
+		}
+		if err := copyFile(l.path, l.rotatedPath(1)); err != nil {
+			return fmt.Errorf("failed to rotate log file %s: %v", l.path, err)
+		}
+	}
+	if err := os.Truncate(l.path, 0); err != nil {
+		return fmt.Errorf("failed to truncate log file %s: %v", l.path, err)
+	}
+	return nil
+}
+
+func (l *programLog) rotatedPath(i int) string {
+	return l.path + "." + strconv.Itoa(i)
+}
+
+// copyFile copies the content of the file src to the file dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// tail returns the last n lines of the log, continued from the most recent rotated file when the
+// current file is shorter
+func (l *programLog) tail(n int) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines, err := lastLines(l.path, n)
+	if err != nil || len(lines) >= n || l.maxFiles < 1 {
+		return lines, err
+	}
+	prev, err := lastLines(l.rotatedPath(1), n-len(lines))
+	return append(prev, lines...), err
+}
+
+// lastLines returns the last n lines of the file, none when the file does not exist
+func lastLines(path string, n int) ([]string, error) {
+	if n < 1 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open log file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat log file %s: %v", path, err)
+	}
+	offset := info.Size() - maxTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	buf, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log file %s: %v", path, err)
+	}
+
+	buf = bytes.TrimRight(buf, "\n")
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	lines := strings.Split(string(buf), "\n")
+	if offset > 0 {
+		// the first line is likely truncated
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// setLogs sets the log file of the user program attached to the attach point, it returns false
+// when the output of the user programs is not captured
+func (b *BPF) setLogs(ifaceName, direction string) bool {
+	if b.hostConfig == nil || len(b.hostConfig.BPFLogDir) <= 1 {
+		return false
+	}
+	path := programLogPath(b.hostConfig.BPFLogDir, b.Program.Name, ifaceName, direction)
+	if b.logs == nil || b.logs.path != path {
+		b.logs = newProgramLog(path, int64(b.hostConfig.BPFLogMaxSizeMB)<<20, b.hostConfig.BPFLogMaxFiles)
+	}
+	return true
+}
+
+// captureOutput sends the stdout and stderr of the user program to its log file under the log
+// directory, if any. It returns the log file to close once the user program started, the user
+// program gets a descriptor of the file rather than a pipe to l3afd, which would break once l3afd
+// restarts.
+func (b *BPF) captureOutput(ifaceName, direction string) *os.File {
+	if !b.setLogs(ifaceName, direction) {
+		return nil
+	}
+	output, err := b.logs.open()
+	if err != nil {
+		log.Warn().Err(err).Msgf("output of bpf program %s is not captured", b.Program.Name)
+		return nil
+	}
+	b.Cmd.Stdout = output
+	b.Cmd.Stderr = output
+	return output
+}
+
+// closeOutput closes the log file of l3afd once passed to the user program
+func (b *BPF) closeOutput(output *os.File) {
+	if output == nil {
+		return
+	}
+	if err := output.Close(); err != nil {
+		log.Warn().Err(err).Msgf("failed to close log file of bpf program %s", b.Program.Name)
+	}
+}
+
+// rotateLogs rotates the log file of the user program once it reached the max size
+func (b *BPF) rotateLogs() {
+	if b.logs == nil {
+		return
+	}
+	if err := b.logs.rotate(); err != nil {
+		log.Warn().Err(err).Msgf("failed to rotate log file of bpf program %s", b.Program.Name)
+	}
+}
+
+// withLogTail attaches the last output lines of the user program to the error
+func (b *BPF) withLogTail(err error) error {
+	if b.logs == nil || b.hostConfig.BPFLogTailLines < 1 {
+		return err
+	}
+	lines, tailErr := b.logs.tail(b.hostConfig.BPFLogTailLines)
+	if tailErr != nil || len(lines) == 0 {
+		return err
+	}
+	return fmt.Errorf("%v, last output of the program:\n%s", err, b.redact(strings.Join(lines, "\n")))
+}
@@ -0,0 +1,106 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_programLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimiting", "eth0_xdpingress.log")
+	l := newProgramLog(path, 16, 2)
+	f, err := l.open()
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	// the user program keeps appending to the file rotated while it runs
+	for i := 0; i < 9; i++ {
+		if _, err := fmt.Fprintf(f, "line %d\n", i); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if err := l.rotate(); err != nil {
+			t.Fatalf("rotate() error = %v", err)
+		}
+	}
+	fmt.Fprintf(f, "line 9\n")
+	f.Close()
+
+	// three lines per file, the oldest file is dropped
+	for file, want := range map[string]string{path: "line 9\n", path + ".1": "line 6\nline 7\nline 8\n", path + ".2": "line 3\nline 4\nline 5\n"} {
+		if got, err := os.ReadFile(file); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", file, got, err, want)
+		}
+	}
+
+	// the tail continues in the most recent rotated file only
+	tests := []struct {
+		lines int
+		want  []string
+	}{
+		{lines: 0},
+		{lines: 1, want: []string{"line 9"}},
+		{lines: 2, want: []string{"line 8", "line 9"}},
+		{lines: 4, want: []string{"line 6", "line 7", "line 8", "line 9"}},
+		{lines: 10, want: []string{"line 6", "line 7", "line 8", "line 9"}},
+	}
+	for _, tt := range tests {
+		if got, err := l.tail(tt.lines); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tail(%d) = %q, %v, want %q", tt.lines, got, err, tt.want)
+		}
+	}
+}
+
+func Test_lastLinesMissingFile(t *testing.T) {
+	if got, err := lastLines(filepath.Join(t.TempDir(), "missing.log"), 10); got != nil || err != nil {
+		t.Errorf("lastLines() = %q, %v, want no lines", got, err)
+	}
+}
+
+func TestBPF_withLogTail(t *testing.T) {
+	logDir := t.TempDir()
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "ratelimiting"},
+		hostConfig: &config.Config{BPFLogDir: logDir, BPFLogMaxSizeMB: 1, BPFLogTailLines: 2},
+		Cmd:        execCommand("ratelimiting"),
+	}
+	err := errors.New("bpf program ratelimiting failed to start")
+	if got := b.withLogTail(err); got != err {
+		t.Errorf("withLogTail() without captured output = %v, want %v", got, err)
+	}
+
+	output := b.captureOutput("eth0", models.XDPIngressType)
+	if output == nil || b.Cmd.Stdout != output || b.Cmd.Stderr != output {
+		t.Fatalf("captureOutput() did not capture stdout and stderr")
+	}
+	if b.logs.path != filepath.Join(logDir, "ratelimiting", "eth0_xdpingress.log") {
+		t.Errorf("captureOutput() log file = %s", b.logs.path)
+	}
+	fmt.Fprint(output, "loading\nfailed to attach\nexiting\n")
+	b.closeOutput(output)
+
+	got := b.withLogTail(err).Error()
+	if !strings.HasSuffix(got, "\nfailed to attach\nexiting") || !strings.HasPrefix(got, err.Error()) {
+		t.Errorf("withLogTail() = %q", got)
+	}
+
+	c := &NFConfigs{IngressXDPBpfs: map[string]*list.List{"eth0": list.New()}}
+	c.IngressXDPBpfs["eth0"].PushBack(b)
+	want := []models.BPFProgramLog{{Name: "ratelimiting", AttachPoint: "eth0", Direction: models.XDPIngressType, Lines: []string{"exiting"}}}
+	if logs, err := c.ProgramLogs("ratelimiting", "", "", 1); err != nil || !reflect.DeepEqual(logs, want) {
+		t.Errorf("ProgramLogs() = %+v, %v, want %+v", logs, err, want)
+	}
+	if logs, _ := c.ProgramLogs("ratelimiting", "eth1", "", 1); len(logs) != 0 {
+		t.Errorf("ProgramLogs() of other attach point = %+v", logs)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// programState is the state file of a running user program, the next l3afd instance adopts the
+// process it describes instead of killing and restarting it
+type programState struct {
+	Name            string   `json:"name"`
+	Version         string   `json:"version"`
+	AttachPoint     string   `json:"attach_point"`
+	Direction       string   `json:"direction"`
+	Executable      string   `json:"executable"`
+	Args            []string `json:"args"`
+	Pid             int      `json:"pid"`
+	StartTime       uint64   `json:"start_time"` // start time of the process in clock ticks since boot
+	ProgID          int      `json:"prog_id"`
+	MapNamePath     string   `json:"map_name_path"`
+	PrevMapNamePath string   `json:"prev_map_name_path"`
+}
+
+// statePath returns the state file of the user program attached to the attach point, empty when
+// user programs are not adopted
+func (b *BPF) statePath(ifaceName, direction string) string {
+	if b.hostConfig == nil || len(b.hostConfig.BPFStateDir) == 0 {
+		return ""
+	}
+	return filepath.Join(b.hostConfig.BPFStateDir, b.Program.Name, pinName(ifaceName)+"_"+direction+".json")
+}
+
+// saveState writes the state file of the started user program
+func (b *BPF) saveState(ifaceName, direction string, args []string) error {
+	path := b.statePath(ifaceName, direction)
+	if len(path) == 0 || b.Cmd == nil || b.Cmd.Process == nil {
+		return nil
+	}
+	startTime, err := processStartTime(b.Cmd.Process.Pid)
+	if err != nil {
+		return err
+	}
+	state := programState{
+		Name:            b.Program.Name,
+		Version:         b.Program.Version,
+		AttachPoint:     ifaceName,
+		Direction:       direction,
+		Executable:      filepath.Join(b.FilePath, b.Program.CmdStart),
+		Args:            args,
+		Pid:             b.Cmd.Process.Pid,
+		StartTime:       startTime,
+		ProgID:          b.ProgID,
+		MapNamePath:     b.MapNamePath,
+		PrevMapNamePath: b.PrevMapNamePath,
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state of program %s: %v", b.Program.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create state directory of program %s: %v", b.Program.Name, err)
+	}
+	// written aside and renamed, the state file is never seen half written
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return fmt.Errorf("failed to write state file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state file %s: %v", path, err)
+	}
+	return nil
+}
+
+// removeState removes the state file of the stopped user program
+func (b *BPF) removeState(ifaceName, direction string) {
+	path := b.statePath(ifaceName, direction)
+	if len(path) == 0 {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msgf("failed to remove state file %s", path)
+	}
+}
+
+func readProgramState(path string) (*programState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &programState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// processMatches reports whether the process of the state is running, that is a process with the
+// same pid, start time and executable. Pids reused by other processes do not match.
+func processMatches(state *programState) bool {
+	startTime, err := processStartTime(state.Pid)
+	if err != nil || startTime != state.StartTime {
+		return false
+	}
+	executable, err := processExecutable(state.Pid)
+	return err == nil && executable == state.Executable
+}
+
+// livePids returns the pids of the running user programs recorded in state files. They are adopted
+// by this l3afd instance, which keeps their state files, or are left to be adopted on their attach point.
+func (b *BPF) livePids() map[int]bool {
+	pids := make(map[int]bool)
+	if b.hostConfig == nil || len(b.hostConfig.BPFStateDir) == 0 {
+		return pids
+	}
+	paths, err := filepath.Glob(filepath.Join(b.hostConfig.BPFStateDir, "*", "*.json"))
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to list state files in %s", b.hostConfig.BPFStateDir)
+		return pids
+	}
+	for _, path := range paths {
+		if state, err := readProgramState(path); err == nil && processMatches(state) {
+			pids[state.Pid] = true
+		}
+	}
+	return pids
+}
+
+// sameArgs reports whether the args are the same regardless of their order
+func sameArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// liveState returns the state of the user program left running by the previous l3afd instance,
+// nil if there is none
+func (b *BPF) liveState(ifaceName, direction string) *programState {
+	path := b.statePath(ifaceName, direction)
+	if len(path) == 0 || !b.Program.UserProgramDaemon {
+		return nil
+	}
+	state, err := readProgramState(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn().Err(err).Msgf("ignoring state of program %s", b.Program.Name)
+		}
+		return nil
+	}
+	if !processMatches(state) {
+		log.Info().Msgf("process %d of program %s in state file %s is not running anymore", state.Pid, b.Program.Name, path)
+		b.removeState(ifaceName, direction)
+		return nil
+	}
+	return state
+}
+
+// adoptProcess adopts the user program left running by the previous l3afd instance, if it runs the
+// same executable with the same args and maps. A process which does not match is stopped.
+func (b *BPF) adoptProcess(ifaceName, direction string, chain bool, executable string, args []string) bool {
+	state := b.liveState(ifaceName, direction)
+	if state == nil {
+		return false
+	}
+
+	if state.Name != b.Program.Name || state.Version != b.Program.Version || state.Executable != executable ||
+		!sameArgs(state.Args, args) || state.MapNamePath != b.MapNamePath || state.PrevMapNamePath != b.PrevMapNamePath {
+		log.Warn().Msgf("process %d of program %s version %s does not match version %s, stopping it", state.Pid, state.Name, state.Version, b.Program.Version)
+		stopStaleProcess(state)
+		b.removeState(ifaceName, direction)
+		return false
+	}
+
+	process, err := os.FindProcess(state.Pid)
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to adopt process %d of program %s", state.Pid, b.Program.Name)
+		return false
+	}
+	b.Cmd = &exec.Cmd{Path: executable, Args: append([]string{executable}, args...), Process: process}
+	b.adopted = state
+	b.watch = nil
+	// the adopted process keeps writing to the log file it was started with
+	b.setLogs(ifaceName, direction)
+	if dir := b.secretsPath(ifaceName, direction); len(dir) > 0 && b.hasSecretFiles() {
+		b.secretsDir = dir
+	}
+	b.loadSecrets()
+
+	if err := b.VerifyPinnedMapExists(chain); err != nil {
+		log.Warn().Err(err).Msgf("adopted process %d of program %s has no pinned map, restarting it", state.Pid, b.Program.Name)
+		b.releaseAdopted()
+		stopStaleProcess(state)
+		return false
+	}
+	if len(b.Program.MapArgs) > 0 {
+		if err := b.UpdateBPFMaps(ifaceName, direction); err != nil {
+			log.Warn().Err(err).Msgf("failed to update BPF maps of adopted program %s", b.Program.Name)
+		}
+	}
+	b.ProgID = state.ProgID
+	if len(b.PrevMapNamePath) > 0 {
+		if id, err := b.GetProgID(); err == nil {
+			b.ProgID = id
+		}
+	}
+	if len(b.Program.CmdConfig) > 0 && len(b.Program.ConfigFilePath) > 0 {
+		b.Done = make(chan bool)
+		go b.RunKFConfigs()
+	}
+
+	log.Info().Msgf("adopted process %d of program %s left running by previous l3afd instance", state.Pid, b.Program.Name)
+	return true
+}
+
+func (b *BPF) releaseAdopted() {
+	b.Cmd = nil
+	b.adopted = nil
+}
+
+// stopStaleProcess kills the process of the state, unless its pid was reused by another process
+func stopStaleProcess(state *programState) {
+	if !processMatches(state) {
+		return
+	}
+	process, err := os.FindProcess(state.Pid)
+	if err == nil {
+		err = process.Kill()
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to stop process %d of program %s", state.Pid, state.Name)
+		return
+	}
+	for i := 0; i < 50 && processMatches(state); i++ {
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// releaseProcess leaves the user program running, the next l3afd instance adopts it
+func (b *BPF) releaseProcess() bool {
+	if b.isNative() || !b.Program.UserProgramDaemon || b.Cmd == nil || b.Cmd.Process == nil {
+		return false
+	}
+	if b.hostConfig == nil || len(b.hostConfig.BPFStateDir) == 0 {
+		return false
+	}
+	if b.watch != nil {
+		b.watch.stop()
+	}
+	log.Info().Msgf("leaving process %d of program %s running", b.Cmd.Process.Pid, b.Program.Name)
+	return true
+}
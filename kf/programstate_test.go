@@ -0,0 +1,263 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_statePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		hostConfig *config.Config
+		want       string
+	}{
+		{name: "NoConfig"},
+		{name: "Disabled", hostConfig: &config.Config{}},
+		{name: "StateDir", hostConfig: &config.Config{BPFStateDir: "/var/l3afd/state"}, want: "/var/l3afd/state/foo/eth0_ingress.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: models.BPFProgram{Name: "foo"}, hostConfig: tt.hostConfig}
+			if got := b.statePath("eth0", models.IngressType); got != tt.want {
+				t.Errorf("statePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_saveState(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processStartTime(process.Pid); err != nil {
+		t.Skipf("process start time not available: %v", err)
+	}
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", Version: "1.0", CmdStart: filepath.Base(executable), UserProgramDaemon: true},
+		FilePath:   filepath.Dir(executable),
+		Cmd:        &exec.Cmd{Process: process},
+		hostConfig: &config.Config{BPFStateDir: t.TempDir()},
+	}
+	args := []string{"--iface=eth0", "--direction=ingress"}
+	if err := b.saveState("eth0", models.IngressType, args); err != nil {
+		t.Fatalf("saveState() error = %v", err)
+	}
+
+	state := b.liveState("eth0", models.IngressType)
+	if state == nil {
+		t.Fatal("liveState() = nil, want the saved state")
+	}
+	if state.Pid != process.Pid || state.Executable != executable || !sameArgs(state.Args, args) {
+		t.Errorf("liveState() = %+v", state)
+	}
+
+	stale := *state
+	stale.StartTime++
+	if processMatches(&stale) {
+		t.Errorf("processMatches() = true for another start time")
+	}
+
+	b.removeState("eth0", models.IngressType)
+	if state := b.liveState("eth0", models.IngressType); state != nil {
+		t.Errorf("liveState() = %+v after removeState()", state)
+	}
+}
+
+func TestBPF_adoptProcessOutput(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processStartTime(os.Getpid()); err != nil {
+		t.Skipf("process start time not available: %v", err)
+	}
+	conf := &config.Config{BPFStateDir: t.TempDir(), BPFLogDir: t.TempDir(), BPFLogMaxSizeMB: 1, BPFLogMaxFiles: 1}
+	prog := models.BPFProgram{Name: "foo", Version: "1.0", CmdStart: filepath.Base(executable), UserProgramDaemon: true}
+	args := []string{"-test.run=TestHelperDaemon", "--"}
+
+	// started by the previous l3afd instance
+	b := &BPF{Program: prog, FilePath: filepath.Dir(executable), hostConfig: conf}
+	b.Cmd = exec.Command(executable, args...)
+	b.Cmd.Env = []string{"GO_WANT_HELPER_DAEMON=1"}
+	stdin, err := b.Cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("StdinPipe() error = %v", err)
+	}
+	output := b.captureOutput("eth0", models.IngressType)
+	if err := b.Cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	cmd := b.Cmd
+	defer func() {
+		stdin.Close()
+		_ = cmd.Wait()
+	}()
+	b.closeOutput(output)
+	if err := b.saveState("eth0", models.IngressType, args); err != nil {
+		t.Fatalf("saveState() error = %v", err)
+	}
+	fmt.Fprintln(stdin, "before restart")
+
+	// l3afd restarts, the output of the adopted process is still captured
+	adopted := &BPF{Program: prog, FilePath: filepath.Dir(executable), hostConfig: conf}
+	if !adopted.adoptProcess("eth0", models.IngressType, false, executable, args) {
+		t.Fatal("adoptProcess() = false, want the process adopted")
+	}
+	fmt.Fprintln(stdin, "after restart")
+
+	want := []string{"before restart", "after restart"}
+	var lines []string
+	for i := 0; i < 50; i++ {
+		if lines, err = adopted.logs.tail(2); err == nil && reflect.DeepEqual(lines, want) {
+			break
+		}
+		time.Sleep(waitPollInterval)
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("tail() of adopted process = %q, %v, want %q", lines, err, want)
+	}
+	if running, err := adopted.isRunning(); !running {
+		t.Errorf("isRunning() = false, %v, want the adopted process running", err)
+	}
+}
+
+func TestBPF_livePids(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processStartTime(os.Getpid()); err != nil {
+		t.Skipf("process start time not available: %v", err)
+	}
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &config.Config{BPFStateDir: t.TempDir()}
+	live := &BPF{
+		Program:    models.BPFProgram{Name: "foo", CmdStart: filepath.Base(executable), UserProgramDaemon: true},
+		FilePath:   filepath.Dir(executable),
+		Cmd:        &exec.Cmd{Process: process},
+		hostConfig: conf,
+	}
+	if err := live.saveState("eth0", models.IngressType, nil); err != nil {
+		t.Fatalf("saveState() error = %v", err)
+	}
+	// the pid of a stale state is not kept
+	stale := filepath.Join(conf.BPFStateDir, "bar", "eth1_ingress.json")
+	if err := os.MkdirAll(filepath.Dir(stale), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte(`{"pid": 1, "start_time": 1, "executable": "/bin/bar"}`), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &BPF{Program: models.BPFProgram{Name: "bar"}, hostConfig: conf}
+	if got := b.livePids(); len(got) != 1 || !got[os.Getpid()] {
+		t.Errorf("livePids() = %v, want %d", got, os.Getpid())
+	}
+}
+
+// startExternalProcess starts a copy of sleep in the background of a shell, so that the process is
+// not a child of l3afd and no other process runs its executable
+func startExternalProcess(t *testing.T) (string, *os.Process) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+	data, err := os.ReadFile(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executable := filepath.Join(t.TempDir(), "foo")
+	if err := os.WriteFile(executable, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("sh", "-c", executable+" 30 >/dev/null 2>&1 & echo $!").Output()
+	if err != nil {
+		t.Fatalf("failed to start %s: %v", executable, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = process.Kill() })
+	time.Sleep(50 * time.Millisecond)
+	if !externalRunning(process.Pid, executable) {
+		t.Skipf("process %d of %s not found", pid, executable)
+	}
+	return executable, process
+}
+
+// externalRunning reports whether the process runs the executable, exited processes not reaped
+// yet do not
+func externalRunning(pid int, executable string) bool {
+	path, err := processExecutable(pid)
+	return err == nil && path == executable
+}
+
+func TestStopExternalRunningProcess_Keep(t *testing.T) {
+	executable, process := startExternalProcess(t)
+	pid := process.Pid
+	running := func() bool { return externalRunning(pid, executable) }
+
+	if err := StopExternalRunningProcess(executable, map[int]bool{pid: true}); err != nil {
+		t.Fatalf("StopExternalRunningProcess() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !running() {
+		t.Fatalf("StopExternalRunningProcess() stopped the kept process %d", pid)
+	}
+
+	if err := StopExternalRunningProcess(executable, nil); err != nil {
+		t.Fatalf("StopExternalRunningProcess() error = %v", err)
+	}
+	for i := 0; i < 50 && running(); i++ {
+		time.Sleep(waitPollInterval)
+	}
+	if running() {
+		t.Errorf("StopExternalRunningProcess() did not stop process %d", pid)
+	}
+}
+
+func TestSameArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{name: "Empty", want: true},
+		{name: "Reordered", a: []string{"--a=1", "--b=2"}, b: []string{"--b=2", "--a=1"}, want: true},
+		{name: "Changed", a: []string{"--a=1", "--b=2"}, b: []string{"--a=1", "--b=3"}},
+		{name: "Added", a: []string{"--a=1"}, b: []string{"--a=1", "--b=2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameArgs(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/stats"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Run time states of the programs
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting" // restart scheduled after the backoff
+	StateCrashLoop  = "crash-loop" // restarts exhausted within the success window
+	StateExited     = "exited"     // not restarted according to the restart policy
+	StateDisabled   = "disabled"
+)
+
+// restartBudget limits the restarts of all the programs of the host in a sliding interval
+type restartBudget struct {
+	mu       sync.Mutex
+	limit    int
+	interval time.Duration
+	restarts []time.Time
+}
+
+func newRestartBudget(limit int, interval time.Duration) *restartBudget {
+	return &restartBudget{limit: limit, interval: interval}
+}
+
+// take consumes a restart of the budget. It returns false and the wait time until a restart is
+// available when the budget is exhausted.
+func (r *restartBudget) take(now time.Time) (time.Duration, bool) {
+	if r == nil || r.limit <= 0 {
+		return 0, true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recent := r.restarts[:0]
+	for _, t := range r.restarts {
+		if now.Sub(t) < r.interval {
+			recent = append(recent, t)
+		}
+	}
+	r.restarts = recent
+
+	if len(r.restarts) < r.limit {
+		r.restarts = append(r.restarts, now)
+		return 0, true
+	}
+	return r.restarts[0].Add(r.interval).Sub(now), false
+}
+
+// SetRestartPolicy configures the backoff, the success window and the host-wide budget of restarts
+func (c *pCheck) SetRestartPolicy(conf *config.Config) {
+	c.backoff = conf.RestartBackoff
+	c.maxBackoff = conf.RestartMaxBackoff
+	c.successWindow = conf.RestartSuccessWindow
+	c.budget = newRestartBudget(conf.RestartBudget, conf.RestartBudgetInterval)
+}
+
+// restartBackoff returns the wait time before restarting a program restarted n times already.
+// The first restart is immediate, the wait doubles on every following restart.
+func (c *pCheck) restartBackoff(n int) time.Duration {
+	if n <= 0 || c.backoff <= 0 {
+		return 0
+	}
+	d := c.backoff
+	for i := 1; i < n && (c.maxBackoff <= 0 || d < c.maxBackoff); i++ {
+		d *= 2
+	}
+	if c.maxBackoff > 0 && d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return d
+}
+
+// validateRestartPolicy checks the restart policy of the program
+func (b *BPF) validateRestartPolicy() error {
+	switch b.Program.RestartPolicy {
+	case "", models.RestartAlways, models.RestartOnFailure, models.RestartNever:
+		return nil
+	}
+	return fmt.Errorf("unknown restart policy %s of program %s, expected %s, %s or %s", b.Program.RestartPolicy,
+		b.Program.Name, models.RestartAlways, models.RestartOnFailure, models.RestartNever)
+}
+
+// restartWanted reports whether the restart policy restarts the program after the exit
+func restartWanted(policy string, exit *models.ProcessExit) bool {
+	switch policy {
+	case models.RestartNever:
+		return false
+	case models.RestartOnFailure:
+		return exitFailed(exit)
+	}
+	return true
+}
+
+// tryRestart applies the restart policy to the program which is not running. It returns the wait
+// time before the next attempt, 0 once the program is restarted or is not restarted anymore.
+func (c *pCheck) tryRestart(bpf *BPF, ifaceName, direction string, chain bool, exit *models.ProcessExit) time.Duration {
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+
+	now := time.Now()
+	switch bpf.state {
+	case StateCrashLoop, StateExited:
+		return 0
+	case StateRestarting:
+	default:
+		// newly detected failure
+		if !restartWanted(bpf.Program.RestartPolicy, exit) {
+			log.Info().Msgf("pMonitor BPF Program %s is not running and not restarted, restart policy %s", bpf.Program.Name, bpf.Program.RestartPolicy)
+			bpf.state = StateExited
+			stats.SetWithVersion(0.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+			return 0
+		}
+		failedAt := now
+		if exit != nil {
+			failedAt = exit.Time
+		}
+		if bpf.RestartCount > 0 && c.successWindow > 0 && !bpf.startedAt.IsZero() && failedAt.Sub(bpf.startedAt) >= c.successWindow {
+			log.Info().Msgf("pMonitor BPF Program %s ran for the success window, resetting restart count %d", bpf.Program.Name, bpf.RestartCount)
+			bpf.RestartCount = 0
+		}
+		bpf.state = StateRestarting
+		bpf.restartAt = now.Add(c.restartBackoff(bpf.RestartCount))
+	}
+
+	if bpf.RestartCount >= c.MaxRetryCount {
+		log.Error().Msgf("pMonitor BPF Program %s is in crash loop, %d restarts exhausted, iface: %s", bpf.Program.Name, bpf.RestartCount, ifaceName)
+		bpf.state = StateCrashLoop
+		bpf.events.add(EventCrashLoop, "%d restarts exhausted", bpf.RestartCount)
+		stats.SetWithVersion(0.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+		stats.SetWithVersion(1.0, stats.NFCrashLoop, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+		return 0
+	}
+
+	if now.Before(bpf.restartAt) {
+		return bpf.restartAt.Sub(now)
+	}
+
+	if wait, ok := c.budget.take(now); !ok {
+		log.Warn().Msgf("pMonitor host restart budget exhausted, delaying restart of BPF Program %s by %s", bpf.Program.Name, wait)
+		bpf.restartAt = now.Add(wait)
+		return wait
+	}
+
+	bpf.RestartCount++
+	log.Warn().Msgf("pMonitor BPF Program is not running. Restart attempt: %d, program name: %s, iface: %s",
+		bpf.RestartCount, bpf.Program.Name, ifaceName)
+	stats.Incr(stats.NFRestartCount, bpf.Program.Name, direction, ifaceName)
+	bpf.events.add(EventRestarted, "restart attempt %d", bpf.RestartCount)
+	if err := bpf.Start(ifaceName, direction, chain); err != nil {
+		log.Error().Err(err).Msgf("pMonitor BPF Program start failed for program %s", bpf.Program.Name)
+		wait := c.restartBackoff(bpf.RestartCount)
+		if wait <= 0 {
+			wait = c.retryMonitorDelay
+		}
+		bpf.restartAt = now.Add(wait)
+		return wait
+	}
+
+	stats.SetWithVersion(1.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+	return 0
+}
+
+// status returns the run time state of the program attached to the attach point
+func (b *BPF) status(attachPoint, direction string) models.BPFProgramStatus {
+	status := models.BPFProgramStatus{
+		Name:          b.Program.Name,
+		Version:       b.Program.Version,
+		AttachPoint:   attachPoint,
+		Direction:     direction,
+		State:         b.state,
+		RestartPolicy: b.Program.RestartPolicy,
+		RestartCount:  b.RestartCount,
+		LastExit:      b.LastExit,
+		Events:        b.events.list(),
+	}
+	if len(status.RestartPolicy) == 0 {
+		status.RestartPolicy = models.RestartAlways
+	}
+	switch {
+	case b.Program.AdminStatus == models.Disabled:
+		status.State = StateDisabled
+	case len(status.State) == 0:
+		status.State = StateRunning
+	case status.State == StateRestarting && !b.restartAt.IsZero():
+		next := b.restartAt
+		status.NextRestart = &next
+	}
+	return status
+}
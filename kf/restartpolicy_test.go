@@ -0,0 +1,166 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_restartBudget_take(t *testing.T) {
+	now := time.Now()
+	r := newRestartBudget(2, time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, ok := r.take(now); !ok {
+			t.Fatalf("take() %d exhausted the budget", i)
+		}
+	}
+	if wait, ok := r.take(now.Add(10 * time.Second)); ok || wait != 50*time.Second {
+		t.Errorf("take() = %v, %v, want 50s, false", wait, ok)
+	}
+	if _, ok := r.take(now.Add(time.Minute)); !ok {
+		t.Errorf("take() after the interval exhausted the budget")
+	}
+	if _, ok := newRestartBudget(0, time.Minute).take(now); !ok {
+		t.Errorf("take() of unlimited budget exhausted the budget")
+	}
+}
+
+func Test_pCheck_restartBackoff(t *testing.T) {
+	c := &pCheck{backoff: time.Second, maxBackoff: 5 * time.Second}
+	tests := []struct {
+		restarts int
+		want     time.Duration
+	}{
+		{restarts: 0, want: 0},
+		{restarts: 1, want: time.Second},
+		{restarts: 2, want: 2 * time.Second},
+		{restarts: 3, want: 4 * time.Second},
+		{restarts: 4, want: 5 * time.Second},
+		{restarts: 100, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := c.restartBackoff(tt.restarts); got != tt.want {
+			t.Errorf("restartBackoff(%d) = %v, want %v", tt.restarts, got, tt.want)
+		}
+	}
+}
+
+func Test_restartWanted(t *testing.T) {
+	clean := &models.ProcessExit{ExitCode: 0}
+	failed := &models.ProcessExit{ExitCode: 1}
+	killed := &models.ProcessExit{ExitCode: -1, Signal: "SIGKILL"}
+	tests := []struct {
+		name   string
+		policy string
+		exit   *models.ProcessExit
+		want   bool
+	}{
+		{name: "DefaultCleanExit", exit: clean, want: true},
+		{name: "AlwaysCleanExit", policy: models.RestartAlways, exit: clean, want: true},
+		{name: "OnFailureCleanExit", policy: models.RestartOnFailure, exit: clean, want: false},
+		{name: "OnFailureFailedExit", policy: models.RestartOnFailure, exit: failed, want: true},
+		{name: "OnFailureKilled", policy: models.RestartOnFailure, exit: killed, want: true},
+		{name: "OnFailureStatusCheck", policy: models.RestartOnFailure, want: true},
+		{name: "NeverFailedExit", policy: models.RestartNever, exit: failed, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restartWanted(tt.policy, tt.exit); got != tt.want {
+				t.Errorf("restartWanted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_validateRestartPolicy(t *testing.T) {
+	for _, policy := range []string{"", models.RestartAlways, models.RestartOnFailure, models.RestartNever} {
+		b := &BPF{Program: models.BPFProgram{Name: "foo", RestartPolicy: policy}}
+		if err := b.validateRestartPolicy(); err != nil {
+			t.Errorf("validateRestartPolicy(%q) error = %v", policy, err)
+		}
+	}
+	b := &BPF{Program: models.BPFProgram{Name: "foo", RestartPolicy: "sometimes"}}
+	if err := b.validateRestartPolicy(); err == nil {
+		t.Errorf("validateRestartPolicy() succeeded for unknown policy")
+	}
+}
+
+func TestNFConfigs_ProgramStatus(t *testing.T) {
+	restartAt := time.Now().Add(time.Minute)
+	exit := &models.ProcessExit{Pid: 77, ExitCode: 1}
+	xdp := &BPF{Program: models.BPFProgram{Name: "ratelimiting", Version: "1.0", AdminStatus: models.Enabled}}
+	tc := &BPF{Program: models.BPFProgram{Name: "connection-limit", Version: "1.0", RestartPolicy: models.RestartOnFailure},
+		RestartCount: 2, LastExit: exit, state: StateRestarting, restartAt: restartAt}
+	crashed := &BPF{Program: models.BPFProgram{Name: "ipfix-flow-exporter", Version: "1.0"}, RestartCount: 3, state: StateCrashLoop}
+	disabled := &BPF{Program: models.BPFProgram{Name: "traffic-mirroring", Version: "1.0", AdminStatus: models.Disabled}}
+	c := &NFConfigs{
+		IngressXDPBpfs: map[string]*list.List{"eth0": list.New()},
+		IngressTCBpfs:  map[string]*list.List{"eth0": list.New()},
+		EgressTCBpfs:   map[string]*list.List{"eth1": nil},
+		CgroupBpfs:     newCgroupBpfs(),
+		TracingBpfs:    newTracingBpfs(),
+	}
+	c.IngressXDPBpfs["eth0"].PushBack(xdp)
+	c.IngressXDPBpfs["eth0"].PushBack(disabled)
+	c.IngressTCBpfs["eth0"].PushBack(tc)
+	c.TracingBpfs[models.KprobeType]["tcp_v4_connect"] = list.New()
+	c.TracingBpfs[models.KprobeType]["tcp_v4_connect"].PushBack(crashed)
+
+	want := []models.BPFProgramStatus{
+		{Name: "connection-limit", Version: "1.0", AttachPoint: "eth0", Direction: models.IngressType, State: StateRestarting,
+			RestartPolicy: models.RestartOnFailure, RestartCount: 2, NextRestart: &restartAt, LastExit: exit},
+		{Name: "ratelimiting", Version: "1.0", AttachPoint: "eth0", Direction: models.XDPIngressType, State: StateRunning,
+			RestartPolicy: models.RestartAlways},
+		{Name: "traffic-mirroring", Version: "1.0", AttachPoint: "eth0", Direction: models.XDPIngressType, State: StateDisabled,
+			RestartPolicy: models.RestartAlways},
+		{Name: "ipfix-flow-exporter", Version: "1.0", AttachPoint: "tcp_v4_connect", Direction: models.KprobeType, State: StateCrashLoop,
+			RestartPolicy: models.RestartAlways, RestartCount: 3},
+	}
+	if got := c.ProgramStatus(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ProgramStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_pCheck_restart(t *testing.T) {
+	exit := &models.ProcessExit{Pid: 77, ExitCode: 1}
+	exited := &processWatch{done: make(chan struct{}), exit: exit, armed: true}
+	running := &processWatch{done: make(chan struct{}), armed: true}
+	tests := []struct {
+		name     string
+		attached bool
+		watch    *processWatch // current watch of the program
+	}{
+		{name: "Removed", watch: exited},
+		{name: "Restarted", attached: true, watch: running},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpf := &BPF{Program: models.BPFProgram{Name: "foo", AdminStatus: models.Enabled}, watch: tt.watch}
+			c := &NFConfigs{
+				IngressXDPBpfs: map[string]*list.List{"eth0": list.New()},
+				IngressTCBpfs:  map[string]*list.List{},
+				EgressTCBpfs:   map[string]*list.List{},
+				CgroupBpfs:     newCgroupBpfs(),
+				TracingBpfs:    newTracingBpfs(),
+				mu:             new(sync.Mutex),
+			}
+			if tt.attached {
+				c.IngressXDPBpfs["eth0"].PushBack(bpf)
+			}
+			pc := &pCheck{MaxRetryCount: 3, configs: c}
+			if wait := pc.restart(bpf, exited, "eth0", models.XDPIngressType, true, exit); wait != 0 {
+				t.Errorf("restart() = %v, want 0", wait)
+			}
+			if bpf.RestartCount != 0 || len(bpf.state) != 0 || bpf.LastExit != nil {
+				t.Errorf("restart() restarted the program, state %q, restart count %d", bpf.state, bpf.RestartCount)
+			}
+		})
+	}
+}
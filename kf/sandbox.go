@@ -0,0 +1,171 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SandboxCommand is the l3afd subcommand applying the security settings of a user program before
+// executing it, l3afd runs the commands of the programs with security settings through it:
+//
+//	l3afd sandbox-exec <sandbox spec> <command> <args>...
+const SandboxCommand = "sandbox-exec"
+
+// sandboxSpec is the security settings of a user program resolved by l3afd for the sandbox
+type sandboxSpec struct {
+	UID            *int      `json:"uid,omitempty"`
+	GID            *int      `json:"gid,omitempty"`
+	Groups         []int     `json:"groups,omitempty"`
+	Capabilities   []uintptr `json:"capabilities"`
+	NoNewPrivs     bool      `json:"no_new_privs"`
+	SeccompProfile string    `json:"seccomp_profile,omitempty"`
+	MountNamespace bool      `json:"mount_namespace"`
+	KeepPrivileges bool      `json:"keep_privileges,omitempty"` // no security settings, run with the privileges of l3afd
+	Cgroup         string    `json:"cgroup,omitempty"`          // cgroup v2 joined before the command is executed
+}
+
+// sandboxSpec resolves the user, group, capabilities and seccomp profile of the program
+func (b *BPF) sandboxSpec() (*sandboxSpec, error) {
+	sec := b.Program.Security
+	if !sandboxSupported {
+		return nil, fmt.Errorf("security settings of program %s are not supported on this platform", b.Program.Name)
+	}
+
+	spec := &sandboxSpec{
+		Capabilities:   []uintptr{},
+		NoNewPrivs:     sec.NoNewPrivs || len(sec.SeccompProfile) > 0,
+		MountNamespace: sec.MountNamespace,
+	}
+	if len(sec.User) > 0 {
+		u, err := lookupUser(sec.User)
+		if err != nil {
+			return nil, fmt.Errorf("unknown user %s of program %s: %v", sec.User, b.Program.Name, err)
+		}
+		uid, _ := strconv.Atoi(u.Uid)
+		gid, _ := strconv.Atoi(u.Gid)
+		spec.UID, spec.GID = &uid, &gid
+		groupIds, err := u.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get groups of user %s of program %s: %v", sec.User, b.Program.Name, err)
+		}
+		for _, id := range groupIds {
+			if g, err := strconv.Atoi(id); err == nil {
+				spec.Groups = append(spec.Groups, g)
+			}
+		}
+	}
+	if len(sec.Group) > 0 {
+		g, err := lookupGroup(sec.Group)
+		if err != nil {
+			return nil, fmt.Errorf("unknown group %s of program %s: %v", sec.Group, b.Program.Name, err)
+		}
+		gid, _ := strconv.Atoi(g.Gid)
+		spec.GID = &gid
+		if spec.UID == nil {
+			spec.Groups = []int{gid}
+		}
+	}
+	for _, name := range sec.Capabilities {
+		c, ok := capabilityValue(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %s of program %s", name, b.Program.Name)
+		}
+		spec.Capabilities = append(spec.Capabilities, c)
+	}
+	if len(sec.SeccompProfile) > 0 {
+		if filepath.IsAbs(sec.SeccompProfile) || strings.HasPrefix(filepath.Clean(sec.SeccompProfile), "..") {
+			return nil, fmt.Errorf("seccomp profile %s of program %s is not in the artifact", sec.SeccompProfile, b.Program.Name)
+		}
+		spec.SeccompProfile = filepath.Join(b.FilePath, sec.SeccompProfile)
+	}
+	return spec, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// validateSecurity checks the security settings of the program
+func (b *BPF) validateSecurity() error {
+	if b.Program.Security == nil {
+		return nil
+	}
+	_, err := b.sandboxSpec()
+	return err
+}
+
+// command builds the command running cmd of the user program. Programs with security settings run
+// through the sandbox of l3afd, others with the full privileges of l3afd.
+func (b *BPF) command(cmd string, args ...string) (*exec.Cmd, error) {
+	return b.cgroupCommand("", cmd, args...)
+}
+
+// cgroupCommand builds the command running cmd of the user program in the cgroup. The sandbox of
+// l3afd joins the cgroup before executing the command, so that the program never runs unlimited.
+func (b *BPF) cgroupCommand(cgroup, cmd string, args ...string) (*exec.Cmd, error) {
+	env, err := b.commandEnv()
+	if err != nil {
+		return nil, err
+	}
+	if b.Program.Security == nil && len(cgroup) == 0 {
+		prog := execCommand(cmd, args...)
+		prog.Env = env
+		return prog, nil
+	}
+
+	spec := &sandboxSpec{KeepPrivileges: true}
+	if b.Program.Security != nil {
+		if spec, err = b.sandboxSpec(); err != nil {
+			return nil, err
+		}
+	}
+	spec.Cgroup = cgroup
+	if len(spec.SeccompProfile) > 0 {
+		if _, err := os.Stat(spec.SeccompProfile); err != nil {
+			return nil, fmt.Errorf("seccomp profile of program %s not found: %v", b.Program.Name, err)
+		}
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode security settings of program %s: %v", b.Program.Name, err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find l3afd executable: %v", err)
+	}
+	prog := execCommand(self, append([]string{SandboxCommand, string(data), cmd}, args...)...)
+	prog.Env = env
+	return prog, nil
+}
+
+// parseSandboxArgs returns the spec, the command and its args given to the sandbox
+func parseSandboxArgs(args []string) (*sandboxSpec, []string, error) {
+	if len(args) < 2 {
+		return nil, nil, errors.New("usage: l3afd " + SandboxCommand + " <sandbox spec> <command> [args...]")
+	}
+	spec := &sandboxSpec{}
+	if err := json.Unmarshal([]byte(args[0]), spec); err != nil {
+		return nil, nil, fmt.Errorf("invalid sandbox spec: %v", err)
+	}
+	return spec, args[1:], nil
+}
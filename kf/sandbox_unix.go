@@ -0,0 +1,225 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const sandboxSupported = true
+
+// capabilities maps the capability names to their values
+var capabilities = map[string]uintptr{
+	"CAP_CHOWN":              unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":             unix.CAP_FOWNER,
+	"CAP_FSETID":             unix.CAP_FSETID,
+	"CAP_KILL":               unix.CAP_KILL,
+	"CAP_SETGID":             unix.CAP_SETGID,
+	"CAP_SETUID":             unix.CAP_SETUID,
+	"CAP_SETPCAP":            unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":            unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":              unix.CAP_MKNOD,
+	"CAP_LEASE":              unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":            unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":             unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+	"CAP_PERFMON":            unix.CAP_PERFMON,
+	"CAP_BPF":                unix.CAP_BPF,
+	"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// capabilityValue returns the value of the capability, the CAP_ prefix is optional
+func capabilityValue(name string) (uintptr, bool) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	c, ok := capabilities[name]
+	return c, ok
+}
+
+// Sandbox is the sandbox-exec subcommand of l3afd. It applies the security settings to its own
+// thread and executes the user program in place, it never returns.
+func Sandbox(args []string) {
+	if err := sandboxExec(args); err != nil {
+		fmt.Fprintf(os.Stderr, "l3afd %s: %v\n", SandboxCommand, err)
+		os.Exit(127)
+	}
+}
+
+func sandboxExec(args []string) error {
+	spec, command, err := parseSandboxArgs(args)
+	if err != nil {
+		return err
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+
+	// The program is limited by its cgroup from its first instruction
+	if len(spec.Cgroup) > 0 {
+		pid := strconv.Itoa(os.Getpid())
+		if err := os.WriteFile(filepath.Join(spec.Cgroup, "cgroup.procs"), []byte(pid), 0644); err != nil {
+			return fmt.Errorf("failed to join cgroup %s: %v", spec.Cgroup, err)
+		}
+	}
+	if spec.KeepPrivileges {
+		return unix.Exec(path, command, os.Environ())
+	}
+
+	// Capabilities, no_new_privs and seccomp filters apply to the calling thread, which executes the program
+	runtime.LockOSThread()
+
+	if spec.MountNamespace {
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("failed to create mount namespace: %v", err)
+		}
+		// mounts of the program do not propagate to the host
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("failed to make mounts private: %v", err)
+		}
+	}
+
+	var filter []unix.SockFilter
+	if len(spec.SeccompProfile) > 0 {
+		// read before the privileges are dropped
+		data, err := os.ReadFile(spec.SeccompProfile)
+		if err != nil {
+			return fmt.Errorf("failed to read seccomp profile: %v", err)
+		}
+		if filter, err = parseSeccompFilter(data); err != nil {
+			return fmt.Errorf("invalid seccomp profile %s: %v", spec.SeccompProfile, err)
+		}
+	}
+
+	if err := dropCapabilities(spec); err != nil {
+		return err
+	}
+
+	if spec.NoNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set no_new_privs: %v", err)
+		}
+	}
+	if len(filter) > 0 {
+		prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+		if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+			return fmt.Errorf("failed to load seccomp profile: %v", err)
+		}
+	}
+
+	return unix.Exec(path, command, os.Environ())
+}
+
+// dropCapabilities switches to the user and group of the spec, keeping only its capabilities. They
+// are dropped from the bounding set so that root programs do not get them back at exec.
+func dropCapabilities(spec *sandboxSpec) error {
+	retained := uint64(0)
+	for _, c := range spec.Capabilities {
+		retained |= 1 << c
+	}
+
+	for c := uintptr(0); c <= unix.CAP_LAST_CAP; c++ {
+		if retained&(1<<c) != 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("failed to drop capability %d: %v", c, err)
+		}
+	}
+
+	if spec.UID != nil || spec.GID != nil {
+		// permitted capabilities survive the switch from root
+		if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to keep capabilities: %v", err)
+		}
+		if err := unix.Setgroups(spec.Groups); err != nil {
+			return fmt.Errorf("failed to set groups: %v", err)
+		}
+		if spec.GID != nil {
+			if err := unix.Setresgid(*spec.GID, *spec.GID, *spec.GID); err != nil {
+				return fmt.Errorf("failed to set group %d: %v", *spec.GID, err)
+			}
+		}
+		if spec.UID != nil {
+			if err := unix.Setresuid(*spec.UID, *spec.UID, *spec.UID); err != nil {
+				return fmt.Errorf("failed to set user %d: %v", *spec.UID, err)
+			}
+		}
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	for i := range data {
+		set := uint32(retained >> (32 * i))
+		data[i] = unix.CapUserData{Effective: set, Permitted: set, Inheritable: set}
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to set capabilities: %v", err)
+	}
+
+	// ambient capabilities are kept by programs executed by non-root users
+	for _, c := range spec.Capabilities {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, c, 0, 0); err != nil {
+			return fmt.Errorf("failed to raise ambient capability %d: %v", c, err)
+		}
+	}
+	return nil
+}
+
+// parseSeccompFilter decodes the seccomp profile, a classic BPF program of 8 bytes instructions in
+// the native byte order as exported by seccomp_export_bpf of libseccomp
+func parseSeccompFilter(data []byte) ([]unix.SockFilter, error) {
+	const insnSize = int(unsafe.Sizeof(unix.SockFilter{}))
+	if len(data) == 0 || len(data)%insnSize != 0 {
+		return nil, fmt.Errorf("size %d is not a multiple of %d", len(data), insnSize)
+	}
+	if len(data)/insnSize > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("more than %d instructions", unix.BPF_MAXINSNS)
+	}
+	filter := make([]unix.SockFilter, len(data)/insnSize)
+	for i := range filter {
+		filter[i] = *(*unix.SockFilter)(unsafe.Pointer(&data[i*insnSize]))
+	}
+	return filter, nil
+}
@@ -0,0 +1,157 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBPF_sandboxSpec(t *testing.T) {
+	root, nobody := 0, 65534
+	tests := []struct {
+		name     string
+		security models.BPFProgramSecurity
+		want     *sandboxSpec
+		wantErr  bool
+	}{
+		{
+			name:     "Capabilities",
+			security: models.BPFProgramSecurity{Capabilities: []string{"CAP_BPF", "net_admin"}, MountNamespace: true},
+			want:     &sandboxSpec{Capabilities: []uintptr{unix.CAP_BPF, unix.CAP_NET_ADMIN}, MountNamespace: true},
+		},
+		{
+			name:     "UserAndGroup",
+			security: models.BPFProgramSecurity{User: "root", Group: "65534"},
+			want:     &sandboxSpec{UID: &root, GID: &nobody, Groups: []int{0}, Capabilities: []uintptr{}},
+		},
+		{
+			name:     "Seccomp",
+			security: models.BPFProgramSecurity{SeccompProfile: "seccomp.bpf"},
+			want:     &sandboxSpec{Capabilities: []uintptr{}, NoNewPrivs: true, SeccompProfile: "/tmp/foo/seccomp.bpf"},
+		},
+		{
+			name:     "UnknownCapability",
+			security: models.BPFProgramSecurity{Capabilities: []string{"CAP_FOO"}},
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownUser",
+			security: models.BPFProgramSecurity{User: "l3afd-no-such-user"},
+			wantErr:  true,
+		},
+		{
+			name:     "SeccompOutsideArtifact",
+			security: models.BPFProgramSecurity{SeccompProfile: "../seccomp.bpf"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			security := tt.security
+			b := &BPF{Program: models.BPFProgram{Name: "foo", Security: &security}, FilePath: "/tmp/foo"}
+			got, err := b.sandboxSpec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sandboxSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sandboxSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_command(t *testing.T) {
+	dir := t.TempDir()
+	b := &BPF{Program: models.BPFProgram{Name: "foo"}, FilePath: dir}
+	cmd, err := b.command("/tmp/foo/foo", "--iface=eth0")
+	if err != nil {
+		t.Fatalf("command() error = %v", err)
+	}
+	if want := []string{"/tmp/foo/foo", "--iface=eth0"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("command() args = %v, want %v", cmd.Args, want)
+	}
+
+	b.Program.Security = &models.BPFProgramSecurity{Capabilities: []string{"CAP_BPF"}, SeccompProfile: "seccomp.bpf"}
+	if _, err := b.command("/tmp/foo/foo"); err == nil {
+		t.Errorf("command() with a missing seccomp profile succeeded, want error")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "seccomp.bpf"), make([]byte, 8), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err = b.command("/tmp/foo/foo", "--iface=eth0")
+	if err != nil {
+		t.Fatalf("command() error = %v", err)
+	}
+	self, _ := os.Executable()
+	if cmd.Path != self || len(cmd.Args) != 5 || cmd.Args[1] != SandboxCommand {
+		t.Fatalf("command() = %v, want %s %s", cmd.Args, self, SandboxCommand)
+	}
+	spec, command, err := parseSandboxArgs(cmd.Args[2:])
+	if err != nil {
+		t.Fatalf("parseSandboxArgs() error = %v", err)
+	}
+	if !reflect.DeepEqual(command, []string{"/tmp/foo/foo", "--iface=eth0"}) {
+		t.Errorf("sandboxed command = %v", command)
+	}
+	want := &sandboxSpec{Capabilities: []uintptr{unix.CAP_BPF}, NoNewPrivs: true, SeccompProfile: filepath.Join(dir, "seccomp.bpf")}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("sandbox spec = %+v, want %+v", spec, want)
+	}
+}
+
+func TestBPF_cgroupCommand(t *testing.T) {
+	b := &BPF{Program: models.BPFProgram{Name: "foo"}, FilePath: t.TempDir()}
+	cgroup := "/sys/fs/cgroup/l3afd.slice/foo-eth0_ingress"
+	cmd, err := b.cgroupCommand(cgroup, "/tmp/foo/foo", "--iface=eth0")
+	if err != nil {
+		t.Fatalf("cgroupCommand() error = %v", err)
+	}
+	if len(cmd.Args) != 5 || cmd.Args[1] != SandboxCommand {
+		t.Fatalf("cgroupCommand() = %v, want the %s subcommand", cmd.Args, SandboxCommand)
+	}
+	spec, command, err := parseSandboxArgs(cmd.Args[2:])
+	if err != nil {
+		t.Fatalf("parseSandboxArgs() error = %v", err)
+	}
+	if !reflect.DeepEqual(command, []string{"/tmp/foo/foo", "--iface=eth0"}) {
+		t.Errorf("sandboxed command = %v", command)
+	}
+	if want := (&sandboxSpec{KeepPrivileges: true, Cgroup: cgroup}); !reflect.DeepEqual(spec, want) {
+		t.Errorf("sandbox spec = %+v, want %+v", spec, want)
+	}
+}
+
+func TestParseSeccompFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{name: "Empty", wantErr: true},
+		{name: "Truncated", data: make([]byte, 12), wantErr: true},
+		{name: "Valid", data: make([]byte, 16), want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSeccompFilter(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSeccompFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseSeccompFilter() = %d instructions, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
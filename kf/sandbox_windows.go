@@ -0,0 +1,24 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build WINDOWS
+// +build WINDOWS
+
+package kf
+
+import (
+	"fmt"
+	"os"
+)
+
+const sandboxSupported = false
+
+func capabilityValue(name string) (uintptr, bool) {
+	return 0, false
+}
+
+// Sandbox is the sandbox-exec subcommand of l3afd, user programs are not sandboxed on Windows
+func Sandbox(args []string) {
+	fmt.Fprintf(os.Stderr, "l3afd %s is not supported on Windows\n", SandboxCommand)
+	os.Exit(127)
+}
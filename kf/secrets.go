@@ -0,0 +1,404 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SecretsDirEnv is the environment variable of the user program commands set to the private
+	// secrets directory of the program
+	SecretsDirEnv = "L3AFD_SECRETS_DIR"
+	// maxSecretSize bounds the size of a secret file
+	maxSecretSize = 64 << 10
+	// redactedValue replaces the secrets in logs and responses
+	redactedValue = "******"
+)
+
+// secretValues is the set of secrets read for a user program, redacted from its logs
+type secretValues struct {
+	mu     sync.Mutex
+	values map[string]bool
+}
+
+func (s *secretValues) add(value string) {
+	if len(value) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]bool)
+	}
+	s.values[value] = true
+}
+
+// list returns the secrets, longest first so that secrets containing others are redacted whole
+func (s *secretValues) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make([]string, 0, len(s.values))
+	for v := range s.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// redact replaces the secrets of the program in s
+func (b *BPF) redact(s string) string {
+	for _, v := range b.secrets.list() {
+		s = strings.ReplaceAll(s, v, redactedValue)
+	}
+	return s
+}
+
+// redactArgs returns the args with the secrets of the program replaced, for logging
+func (b *BPF) redactArgs(args []string) []string {
+	redacted := make([]string, 0, len(args))
+	for _, arg := range args {
+		redacted = append(redacted, b.redact(arg))
+	}
+	return redacted
+}
+
+// validateEnvKey checks the name of an environment variable
+func validateEnvKey(key string) error {
+	if len(key) == 0 || strings.ContainsAny(key, "=\x00") {
+		return fmt.Errorf("invalid environment variable name %q", key)
+	}
+	if key == SecretsDirEnv {
+		return fmt.Errorf("environment variable %s is set by l3afd", key)
+	}
+	return nil
+}
+
+// validateSecrets checks the environment and the secret references of the program
+func (b *BPF) validateSecrets() error {
+	for k, v := range b.Program.Env {
+		if err := validateEnvKey(k); err != nil {
+			return fmt.Errorf("env of program %s: %v", b.Program.Name, err)
+		}
+		if strings.ContainsRune(v, 0) {
+			return fmt.Errorf("env %s of program %s contains a NUL byte", k, b.Program.Name)
+		}
+	}
+
+	names := make(map[string]bool, len(b.Program.Secrets))
+	for _, s := range b.Program.Secrets {
+		if len(s.Name) == 0 || s.Name == "." || s.Name == ".." || strings.ContainsAny(s.Name, "/\x00") {
+			return fmt.Errorf("invalid secret name %q of program %s", s.Name, b.Program.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate secret %s of program %s", s.Name, b.Program.Name)
+		}
+		names[s.Name] = true
+		if _, err := b.secretFile(s); err != nil {
+			return err
+		}
+		if len(s.Env) > 0 {
+			if err := validateEnvKey(s.Env); err != nil {
+				return fmt.Errorf("secret %s of program %s: %v", s.Name, b.Program.Name, err)
+			}
+			if _, ok := b.Program.Env[s.Env]; ok {
+				return fmt.Errorf("secret %s of program %s overrides env %s", s.Name, b.Program.Name, s.Env)
+			}
+		} else if b.hostConfig == nil || len(b.hostConfig.SecretsRunDir) == 0 {
+			return fmt.Errorf("secret %s of program %s needs the secrets-run-dir of l3afd", s.Name, b.Program.Name)
+		}
+	}
+	return nil
+}
+
+// secretFile returns the path of the secret file, which must be in the secrets directory of l3afd
+func (b *BPF) secretFile(s models.BPFProgramSecret) (string, error) {
+	if b.hostConfig == nil || len(b.hostConfig.SecretsDir) == 0 {
+		return "", fmt.Errorf("secret %s of program %s needs the secrets-dir of l3afd", s.Name, b.Program.Name)
+	}
+	if len(s.File) == 0 || filepath.IsAbs(s.File) || strings.HasPrefix(filepath.Clean(s.File), "..") {
+		return "", fmt.Errorf("secret file %s of program %s is not in the secrets directory", s.File, b.Program.Name)
+	}
+	return filepath.Join(b.hostConfig.SecretsDir, s.File), nil
+}
+
+// readSecret reads the secret file, and remembers the secret to redact it
+func (b *BPF) readSecret(s models.BPFProgramSecret) ([]byte, error) {
+	path, err := b.secretFile(s)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s of program %s: %v", s.Name, b.Program.Name, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSecretSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s of program %s: %v", s.Name, b.Program.Name, err)
+	}
+	if len(data) > maxSecretSize {
+		return nil, fmt.Errorf("secret %s of program %s is larger than %d bytes", s.Name, b.Program.Name, maxSecretSize)
+	}
+	b.secrets.add(string(data))
+	b.secrets.add(strings.TrimRight(string(data), "\r\n"))
+	return data, nil
+}
+
+// loadSecrets reads the secrets of a program adopted from a previous instance of l3afd, so that they
+// are redacted from its logs and from the config responses
+func (b *BPF) loadSecrets() {
+	for _, s := range b.Program.Secrets {
+		if _, err := b.readSecret(s); err != nil {
+			log.Warn().Err(err).Msgf("secret %s of adopted program %s is not redacted", s.Name, b.Program.Name)
+		}
+	}
+}
+
+// commandEnv returns the environment of the user program commands, nil for the environment of l3afd
+func (b *BPF) commandEnv() ([]string, error) {
+	if len(b.Program.Env) == 0 && len(b.Program.Secrets) == 0 {
+		return nil, nil
+	}
+	env := os.Environ()
+	keys := make([]string, 0, len(b.Program.Env))
+	for k := range b.Program.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+b.Program.Env[k])
+	}
+	for _, s := range b.Program.Secrets {
+		if len(s.Env) == 0 {
+			continue
+		}
+		data, err := b.readSecret(s)
+		if err != nil {
+			return nil, err
+		}
+		// trailing newlines of secret files are not part of the secret
+		env = append(env, s.Env+"="+strings.TrimRight(string(data), "\r\n"))
+	}
+	if len(b.secretsDir) > 0 {
+		env = append(env, SecretsDirEnv+"="+b.secretsDir)
+	}
+	return env, nil
+}
+
+// secretsPath returns the private secrets directory of the user program attached to the attach point
+func (b *BPF) secretsPath(ifaceName, direction string) string {
+	if b.hostConfig == nil || len(b.hostConfig.SecretsRunDir) == 0 {
+		return ""
+	}
+	return filepath.Join(b.hostConfig.SecretsRunDir, b.Program.Name+"-"+pinName(ifaceName)+"_"+direction)
+}
+
+// hasSecretFiles reports whether secrets are given to the program in its secrets directory
+func (b *BPF) hasSecretFiles() bool {
+	for _, s := range b.Program.Secrets {
+		if len(s.Env) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareSecrets writes the secrets of the program to its private secrets directory, a tmpfs only
+// accessible by the user of the program, before the program is started
+func (b *BPF) prepareSecrets(ifaceName, direction string) error {
+	b.secretsDir = ""
+	if !b.hasSecretFiles() {
+		return nil
+	}
+	dir := b.secretsPath(ifaceName, direction)
+	if len(dir) == 0 {
+		return fmt.Errorf("secrets of program %s need the secrets-run-dir of l3afd", b.Program.Name)
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	if b.Program.Security != nil {
+		spec, err := b.sandboxSpec()
+		if err != nil {
+			return err
+		}
+		if spec.UID != nil {
+			uid = *spec.UID
+		}
+		if spec.GID != nil {
+			gid = *spec.GID
+		}
+	}
+
+	// secrets left by a previous run are replaced
+	b.removeSecrets(ifaceName, direction)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory of program %s: %v", b.Program.Name, err)
+	}
+	if err := mountSecrets(dir, uid, gid); err != nil {
+		os.Remove(dir)
+		return fmt.Errorf("failed to mount secrets directory of program %s: %v", b.Program.Name, err)
+	}
+	for _, s := range b.Program.Secrets {
+		if len(s.Env) > 0 {
+			continue
+		}
+		data, err := b.readSecret(s)
+		if err == nil {
+			err = writeSecret(filepath.Join(dir, s.Name), data, uid, gid)
+		}
+		if err != nil {
+			b.removeSecrets(ifaceName, direction)
+			return err
+		}
+	}
+	b.secretsDir = dir
+	log.Info().Msgf("secrets of bpf program %s written to %s", b.Program.Name, dir)
+	return nil
+}
+
+func writeSecret(path string, data []byte, uid, gid int) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return fmt.Errorf("failed to write secret %s: %v", path, err)
+	}
+	defer f.Close()
+	if err := f.Chown(uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of secret %s: %v", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write secret %s: %v", path, err)
+	}
+	return nil
+}
+
+// removeSecrets unmounts and removes the secrets directory of the user program once it exited
+func (b *BPF) removeSecrets(ifaceName, direction string) {
+	dir := b.secretsPath(ifaceName, direction)
+	if len(dir) == 0 {
+		return
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return
+	}
+	if err := unmountSecrets(dir); err != nil {
+		log.Warn().Err(err).Msgf("failed to unmount secrets directory %s of bpf program %s", dir, b.Program.Name)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Warn().Err(err).Msgf("failed to remove secrets directory %s of bpf program %s", dir, b.Program.Name)
+	}
+}
+
+// RedactSecrets returns a copy of the programs with the secrets of the running programs replaced in
+// their args and env, for the responses of the config API
+func (c *NFConfigs) RedactSecrets(progs models.L3afBPFPrograms) models.L3afBPFPrograms {
+	secrets := &secretValues{}
+	for _, bpfLists := range c.directionBpfLists() {
+		for _, bpfList := range bpfLists {
+			if bpfList == nil {
+				continue
+			}
+			for e := bpfList.Front(); e != nil; e = e.Next() {
+				for _, v := range e.Value.(*BPF).secrets.list() {
+					secrets.add(v)
+				}
+			}
+		}
+	}
+	values := secrets.list()
+	if len(values) == 0 || progs.BpfPrograms == nil {
+		return progs
+	}
+
+	redacted := *progs.BpfPrograms
+	for _, list := range []*[]*models.BPFProgram{&redacted.XDPIngress, &redacted.TCIngress, &redacted.TCEgress,
+		&redacted.CgroupSKBIngress, &redacted.CgroupSKBEgress, &redacted.CgroupSockAddr, &redacted.SockOps,
+		&redacted.Kprobe, &redacted.Tracepoint, &redacted.Fentry} {
+		if *list == nil {
+			continue
+		}
+		programs := make([]*models.BPFProgram, 0, len(*list))
+		for _, p := range *list {
+			programs = append(programs, redactProgram(p, values))
+		}
+		*list = programs
+	}
+	progs.BpfPrograms = &redacted
+	return progs
+}
+
+// redactProgram returns a copy of the program with the secrets replaced in its args and env
+func redactProgram(p *models.BPFProgram, secrets []string) *models.BPFProgram {
+	redactArgs := func(args models.L3afDNFArgs) models.L3afDNFArgs {
+		if args == nil {
+			return nil
+		}
+		redacted := make(models.L3afDNFArgs, len(args))
+		for k, val := range args {
+			redacted[k] = redactValue(val, secrets)
+		}
+		return redacted
+	}
+
+	redacted := *p
+	redacted.StartArgs = redactArgs(p.StartArgs)
+	redacted.StopArgs = redactArgs(p.StopArgs)
+	redacted.StatusArgs = redactArgs(p.StatusArgs)
+	redacted.UpdateArgs = redactArgs(p.UpdateArgs)
+	redacted.MapArgs = redactArgs(p.MapArgs)
+	redacted.ConfigArgs = redactArgs(p.ConfigArgs)
+	if p.Env != nil {
+		redacted.Env = make(map[string]string, len(p.Env))
+		for k, v := range p.Env {
+			redacted.Env[k] = redactValue(v, secrets).(string)
+		}
+	}
+	return &redacted
+}
+
+// redactValue returns a copy of the argument value with the secrets replaced in its strings, down
+// to the elements of lists and objects
+func redactValue(value interface{}, secrets []string) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, secret := range secrets {
+			v = strings.ReplaceAll(v, secret, redactedValue)
+		}
+		return v
+	case []string:
+		redacted := make([]string, 0, len(v))
+		for _, e := range v {
+			redacted = append(redacted, redactValue(e, secrets).(string))
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			redacted = append(redacted, redactValue(e, secrets))
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			redacted[k] = redactValue(e, secrets)
+		}
+		return redacted
+	}
+	return value
+}
@@ -0,0 +1,188 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/rs/zerolog/log"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// TCX attach types, available from kernel 6.6 and missing in cilium/ebpf v0.10
+const (
+	attachTCXIngress = ebpf.AttachType(46)
+	attachTCXEgress  = ebpf.AttachType(47)
+)
+
+// tcDirection returns the TCX attach type and the clsact filter parent of the direction
+func tcDirection(direction string) (ebpf.AttachType, uint32, error) {
+	switch direction {
+	case models.IngressType:
+		return attachTCXIngress, netlink.HANDLE_MIN_INGRESS, nil
+	case models.EgressType:
+		return attachTCXEgress, netlink.HANDLE_MIN_EGRESS, nil
+	default:
+		return 0, 0, fmt.Errorf("unknown tc direction %s", direction)
+	}
+}
+
+// attachTC attaches the TC program to the interface through a TCX link pinned at linkPath. On
+// kernels without TCX, or when configured, the program is attached through a clsact filter.
+func (b *BPF) attachTC(native *nativeProgram, ifaceName, direction, linkPath string) error {
+	attachType, _, err := tcDirection(direction)
+	if err != nil {
+		return err
+	}
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %v", ifaceName, err)
+	}
+
+	mode := b.hostConfig.TCAttachMode
+	if mode != config.TCAttachNetlink {
+		l, err := link.AttachRawLink(link.RawLinkOptions{
+			Target:  iface.Index,
+			Program: native.program,
+			Attach:  attachType,
+		})
+		if err == nil {
+			native.link = l
+			if err := l.Pin(linkPath); err != nil {
+				return fmt.Errorf("failed to pin link of program %s at %s: %v", b.Program.Name, linkPath, err)
+			}
+			native.pinned = append(native.pinned, linkPath)
+			// The program may have been attached through a filter before the kernel upgrade
+			b.removeTCFilter(ifaceName, direction)
+			return nil
+		}
+		if mode == config.TCAttachTCX {
+			return fmt.Errorf("failed to attach TCX program %s to interface %s: %v", b.Program.Name, ifaceName, err)
+		}
+		log.Info().Err(err).Msgf("TCX is not available, attaching program %s through clsact filter", b.Program.Name)
+	}
+	return b.attachTCFilter(native, iface.Index, direction)
+}
+
+// attachTCFilter attaches the TC program through the clsact filter of l3afd, identified by the
+// configured priority and handle. The clsact qdisc is added unless the interface has one.
+func (b *BPF) attachTCFilter(native *nativeProgram, ifindex int, direction string) error {
+	_, parent, err := tcDirection(direction)
+	if err != nil {
+		return err
+	}
+	priority, handle := b.hostConfig.TCFilterPriority, b.hostConfig.TCFilterHandle
+	if priority < 1 || priority > 0xffff || handle < 1 {
+		return fmt.Errorf("invalid tc-attach priority %d or handle %d", priority, handle)
+	}
+
+	nlLink, err := netlink.LinkByIndex(ifindex)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %d: %v", ifindex, err)
+	}
+	if err := ensureClsact(nlLink); err != nil {
+		return err
+	}
+
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifindex,
+			Parent:    parent,
+			Handle:    uint32(handle),
+			Priority:  uint16(priority),
+			Protocol:  unix.ETH_P_ALL,
+		},
+		Fd:           native.program.FD(),
+		Name:         b.Program.Name,
+		DirectAction: true,
+	}
+	// Replacing the filter swaps the program of a previous l3afd instance atomically
+	if err := netlink.FilterReplace(filter); err != nil {
+		return fmt.Errorf("failed to attach clsact filter of program %s to interface %s: %v", b.Program.Name, nlLink.Attrs().Name, err)
+	}
+	native.filter = filter
+	return nil
+}
+
+// ensureClsact adds the clsact qdisc to the interface unless it has one
+func ensureClsact(nlLink netlink.Link) error {
+	qdiscs, err := netlink.QdiscList(nlLink)
+	if err != nil {
+		return fmt.Errorf("failed to list qdiscs of interface %s: %v", nlLink.Attrs().Name, err)
+	}
+	for _, qdisc := range qdiscs {
+		if qdisc.Type() == "clsact" {
+			return nil
+		}
+	}
+	clsact := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: nlLink.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscAdd(clsact); err != nil {
+		return fmt.Errorf("failed to add clsact qdisc to interface %s: %v", nlLink.Attrs().Name, err)
+	}
+	return nil
+}
+
+// tcFilter returns the clsact filter of l3afd on the interface, nil if there is none
+func (b *BPF) tcFilter(ifaceName, direction string) (*netlink.BpfFilter, error) {
+	_, parent, err := tcDirection(direction)
+	if err != nil {
+		return nil, err
+	}
+	nlLink, err := netlink.LinkByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface %s: %v", ifaceName, err)
+	}
+	filters, err := netlink.FilterList(nlLink, parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filters of interface %s: %v", ifaceName, err)
+	}
+	for _, f := range filters {
+		filter, ok := f.(*netlink.BpfFilter)
+		if ok && filter.Handle == uint32(b.hostConfig.TCFilterHandle) && filter.Priority == uint16(b.hostConfig.TCFilterPriority) {
+			return filter, nil
+		}
+	}
+	return nil, nil
+}
+
+// adoptTCFilter returns the ID of the program attached through the clsact filter of l3afd
+func (b *BPF) adoptTCFilter(native *nativeProgram, ifaceName, direction string) (ebpf.ProgramID, error) {
+	filter, err := b.tcFilter(ifaceName, direction)
+	if err != nil {
+		return 0, err
+	}
+	if filter == nil || filter.Id == 0 {
+		return 0, fmt.Errorf("no clsact filter on interface %s direction %s", ifaceName, direction)
+	}
+	native.filter = filter
+	return ebpf.ProgramID(filter.Id), nil
+}
+
+// removeTCFilter deletes the clsact filter of l3afd from the interface, if any
+func (b *BPF) removeTCFilter(ifaceName, direction string) {
+	filter, err := b.tcFilter(ifaceName, direction)
+	if err != nil || filter == nil {
+		return
+	}
+	if err := netlink.FilterDel(filter); err != nil {
+		log.Warn().Err(err).Msgf("failed to delete clsact filter of program %s", b.Program.Name)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/cilium/ebpf"
+	"github.com/vishvananda/netlink"
+)
+
+func Test_tcDirection(t *testing.T) {
+	tests := []struct {
+		direction      string
+		wantAttachType ebpf.AttachType
+		wantParent     uint32
+		wantErr        bool
+	}{
+		{direction: models.IngressType, wantAttachType: attachTCXIngress, wantParent: netlink.HANDLE_MIN_INGRESS},
+		{direction: models.EgressType, wantAttachType: attachTCXEgress, wantParent: netlink.HANDLE_MIN_EGRESS},
+		{direction: models.XDPIngressType, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			attachType, parent, err := tcDirection(tt.direction)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tcDirection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attachType != tt.wantAttachType || parent != tt.wantParent {
+				t.Errorf("tcDirection() = %v, %x, want %v, %x", attachType, parent, tt.wantAttachType, tt.wantParent)
+			}
+		})
+	}
+}
+
+func TestBPF_attachTCFilterInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority int
+		handle   int
+	}{
+		{name: "ZeroPriority", handle: 1},
+		{name: "PriorityOverflow", priority: 0x10000, handle: 1},
+		{name: "ZeroHandle", priority: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{
+				Program:    models.BPFProgram{Name: "foo", ProgType: models.TCType},
+				hostConfig: &config.Config{TCFilterPriority: tt.priority, TCFilterHandle: tt.handle},
+			}
+			if err := b.attachTCFilter(&nativeProgram{}, 1, models.IngressType); err == nil {
+				t.Errorf("attachTCFilter() accepted priority %d handle %d", tt.priority, tt.handle)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tracingHooks are the directions of the tracing programs
+var tracingHooks = []string{models.KprobeType, models.TracepointType, models.FentryType}
+
+// newTracingBpfs returns the empty program lists of all tracing hooks
+func newTracingBpfs() map[string]map[string]*list.List {
+	return newHookBpfs(tracingHooks)
+}
+
+// isTracing reports whether the program is attached to a kernel function or tracepoint rather
+// than an interface
+func (b *BPF) isTracing() bool {
+	switch b.Program.ProgType {
+	case models.KprobeType, models.TracepointType, models.FentryType:
+		return true
+	}
+	return false
+}
+
+// tracingPrograms returns the programs of the config per tracing hook
+func tracingPrograms(bpfProgs *models.BPFPrograms) map[string][]*models.BPFProgram {
+	return map[string][]*models.BPFProgram{
+		models.KprobeType:     bpfProgs.Kprobe,
+		models.TracepointType: bpfProgs.Tracepoint,
+		models.FentryType:     bpfProgs.Fentry,
+	}
+}
+
+// tracingProgramNames returns the program names of the config per tracing hook
+func tracingProgramNames(bpfProgs *models.BPFProgramNames) map[string][]string {
+	return map[string][]string{
+		models.KprobeType:     bpfProgs.Kprobe,
+		models.TracepointType: bpfProgs.Tracepoint,
+		models.FentryType:     bpfProgs.Fentry,
+	}
+}
+
+// verifyTracingConfig checks the host name, the attach target and that only tracing programs are
+// configured for the target. Tracepoints are named <group>/<name>, kprobe and fentry programs
+// are attached to a kernel function.
+func (c *NFConfigs) verifyTracingConfig(target, HostName string, bpfProgs *models.BPFPrograms) error {
+	if HostName != c.HostName {
+		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if bpfProgs == nil {
+		errOut := fmt.Errorf("attach target %s bpf programs are empty", target)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if len(bpfProgs.XDPIngress)+len(bpfProgs.TCIngress)+len(bpfProgs.TCEgress)+len(bpfProgs.CgroupSKBIngress)+
+		len(bpfProgs.CgroupSKBEgress)+len(bpfProgs.CgroupSockAddr)+len(bpfProgs.SockOps) > 0 {
+		errOut := fmt.Errorf("only tracing programs can be attached to attach target %s", target)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	isTracepoint := strings.Count(target, "/") == 1 && !strings.HasPrefix(target, "/") && !strings.HasSuffix(target, "/")
+	if len(bpfProgs.Tracepoint) > 0 && !isTracepoint {
+		errOut := fmt.Errorf("attach target %s of tracepoint programs is not <group>/<name>", target)
+		log.Error().Err(errOut)
+		return errOut
+	}
+	if len(bpfProgs.Kprobe)+len(bpfProgs.Fentry) > 0 && strings.Contains(target, "/") {
+		errOut := fmt.Errorf("attach target %s of kprobe and fentry programs is not a kernel function", target)
+		log.Error().Err(errOut)
+		return errOut
+	}
+	return nil
+}
+
+// DeployTracing starts, updates and stops the tracing programs of the attach target according to
+// the config
+func (c *NFConfigs) DeployTracing(target, HostName string, bpfProgs *models.BPFPrograms) error {
+	if err := c.verifyTracingConfig(target, HostName, bpfProgs); err != nil {
+		return err
+	}
+
+	progs := tracingPrograms(bpfProgs)
+	// The disabled programs may be starting, holding the lock until they are up
+	c.waits.abort(target, disabledProgramNames(progs))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.deployUnchained(target, tracingHooks, progs)
+}
+
+// AddTracingPrograms attaches the tracing programs to the attach target unless they are running
+func (c *NFConfigs) AddTracingPrograms(target, HostName string, bpfProgs *models.BPFPrograms) error {
+	if err := c.verifyTracingConfig(target, HostName, bpfProgs); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.addUnchained(target, tracingHooks, tracingPrograms(bpfProgs))
+}
+
+// DeleteTracingPrograms detaches the tracing programs from the attach target
+func (c *NFConfigs) DeleteTracingPrograms(target, HostName string, bpfProgs *models.BPFProgramNames) error {
+	if bpfProgs == nil {
+		errOut := fmt.Errorf("attach target %s bpf programs are empty", target)
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	if HostName != c.HostName {
+		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
+		log.Error().Err(errOut)
+		return errOut
+	}
+
+	names := tracingProgramNames(bpfProgs)
+	// The programs may be starting, holding the lock until they are up
+	c.waits.abort(target, names)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, direction := range tracingHooks {
+		sort.Strings(names[direction])
+		if err := c.stopUnchainedBPFs(target, direction, func(name string) bool {
+			return BinarySearch(names[direction], name)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopNRemoveAllTracingBPFs stops the tracing programs of the attach target
+func (c *NFConfigs) StopNRemoveAllTracingBPFs(target string) error {
+	return c.stopNRemoveAllUnchainedBPFs(target, tracingHooks)
+}
+
+// RemoveMissingTracingNBPFProgsInConfig - Stops the tracing programs which are missing in the config
+func (c *NFConfigs) RemoveMissingTracingNBPFProgsInConfig(bpfProgCfgs []models.L3afBPFPrograms) error {
+	tempTargets := map[string]bool{}
+	for _, bpfProgCfg := range bpfProgCfgs {
+		if len(bpfProgCfg.AttachTarget) == 0 || bpfProgCfg.BpfPrograms == nil {
+			continue
+		}
+		tempTargets[bpfProgCfg.AttachTarget] = true
+		c.removeMissingUnchainedBPFs(bpfProgCfg.AttachTarget, tracingHooks, tracingPrograms(bpfProgCfg.BpfPrograms))
+	}
+
+	for _, target := range c.tracingTargets {
+		if _, ok := tempTargets[target]; !ok {
+			log.Info().Msgf("Missing attach target %s in the configs, stopping", target)
+			if err := c.StopNRemoveAllTracingBPFs(target); err != nil {
+				log.Error().Err(err).Msgf("Failed to stop all the programs of attach target %s", target)
+			}
+			delete(c.tracingTargets, target)
+		}
+	}
+	return nil
+}
+
+// TracingEBPFPrograms - Method provides list of tracing eBPF Programs attached to the target
+func (c *NFConfigs) TracingEBPFPrograms(target string) models.L3afBPFPrograms {
+	progs := c.unchainedPrograms(target, tracingHooks)
+	return models.L3afBPFPrograms{
+		HostName:     c.HostName,
+		AttachTarget: target,
+		BpfPrograms: &models.BPFPrograms{
+			Kprobe:     progs[models.KprobeType],
+			Tracepoint: progs[models.TracepointType],
+			Fentry:     progs[models.FentryType],
+		},
+	}
+}
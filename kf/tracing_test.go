@@ -0,0 +1,110 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestNFConfigs_verifyTracingConfig(t *testing.T) {
+	kprobe := &models.BPFProgram{Name: "connect-trace", ProgType: models.KprobeType}
+	tracepoint := &models.BPFProgram{Name: "sched-trace", ProgType: models.TracepointType}
+	tests := []struct {
+		name     string
+		hostName string
+		target   string
+		bpfProgs *models.BPFPrograms
+		wantErr  bool
+	}{
+		{name: "Kprobe", hostName: machineHostname, target: "tcp_v4_connect", bpfProgs: &models.BPFPrograms{Kprobe: []*models.BPFProgram{kprobe}}},
+		{name: "Tracepoint", hostName: machineHostname, target: "sched/sched_switch", bpfProgs: &models.BPFPrograms{Tracepoint: []*models.BPFProgram{tracepoint}}},
+		{name: "NilPrograms", hostName: machineHostname, target: "tcp_v4_connect", wantErr: true},
+		{name: "OtherHost", hostName: "other", target: "tcp_v4_connect", bpfProgs: &models.BPFPrograms{Kprobe: []*models.BPFProgram{kprobe}}, wantErr: true},
+		{name: "TracepointWithoutGroup", hostName: machineHostname, target: "sched_switch", bpfProgs: &models.BPFPrograms{Tracepoint: []*models.BPFProgram{tracepoint}}, wantErr: true},
+		{name: "KprobeOnTracepoint", hostName: machineHostname, target: "sched/sched_switch", bpfProgs: &models.BPFPrograms{Kprobe: []*models.BPFProgram{kprobe}}, wantErr: true},
+		{name: "XDPProgram", hostName: machineHostname, target: "tcp_v4_connect", bpfProgs: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{kprobe}}, wantErr: true},
+		{name: "CgroupProgram", hostName: machineHostname, target: "tcp_v4_connect", bpfProgs: &models.BPFPrograms{SockOps: []*models.BPFProgram{kprobe}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NFConfigs{HostName: machineHostname}
+			if err := c.verifyTracingConfig(tt.target, tt.hostName, tt.bpfProgs); (err != nil) != tt.wantErr {
+				t.Errorf("verifyTracingConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNFConfigs_TracingEBPFPrograms(t *testing.T) {
+	target := "tcp_v4_connect"
+	kprobe := &BPF{Program: models.BPFProgram{Name: "connect-trace", ProgType: models.KprobeType}}
+	fentry := &BPF{Program: models.BPFProgram{Name: "connect-latency", ProgType: models.FentryType}}
+	c := &NFConfigs{HostName: machineHostname, TracingBpfs: newTracingBpfs()}
+	c.TracingBpfs[models.KprobeType][target] = list.New()
+	c.TracingBpfs[models.KprobeType][target].PushBack(kprobe)
+	c.TracingBpfs[models.FentryType][target] = list.New()
+	c.TracingBpfs[models.FentryType][target].PushBack(fentry)
+
+	want := models.L3afBPFPrograms{
+		HostName:     machineHostname,
+		AttachTarget: target,
+		BpfPrograms: &models.BPFPrograms{
+			Kprobe: []*models.BPFProgram{&kprobe.Program},
+			Fentry: []*models.BPFProgram{&fentry.Program},
+		},
+	}
+	if got := c.TracingEBPFPrograms(target); !reflect.DeepEqual(got, want) {
+		t.Errorf("TracingEBPFPrograms() = %#v, want %#v", got, want)
+	}
+	if bpf := c.unchainedBPF("connect-trace", target, models.KprobeType); bpf != kprobe {
+		t.Errorf("unchainedBPF() = %v, want %v", bpf, kprobe)
+	}
+}
+
+func TestNFConfigs_DeleteTracingEbpfPrograms(t *testing.T) {
+	target := "tcp_v4_connect"
+	tests := []struct {
+		name       string
+		remaining  bool
+		wantTarget bool
+	}{
+		{name: "LastProgram"},
+		{name: "RemainingProgram", remaining: true, wantTarget: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NFConfigs{
+				HostName:       machineHostname,
+				HostConfig:     &config.Config{L3afConfigStoreFileName: filepath.Join(t.TempDir(), "l3af-config.json")},
+				CgroupBpfs:     newCgroupBpfs(),
+				TracingBpfs:    newTracingBpfs(),
+				cgroups:        map[string]string{},
+				tracingTargets: map[string]string{target: target},
+				mu:             new(sync.Mutex),
+			}
+			if tt.remaining {
+				c.TracingBpfs[models.FentryType][target] = list.New()
+				c.TracingBpfs[models.FentryType][target].PushBack(&BPF{Program: models.BPFProgram{Name: "connect-latency", ProgType: models.FentryType}})
+			}
+			err := c.DeleteEbpfPrograms([]models.L3afBPFProgramNames{{
+				HostName:        machineHostname,
+				AttachTarget:    target,
+				BpfProgramNames: &models.BPFProgramNames{Kprobe: []string{"connect-trace"}},
+			}})
+			if err != nil {
+				t.Fatalf("DeleteEbpfPrograms() error = %v", err)
+			}
+			if _, ok := c.tracingTargets[target]; ok != tt.wantTarget {
+				t.Errorf("DeleteEbpfPrograms() attach target tracked = %v, want %v", ok, tt.wantTarget)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/cilium/ebpf/link"
+	"github.com/rs/zerolog/log"
+)
+
+// attachTracing attaches the program to the kernel function or tracepoint target. fentry links
+// are pinned at linkPath, kprobe and tracepoint links are perf events which can not be pinned,
+// these programs are detached when l3afd stops and attached again when it starts.
+func (b *BPF) attachTracing(native *nativeProgram, target, direction, linkPath string) error {
+	var l link.Link
+	var err error
+	switch direction {
+	case models.KprobeType:
+		l, err = link.Kprobe(target, native.program, nil)
+	case models.TracepointType:
+		group, name, ok := strings.Cut(target, "/")
+		if !ok {
+			return fmt.Errorf("tracepoint %s of program %s is not <group>/<name>", target, b.Program.Name)
+		}
+		l, err = link.Tracepoint(group, name, native.program, nil)
+	case models.FentryType:
+		l, err = link.AttachTracing(link.TracingOptions{Program: native.program})
+	default:
+		return fmt.Errorf("unknown tracing hook %s", direction)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to attach %s program %s to %s: %v", direction, b.Program.Name, target, err)
+	}
+	native.link = l
+
+	if err := l.Pin(linkPath); err != nil {
+		if !errors.Is(err, link.ErrNotSupported) {
+			return fmt.Errorf("failed to pin link of program %s at %s: %v", b.Program.Name, linkPath, err)
+		}
+		log.Debug().Msgf("%s link of program %s can not be pinned", direction, b.Program.Name)
+		return nil
+	}
+	native.pinned = append(native.pinned, linkPath)
+	return nil
+}
@@ -0,0 +1,340 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/l3af-project/l3afd/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Cgroup and tracing programs are attached side by side to their attach point, a cgroup path or
+// a kernel function, tracepoint. They are neither chained nor ordered, and no root program is
+// loaded. Their directions are the hooks of the attach point, which are distinct across the
+// categories.
+
+// newHookBpfs returns the empty program lists of the hooks
+func newHookBpfs(hooks []string) map[string]map[string]*list.List {
+	hookBpfs := make(map[string]map[string]*list.List, len(hooks))
+	for _, direction := range hooks {
+		hookBpfs[direction] = make(map[string]*list.List)
+	}
+	return hookBpfs
+}
+
+// unchainedProgType returns the program type attached to the hook
+func unchainedProgType(direction string) (string, error) {
+	switch direction {
+	case models.CgroupSKBIngressType, models.CgroupSKBEgressType:
+		return models.CgroupSKBType, nil
+	case models.CgroupSockAddrType, models.SockOpsType, models.KprobeType, models.TracepointType, models.FentryType:
+		return direction, nil
+	default:
+		return "", fmt.Errorf("unknown hook %s", direction)
+	}
+}
+
+// unchainedBpfs returns the program lists of the hook keyed by attach point
+func (c *NFConfigs) unchainedBpfs(direction string) map[string]*list.List {
+	if bpfLists, ok := c.CgroupBpfs[direction]; ok {
+		return bpfLists
+	}
+	return c.TracingBpfs[direction]
+}
+
+// isUnchained reports whether the program is attached to a cgroup or a tracing target rather
+// than chained on an interface
+func (b *BPF) isUnchained() bool {
+	return b.isCgroup() || b.isTracing()
+}
+
+// attachPointArg returns the argument passing the interface, cgroup or tracing target of the
+// program to the user program
+func (b *BPF) attachPointArg(attachPoint string) string {
+	if b.isCgroup() {
+		return "--cgroup-path=" + attachPoint
+	}
+	if b.isTracing() {
+		return "--attach-target=" + attachPoint
+	}
+	return "--iface=" + attachPoint
+}
+
+// pinName returns the interface name, cgroup path or tracing target as bpffs name, slashes and
+// dots are not allowed in bpffs names
+func pinName(attachPoint string) string {
+	return strings.NewReplacer("/", "_", ".", "_").Replace(strings.Trim(attachPoint, "/"))
+}
+
+// PushBackAndStartUnchainedBPF appends the program to the programs of the hook and starts it
+func (c *NFConfigs) PushBackAndStartUnchainedBPF(bpfProg *models.BPFProgram, attachPoint, direction string) error {
+	progType, err := unchainedProgType(direction)
+	if err != nil {
+		return err
+	}
+	if bpfProg.ProgType != progType {
+		return fmt.Errorf("program %s of type %s can not be attached to hook %s", bpfProg.Name, bpfProg.ProgType, direction)
+	}
+	if err := VerifyNMountBPFFS(); err != nil {
+		return fmt.Errorf("failed to mount bpf file system")
+	}
+
+	log.Info().Msgf("PushBackAndStartUnchainedBPF : attach point %s, direction %s", attachPoint, direction)
+	bpfLists := c.unchainedBpfs(direction)
+	if bpfLists[attachPoint] == nil {
+		bpfLists[attachPoint] = list.New()
+	}
+	bpf := c.newBPF(bpfProg)
+	bpfLists[attachPoint].PushBack(bpf)
+
+	if err := c.DownloadAndStartUnchainedBPF(bpf, attachPoint, direction); err != nil {
+		return fmt.Errorf("failed to download and start the BPF %s attach point %s direction %s: %v", bpfProg.Name, attachPoint, direction, err)
+	}
+	return nil
+}
+
+// DownloadAndStartUnchainedBPF fetches the artifact of the program and attaches it
+func (c *NFConfigs) DownloadAndStartUnchainedBPF(bpf *BPF, attachPoint, direction string) error {
+	if err := bpf.VerifyAndGetArtifacts(c.HostConfig); err != nil {
+		return fmt.Errorf("failed to get artifacts %s with error: %v", bpf.Program.Artifact, err)
+	}
+
+	if err := bpf.ApplyManifest(); err != nil {
+		return fmt.Errorf("failed to apply artifact manifest %s with error: %v", bpf.Program.Artifact, err)
+	}
+
+	if err := bpf.Start(attachPoint, direction, false); err != nil {
+		return fmt.Errorf("failed to start bpf program %s with error: %v", bpf.Program.Name, err)
+	}
+	return nil
+}
+
+// stopNRemoveUnchainedBPF stops the program and removes it from the programs of the hook
+func (c *NFConfigs) stopNRemoveUnchainedBPF(e *list.Element, attachPoint, direction string) error {
+	bpfLists := c.unchainedBpfs(direction)
+	prog := e.Value.(*BPF)
+	prog.Program.AdminStatus = models.Disabled
+	if err := prog.Stop(attachPoint, direction, false); err != nil {
+		return fmt.Errorf("failed to stop %s attach point %s direction %s", prog.Program.Name, attachPoint, direction)
+	}
+	bpfLists[attachPoint].Remove(e)
+	if bpfLists[attachPoint].Len() == 0 {
+		bpfLists[attachPoint] = nil
+	}
+	return nil
+}
+
+// VerifyNUpdateUnchainedBPF - This method checks the following conditions
+// 1. BPF Program already running with no change
+// 2. BPF Program running but needs to stop (admin_status == disabled)
+// 3. BPF Program running but needs version update
+// 4. BPF Program not running but needs to start.
+// 5. BPF Program running but map args change, will update the map values (i.e. Array and Hash maps only)
+// 6. BPF Program running but update args change, will invoke cmd_update with additional option --cmd=update
+func (c *NFConfigs) VerifyNUpdateUnchainedBPF(bpfProg *models.BPFProgram, attachPoint, direction string) error {
+	if bpfProg == nil {
+		return nil
+	}
+
+	var e *list.Element
+	if bpfList := c.unchainedBpfs(direction)[attachPoint]; bpfList != nil {
+		for e = bpfList.Front(); e != nil; e = e.Next() {
+			if e.Value.(*BPF).Program.Name == bpfProg.Name {
+				break
+			}
+		}
+	}
+
+	if e == nil {
+		if bpfProg.AdminStatus != models.Enabled {
+			return nil
+		}
+		return c.PushBackAndStartUnchainedBPF(bpfProg, attachPoint, direction)
+	}
+
+	data := e.Value.(*BPF)
+	// Fill in the fields declared by the manifest of the running version, so they are not mistaken for changes
+	if data.Manifest != nil && data.Program.Version == bpfProg.Version {
+		if err := data.Manifest.Apply(bpfProg); err != nil {
+			return fmt.Errorf("BPF %s does not match its artifact manifest: %v", bpfProg.Name, err)
+		}
+	}
+
+	if reflect.DeepEqual(data.Program, *bpfProg) {
+		// Nothing to do
+		return nil
+	}
+
+	// Admin status change - disabled
+	if data.Program.AdminStatus != bpfProg.AdminStatus {
+		log.Info().Msgf("VerifyNUpdateUnchainedBPF : admin_status change detected - disabling the program %s", data.Program.Name)
+		return c.stopNRemoveUnchainedBPF(e, attachPoint, direction)
+	}
+
+	// Version Change
+	if data.Program.Version != bpfProg.Version || !reflect.DeepEqual(data.Program.StartArgs, bpfProg.StartArgs) {
+		log.Info().Msgf("VerifyNUpdateUnchainedBPF : version update initiated - current version %s new version %s", data.Program.Version, bpfProg.Version)
+
+		if err := data.Stop(attachPoint, direction, false); err != nil {
+			return fmt.Errorf("failed to stop older version of BPF %s attach point %s direction %s version %s", bpfProg.Name, attachPoint, direction, bpfProg.Version)
+		}
+
+		data.Program = *bpfProg
+
+		if err := c.DownloadAndStartUnchainedBPF(data, attachPoint, direction); err != nil {
+			return fmt.Errorf("failed to download and start newer version of BPF %s version %s attach point %s direction %s: %v", bpfProg.Name, bpfProg.Version, attachPoint, direction, err)
+		}
+		return nil
+	}
+
+	// monitor maps change
+	if !reflect.DeepEqual(data.Program.MonitorMaps, bpfProg.MonitorMaps) {
+		log.Info().Msgf("monitor map list is mismatch - updated")
+		data.Program.MonitorMaps = bpfProg.MonitorMaps
+	}
+
+	// Update CfgVersion and SeqID, the programs are not ordered
+	data.Program.CfgVersion = bpfProg.CfgVersion
+	data.Program.SeqID = bpfProg.SeqID
+
+	// map arguments change - basically any config change to ebpf program updating config maps
+	if !reflect.DeepEqual(data.Program.MapArgs, bpfProg.MapArgs) {
+		log.Info().Msg("maps_args are mismatched")
+		data.Program.MapArgs = bpfProg.MapArgs
+		data.UpdateBPFMaps(attachPoint, direction)
+	}
+
+	// update arguments change - basically any config change to ebpf program config maps using user program
+	if !reflect.DeepEqual(data.Program.UpdateArgs, bpfProg.UpdateArgs) {
+		log.Info().Msg("update_args are mismatched")
+		data.Program.UpdateArgs = bpfProg.UpdateArgs
+		data.UpdateArgs(attachPoint, direction)
+	}
+
+	return nil
+}
+
+// deployUnchained starts, updates and stops the programs of the hooks on the attach point, the
+// caller must hold c.mu
+func (c *NFConfigs) deployUnchained(attachPoint string, hooks []string, progs map[string][]*models.BPFProgram) error {
+	for _, direction := range hooks {
+		for _, bpfProg := range progs[direction] {
+			if err := c.VerifyNUpdateUnchainedBPF(bpfProg, attachPoint, direction); err != nil {
+				return fmt.Errorf("failed to update %s BPF Program: %v", direction, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addUnchained starts the programs of the hooks on the attach point unless they are running, the
+// caller must hold c.mu
+func (c *NFConfigs) addUnchained(attachPoint string, hooks []string, progs map[string][]*models.BPFProgram) error {
+	for _, direction := range hooks {
+		for _, bpfProg := range progs[direction] {
+			if bpfProg.AdminStatus == models.Disabled {
+				continue
+			}
+			if c.unchainedBPF(bpfProg.Name, attachPoint, direction) != nil {
+				log.Warn().Msgf("%v is already running on %v and in %v direction ", bpfProg.Name, attachPoint, direction)
+				continue
+			}
+			if err := c.PushBackAndStartUnchainedBPF(bpfProg, attachPoint, direction); err != nil {
+				return fmt.Errorf("failed to PushBackAndStartUnchainedBPF BPF Program: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// unchainedBPF returns the program of the hook on the attach point, nil if it is not running
+func (c *NFConfigs) unchainedBPF(name, attachPoint, direction string) *BPF {
+	bpfList := c.unchainedBpfs(direction)[attachPoint]
+	if bpfList == nil {
+		return nil
+	}
+	for e := bpfList.Front(); e != nil; e = e.Next() {
+		if bpf := e.Value.(*BPF); bpf.Program.Name == name {
+			return bpf
+		}
+	}
+	return nil
+}
+
+// stopUnchainedBPFs stops and removes the programs of the hook on the attach point matching the
+// name filter
+func (c *NFConfigs) stopUnchainedBPFs(attachPoint, direction string, match func(name string) bool) error {
+	bpfList := c.unchainedBpfs(direction)[attachPoint]
+	if bpfList == nil {
+		return nil
+	}
+	for e := bpfList.Front(); e != nil; {
+		next := e.Next()
+		if match(e.Value.(*BPF).Program.Name) {
+			if err := c.stopNRemoveUnchainedBPF(e, attachPoint, direction); err != nil {
+				return err
+			}
+		}
+		e = next
+	}
+	return nil
+}
+
+// stopNRemoveAllUnchainedBPFs stops the programs of all hooks on the attach point
+func (c *NFConfigs) stopNRemoveAllUnchainedBPFs(attachPoint string, hooks []string) error {
+	for _, direction := range hooks {
+		if err := c.stopUnchainedBPFs(attachPoint, direction, func(string) bool { return true }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMissingUnchainedBPFs stops the programs of the hooks on the attach point which are missing
+// in the config
+func (c *NFConfigs) removeMissingUnchainedBPFs(attachPoint string, hooks []string, progs map[string][]*models.BPFProgram) {
+	for _, direction := range hooks {
+		if err := c.stopUnchainedBPFs(attachPoint, direction, func(name string) bool {
+			for _, bpfProg := range progs[direction] {
+				if bpfProg.Name == name {
+					return false
+				}
+			}
+			log.Info().Msgf("eBPF Program not found in config stopping - %s direction %s", name, direction)
+			return true
+		}); err != nil {
+			log.Error().Err(err).Msgf("Failed to stop missing program for %s direction %s", attachPoint, direction)
+		}
+	}
+}
+
+// hasUnchainedBPFs reports whether programs of the hooks are attached to the attach point
+func (c *NFConfigs) hasUnchainedBPFs(attachPoint string, hooks []string) bool {
+	for _, direction := range hooks {
+		if bpfList := c.unchainedBpfs(direction)[attachPoint]; bpfList != nil && bpfList.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// unchainedPrograms returns the programs of the hooks on the attach point
+func (c *NFConfigs) unchainedPrograms(attachPoint string, hooks []string) map[string][]*models.BPFProgram {
+	progs := make(map[string][]*models.BPFProgram, len(hooks))
+	for _, direction := range hooks {
+		bpfList := c.unchainedBpfs(direction)[attachPoint]
+		if bpfList == nil {
+			continue
+		}
+		for e := bpfList.Front(); e != nil; e = e.Next() {
+			progs[direction] = append(progs[direction], &e.Value.(*BPF).Program)
+		}
+	}
+	return progs
+}
@@ -0,0 +1,81 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_unchainedProgType(t *testing.T) {
+	tests := []struct {
+		direction string
+		want      string
+		wantErr   bool
+	}{
+		{direction: models.CgroupSKBIngressType, want: models.CgroupSKBType},
+		{direction: models.CgroupSKBEgressType, want: models.CgroupSKBType},
+		{direction: models.CgroupSockAddrType, want: models.CgroupSockAddrType},
+		{direction: models.SockOpsType, want: models.SockOpsType},
+		{direction: models.KprobeType, want: models.KprobeType},
+		{direction: models.TracepointType, want: models.TracepointType},
+		{direction: models.FentryType, want: models.FentryType},
+		{direction: models.XDPIngressType, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			got, err := unchainedProgType(tt.direction)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unchainedProgType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("unchainedProgType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPF_attachPointArg(t *testing.T) {
+	tests := []struct {
+		name        string
+		progType    string
+		attachPoint string
+		want        string
+	}{
+		{name: "XDP", progType: models.XDPType, attachPoint: "eth0", want: "--iface=eth0"},
+		{name: "TC", progType: models.TCType, attachPoint: "eth0", want: "--iface=eth0"},
+		{name: "CgroupSKB", progType: models.CgroupSKBType, attachPoint: "/sys/fs/cgroup/app", want: "--cgroup-path=/sys/fs/cgroup/app"},
+		{name: "SockOps", progType: models.SockOpsType, attachPoint: "/sys/fs/cgroup/app", want: "--cgroup-path=/sys/fs/cgroup/app"},
+		{name: "Kprobe", progType: models.KprobeType, attachPoint: "tcp_v4_connect", want: "--attach-target=tcp_v4_connect"},
+		{name: "Tracepoint", progType: models.TracepointType, attachPoint: "sched/sched_switch", want: "--attach-target=sched/sched_switch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: models.BPFProgram{ProgType: tt.progType}}
+			if got := b.attachPointArg(tt.attachPoint); got != tt.want {
+				t.Errorf("attachPointArg() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pinName(t *testing.T) {
+	tests := []struct {
+		attachPoint string
+		want        string
+	}{
+		{attachPoint: "eth0", want: "eth0"},
+		{attachPoint: "eth0.100", want: "eth0_100"},
+		{attachPoint: "/sys/fs/cgroup/kubepods.slice/pod1/", want: "sys_fs_cgroup_kubepods_slice_pod1"},
+		{attachPoint: "sched/sched_switch", want: "sched_sched_switch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attachPoint, func(t *testing.T) {
+			if got := pinName(tt.attachPoint); got != tt.want {
+				t.Errorf("pinName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
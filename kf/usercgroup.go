@@ -0,0 +1,219 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/stats"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cgroupCPUPeriod is the cpu.max period in microseconds, the CPU of programs is in millicores
+const cgroupCPUPeriod = 100000
+
+// userCgroupControllers are enabled for the cgroups of the user programs
+var userCgroupControllers = []string{"cpu", "memory", "io", "pids"}
+
+// userCgroupPath returns the cgroup v2 of the user program attached to the attach point, empty when
+// user programs are not isolated in cgroups
+func (b *BPF) userCgroupPath(ifaceName, direction string) string {
+	if b.hostConfig == nil || len(b.hostConfig.UserCgroupSlice) == 0 {
+		return ""
+	}
+	return filepath.Join(b.hostConfig.UserCgroupRoot, b.hostConfig.UserCgroupSlice, b.Program.Name+"-"+pinName(ifaceName)+"_"+direction)
+}
+
+// cgroupLimits returns the cgroup v2 interface files limiting the user program and their values
+func cgroupLimits(prog models.BPFProgram) map[string]string {
+	limits := map[string]string{
+		"memory.max": "max",
+		"cpu.max":    "max " + strconv.Itoa(cgroupCPUPeriod),
+		"pids.max":   "max",
+	}
+	if prog.Memory > 0 {
+		limits["memory.max"] = strconv.Itoa(prog.Memory)
+	}
+	if prog.CPU > 0 {
+		limits["cpu.max"] = strconv.Itoa(prog.CPU*cgroupCPUPeriod/1000) + " " + strconv.Itoa(cgroupCPUPeriod)
+	}
+	if prog.PidsMax > 0 {
+		limits["pids.max"] = strconv.Itoa(prog.PidsMax)
+	}
+	if prog.IOWeight > 0 {
+		limits["io.weight"] = "default " + strconv.Itoa(prog.IOWeight)
+	}
+	return limits
+}
+
+// cgroupV2Available reports whether the cgroup v2 unified hierarchy is mounted at the root
+func cgroupV2Available(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	return err == nil
+}
+
+// createUserCgroup creates the cgroup of the user program under the slice and applies the limits
+func createUserCgroup(root, path string, limits map[string]string) error {
+	// controllers are enabled from the root down to the slice, the parent of the program cgroup
+	parent := root
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("cgroup %s is not under %s", path, root)
+	}
+	dirs := []string{}
+	if rel != "." {
+		dirs = strings.Split(rel, string(filepath.Separator))
+	}
+	for i := 0; ; i++ {
+		for _, controller := range userCgroupControllers {
+			if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+controller), 0644); err != nil {
+				log.Debug().Err(err).Msgf("failed to enable controller %s in cgroup %s", controller, parent)
+			}
+		}
+		if i == len(dirs) {
+			break
+		}
+		parent = filepath.Join(parent, dirs[i])
+		if err := os.Mkdir(parent, 0755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to create cgroup %s: %v", parent, err)
+		}
+	}
+
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cgroup %s: %v", path, err)
+	}
+	for file, value := range limits {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value), 0644); err != nil {
+			return fmt.Errorf("failed to set %s of cgroup %s to %s: %v", file, path, value, err)
+		}
+	}
+	return nil
+}
+
+// validateResourceLimits checks the resource limits of the program can be applied. The CPU of a
+// daemon is only limited by its cgroup v2, in millicores, the program is rejected rather than left
+// unlimited without cgroup v2.
+func (b *BPF) validateResourceLimits() error {
+	if b.Program.CPU < 0 || b.Program.Memory < 0 || b.Program.PidsMax < 0 {
+		return fmt.Errorf("negative resource limits of program %s", b.Program.Name)
+	}
+	if b.Program.CPU == 0 || !b.Program.UserProgramDaemon || b.isNative() {
+		return nil
+	}
+	if b.hostConfig == nil || len(b.hostConfig.UserCgroupSlice) == 0 || !cgroupV2Available(b.hostConfig.UserCgroupRoot) {
+		return fmt.Errorf("cpu limit of program %s requires cgroup v2 and a cgroup-slice, cpu is in millicores of cpu.max rather than seconds of RLIMIT_CPU", b.Program.Name)
+	}
+	return nil
+}
+
+// userCgroup creates the cgroup v2 of the user program about to start, limited by the CPU, Memory,
+// IOWeight and PidsMax of the program. The program joins it before it is executed. No cgroup is
+// returned without cgroup v2, only the memory is then limited by prlimit once the program started,
+// and programs with a CPU limit fail to start.
+func (b *BPF) userCgroup(ifaceName, direction string) (string, error) {
+	if err := b.validateResourceLimits(); err != nil {
+		return "", err
+	}
+	path := b.userCgroupPath(ifaceName, direction)
+	if len(path) == 0 || !cgroupV2Available(b.hostConfig.UserCgroupRoot) {
+		return "", nil
+	}
+	if err := createUserCgroup(b.hostConfig.UserCgroupRoot, path, cgroupLimits(b.Program)); err != nil {
+		return "", fmt.Errorf("failed to set resource limits of bpf program %s: %v", b.Program.Name, err)
+	}
+	return path, nil
+}
+
+// setPrLimits limits the memory of the started user program which has no cgroup
+func (b *BPF) setPrLimits() {
+	if err := b.SetPrLimits(); err != nil {
+		log.Warn().Err(err).Msgf("failed to set resource limits of bpf program %s", b.Program.Name)
+	}
+}
+
+// removeUserCgroup removes the cgroup of the user program once it exited
+func (b *BPF) removeUserCgroup(ifaceName, direction string) {
+	path := b.userCgroupPath(ifaceName, direction)
+	if len(path) == 0 {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msgf("failed to remove cgroup %s of bpf program %s", path, b.Program.Name)
+	}
+}
+
+// cgroupUsage is the resource usage of the cgroup of a user program
+type cgroupUsage struct {
+	memoryBytes float64
+	cpuSeconds  float64
+	pids        float64
+}
+
+// readCgroupUsage reads memory.current, the usage_usec of cpu.stat and pids.current of the cgroup
+func readCgroupUsage(path string) (cgroupUsage, error) {
+	var usage cgroupUsage
+	memory, err := readCgroupValue(filepath.Join(path, "memory.current"))
+	if err != nil {
+		return usage, err
+	}
+	pids, err := readCgroupValue(filepath.Join(path, "pids.current"))
+	if err != nil {
+		return usage, err
+	}
+	cpuStat, err := os.ReadFile(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		return usage, fmt.Errorf("failed to read cpu.stat of cgroup %s: %v", path, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(cpuStat))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "usage_usec" {
+			usec, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return usage, fmt.Errorf("invalid usage_usec %s of cgroup %s", fields[1], path)
+			}
+			usage.cpuSeconds = usec / 1e6
+		}
+	}
+	usage.memoryBytes, usage.pids = memory, pids
+	return usage, nil
+}
+
+func readCgroupValue(file string) (float64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value of %s: %v", file, err)
+	}
+	return value, nil
+}
+
+// MonitorCgroup exports the resource usage of the cgroup of the user program
+func (b *BPF) MonitorCgroup(ifaceName, direction string) {
+	if b.Cmd == nil || !b.Program.UserProgramDaemon {
+		return
+	}
+	path := b.userCgroupPath(ifaceName, direction)
+	if len(path) == 0 {
+		return
+	}
+	usage, err := readCgroupUsage(path)
+	if err != nil {
+		log.Debug().Err(err).Msgf("no cgroup usage of bpf program %s", b.Program.Name)
+		return
+	}
+	stats.SetWithVersion(usage.memoryBytes, stats.NFMemoryUsage, b.Program.Name, b.Program.Version, direction, ifaceName)
+	stats.SetWithVersion(usage.cpuSeconds, stats.NFCPUUsage, b.Program.Name, b.Program.Version, direction, ifaceName)
+	stats.SetWithVersion(usage.pids, stats.NFPidsCount, b.Program.Name, b.Program.Version, direction, ifaceName)
+}
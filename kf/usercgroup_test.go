@@ -0,0 +1,169 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_userCgroupPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		hostConfig *config.Config
+		want       string
+	}{
+		{name: "NoConfig"},
+		{name: "NoSlice", hostConfig: &config.Config{UserCgroupRoot: "/sys/fs/cgroup"}},
+		{
+			name:       "Slice",
+			hostConfig: &config.Config{UserCgroupRoot: "/sys/fs/cgroup", UserCgroupSlice: "l3afd.slice"},
+			want:       "/sys/fs/cgroup/l3afd.slice/foo-eth0_ingress",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: models.BPFProgram{Name: "foo"}, hostConfig: tt.hostConfig}
+			if got := b.userCgroupPath("eth0", models.IngressType); got != tt.want {
+				t.Errorf("userCgroupPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		prog models.BPFProgram
+		want map[string]string
+	}{
+		{
+			name: "Unlimited",
+			want: map[string]string{"memory.max": "max", "cpu.max": "max 100000", "pids.max": "max"},
+		},
+		{
+			name: "Limited",
+			prog: models.BPFProgram{CPU: 250, Memory: 1 << 20, IOWeight: 50, PidsMax: 16},
+			want: map[string]string{"memory.max": "1048576", "cpu.max": "25000 100000", "pids.max": "16", "io.weight": "default 50"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cgroupLimits(tt.prog); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cgroupLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateUserCgroup(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "l3afd.slice", "foo-eth0_ingress")
+	if err := createUserCgroup(root, path, map[string]string{"pids.max": "16"}); err != nil {
+		t.Fatalf("createUserCgroup() error = %v", err)
+	}
+	for _, file := range []string{
+		filepath.Join(root, "cgroup.subtree_control"),
+		filepath.Join(root, "l3afd.slice", "cgroup.subtree_control"),
+	} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("controllers not enabled in %s: %v", file, err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(path, "pids.max")); string(got) != "16" {
+		t.Errorf("pids.max = %s, want 16", got)
+	}
+	if err := createUserCgroup(root, filepath.Join(t.TempDir(), "foo"), nil); err == nil {
+		t.Errorf("createUserCgroup() outside of the root succeeded, want error")
+	}
+}
+
+func TestBPF_validateResourceLimits(t *testing.T) {
+	cgroupV2 := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cgroupV2, "cgroup.controllers"), []byte("cpu memory io pids"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		prog       models.BPFProgram
+		hostConfig *config.Config
+		wantErr    bool
+	}{
+		{name: "NoCPU", prog: models.BPFProgram{UserProgramDaemon: true, Memory: 1 << 20}, hostConfig: &config.Config{}},
+		{name: "CgroupV2", prog: models.BPFProgram{UserProgramDaemon: true, CPU: 500}, hostConfig: &config.Config{UserCgroupRoot: cgroupV2, UserCgroupSlice: "l3afd.slice"}},
+		{name: "NotDaemon", prog: models.BPFProgram{CPU: 500}, hostConfig: &config.Config{}},
+		{name: "NoCgroupV2", prog: models.BPFProgram{UserProgramDaemon: true, CPU: 500}, hostConfig: &config.Config{UserCgroupRoot: t.TempDir(), UserCgroupSlice: "l3afd.slice"}, wantErr: true},
+		{name: "NoSlice", prog: models.BPFProgram{UserProgramDaemon: true, CPU: 500}, hostConfig: &config.Config{UserCgroupRoot: cgroupV2}, wantErr: true},
+		{name: "Negative", prog: models.BPFProgram{UserProgramDaemon: true, PidsMax: -1}, hostConfig: &config.Config{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: tt.prog, hostConfig: tt.hostConfig}
+			if err := b.validateResourceLimits(); (err != nil) != tt.wantErr {
+				t.Errorf("validateResourceLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBPF_userCgroup(t *testing.T) {
+	root := t.TempDir()
+	b := &BPF{
+		Program:    models.BPFProgram{Name: "foo", PidsMax: 16, UserProgramDaemon: true},
+		hostConfig: &config.Config{UserCgroupRoot: root, UserCgroupSlice: "l3afd.slice"},
+	}
+	// cgroup v2 is not mounted at the root
+	if got, err := b.userCgroup("eth0", models.IngressType); err != nil || len(got) != 0 {
+		t.Errorf("userCgroup() = %q, %v without cgroup v2, want none", got, err)
+	}
+	b.Program.CPU = 500
+	if _, err := b.userCgroup("eth0", models.IngressType); err == nil {
+		t.Errorf("userCgroup() with a cpu limit without cgroup v2 succeeded, want error")
+	}
+	b.Program.CPU = 0
+
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory io pids"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.userCgroup("eth0", models.IngressType)
+	if err != nil {
+		t.Fatalf("userCgroup() error = %v", err)
+	}
+	if want := filepath.Join(root, "l3afd.slice", "foo-eth0_ingress"); got != want {
+		t.Errorf("userCgroup() = %q, want %q", got, want)
+	}
+	if limit, _ := os.ReadFile(filepath.Join(got, "pids.max")); string(limit) != "16" {
+		t.Errorf("pids.max = %s, want 16", limit)
+	}
+}
+
+func TestReadCgroupUsage(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{
+		"memory.current": "4096\n",
+		"pids.current":   "2\n",
+		"cpu.stat":       "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n",
+	}
+	for file, data := range files {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := readCgroupUsage(path)
+	if err != nil {
+		t.Fatalf("readCgroupUsage() error = %v", err)
+	}
+	want := cgroupUsage{memoryBytes: 4096, cpuSeconds: 1.5, pids: 2}
+	if got != want {
+		t.Errorf("readCgroupUsage() = %+v, want %+v", got, want)
+	}
+	if _, err := readCgroupUsage(t.TempDir()); err == nil {
+		t.Errorf("readCgroupUsage() of an empty cgroup succeeded, want error")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// waitPollInterval is the interval of the checks of conditions without notifications
+	waitPollInterval = 100 * time.Millisecond
+	// waitWatchInterval is the interval of the checks of conditions on watched directories, in
+	// case a notification is missed
+	waitWatchInterval = time.Second
+)
+
+// waitTimeout returns how long the program is waited for, to pin or remove its maps for instance
+func (b *BPF) waitTimeout() time.Duration {
+	if b.Program.WaitTimeout > 0 {
+		return time.Duration(b.Program.WaitTimeout) * time.Second
+	}
+	if b.hostConfig != nil {
+		return b.hostConfig.BPFWaitTimeout
+	}
+	return 0
+}
+
+// waitContext is the context of the waits of a program, a child of the context of l3afd. The
+// waits of a start are cancelled by a delete of the program, see waitRegistry.
+type waitContext struct {
+	mu         sync.Mutex
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+// context returns the context of the waits, created from the parent after a cancel
+func (w *waitContext) context(parent context.Context) context.Context {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ctx == nil {
+		if parent == nil {
+			parent = context.Background()
+		}
+		w.ctx, w.cancelFunc = context.WithCancel(parent)
+	}
+	return w.ctx
+}
+
+// cancel fails the waits in progress, the following waits get a new context
+func (w *waitContext) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelFunc != nil {
+		w.cancelFunc()
+	}
+	w.ctx, w.cancelFunc = nil, nil
+}
+
+// abort fails the waits in progress and the following ones, until the next cancel
+func (w *waitContext) abort() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ctx == nil {
+		w.ctx, w.cancelFunc = context.WithCancel(context.Background())
+	}
+	w.cancelFunc()
+}
+
+// waitRegistry holds the wait contexts of the programs being started, by attach point, direction
+// and name. A start waits holding NFConfigs.mu, so a delete aborts the waits of the programs it
+// removes before it takes the lock.
+type waitRegistry struct {
+	mu    sync.Mutex
+	waits map[string]*waitContext
+}
+
+func newWaitRegistry() *waitRegistry {
+	return &waitRegistry{waits: make(map[string]*waitContext)}
+}
+
+// waitKey returns the key of the waits of a program in the registry
+func waitKey(attachPoint, direction, name string) string {
+	return strings.Join([]string{attachPoint, direction, name}, "\x00")
+}
+
+// add registers the wait context under the key, until the returned function is called
+func (r *waitRegistry) add(key string, w *waitContext) func() {
+	if r == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waits[key] = w
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.waits[key] == w {
+			delete(r.waits, key)
+		}
+	}
+}
+
+// abort fails the waits registered under the keys of the names of each direction
+func (r *waitRegistry) abort(attachPoint string, names map[string][]string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for direction, dirNames := range names {
+		for _, name := range dirNames {
+			if w, ok := r.waits[waitKey(attachPoint, direction, name)]; ok {
+				log.Info().Msgf("aborting the start of program %s on %s %s", name, attachPoint, direction)
+				w.abort()
+			}
+		}
+	}
+}
+
+// startWaits registers the waits of a start of the program, the returned function releases them
+func (b *BPF) startWaits(ifaceName, direction string) func() {
+	remove := b.waits.add(waitKey(ifaceName, direction, b.Program.Name), &b.waitCtx)
+	return func() {
+		remove()
+		b.waitCtx.cancel()
+	}
+}
+
+// waitFor waits until done returns true, the wait timeout of the program expires or its start is
+// aborted. Done is checked again on every change of the parent directories of the
+// paths, and periodically. It returns the last error of done on timeout.
+func (b *BPF) waitFor(what string, done func() (bool, error), paths ...string) error {
+	ok, err := done()
+	if ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(b.waitCtx.context(b.Ctx), b.waitTimeout())
+	defer cancel()
+
+	interval := waitPollInterval
+	var events <-chan struct{}
+	if dirs := existingDirs(paths); len(dirs) > 0 {
+		var stop func()
+		var watchErr error
+		if events, stop, watchErr = watchDirs(dirs); watchErr == nil {
+			defer stop()
+			interval = waitWatchInterval
+		} else {
+			log.Debug().Err(watchErr).Msgf("polling for %s of program %s", what, b.Program.Name)
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				return fmt.Errorf("wait for %s of program %s cancelled", what, b.Program.Name)
+			}
+			return fmt.Errorf("timed out after %s waiting for %s of program %s, %v", b.waitTimeout(), what, b.Program.Name, err)
+		case <-events:
+		case <-ticker.C:
+		}
+		if ok, err = done(); ok {
+			return nil
+		}
+	}
+}
+
+// existingDirs returns the parent directories of the paths which exist
+func existingDirs(paths []string) []string {
+	dirs := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if len(path) == 0 || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,153 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_waitFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  bool
+		cancel  bool
+		abort   bool
+		timeout time.Duration
+		wantErr bool
+	}{
+		{name: "Created", create: true, timeout: 5 * time.Second},
+		{name: "Timeout", timeout: 200 * time.Millisecond, wantErr: true},
+		{name: "Cancelled", cancel: true, timeout: 5 * time.Second, wantErr: true},
+		{name: "Aborted", abort: true, timeout: 5 * time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "foo_next_prog_array")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			b := &BPF{Program: models.BPFProgram{Name: "foo"}, Ctx: ctx, hostConfig: &config.Config{BPFWaitTimeout: tt.timeout}}
+
+			create, cancelled, aborted := tt.create, tt.cancel, tt.abort
+			timer := time.AfterFunc(50*time.Millisecond, func() {
+				if create {
+					_ = os.WriteFile(path, nil, 0600)
+				}
+				if cancelled {
+					cancel()
+				}
+				if aborted {
+					b.waitCtx.abort()
+				}
+			})
+			defer timer.Stop()
+			start := time.Now()
+			err := b.waitFor("pinned map", func() (bool, error) {
+				_, err := os.Stat(path)
+				return err == nil, err
+			}, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("waitFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// notified by the watch of the directory rather than by its periodic check
+			if elapsed := time.Since(start); elapsed >= waitWatchInterval {
+				t.Errorf("waitFor() returned after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestNFConfigs_DeleteWhileStarting(t *testing.T) {
+	tests := []struct {
+		name          string
+		deleteIface   string
+		wantCancelled bool
+	}{
+		{name: "Deleted", deleteIface: "eth0", wantCancelled: true},
+		{name: "OtherInterface", deleteIface: "eth1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NFConfigs{
+				HostName:       "l3af-test-host",
+				hostInterfaces: map[string]bool{"eth0": true, "eth1": true},
+				IngressXDPBpfs: make(map[string]*list.List),
+				IngressTCBpfs:  make(map[string]*list.List),
+				EgressTCBpfs:   make(map[string]*list.List),
+				HostConfig:     &config.Config{BPFWaitTimeout: 500 * time.Millisecond},
+				mu:             new(sync.Mutex),
+				waits:          newWaitRegistry(),
+			}
+			b := c.newBPF(&models.BPFProgram{Name: "foo"})
+			path := filepath.Join(t.TempDir(), "foo_next_prog_array")
+
+			// a start waiting for the map of the program, holding the lock
+			waiting := make(chan struct{})
+			result := make(chan error, 1)
+			go func() {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				end := b.startWaits("eth0", models.XDPIngressType)
+				defer end()
+				close(waiting)
+				result <- b.waitFor("pinned map", func() (bool, error) {
+					_, err := os.Stat(path)
+					return err == nil, err
+				}, path)
+			}()
+			<-waiting
+
+			start := time.Now()
+			if err := c.DeleteProgramsOnInterface(tt.deleteIface, c.HostName, &models.BPFProgramNames{XDPIngress: []string{"foo"}}); err != nil {
+				t.Fatalf("DeleteProgramsOnInterface() error = %v", err)
+			}
+			err := <-result
+			if err == nil {
+				t.Fatal("waitFor() succeeded")
+			}
+			if cancelled := strings.Contains(err.Error(), "cancelled"); cancelled != tt.wantCancelled {
+				t.Errorf("waitFor() error = %v, want cancelled %v", err, tt.wantCancelled)
+			}
+			if elapsed := time.Since(start); tt.wantCancelled && elapsed >= c.HostConfig.BPFWaitTimeout {
+				t.Errorf("delete returned after %s", elapsed)
+			}
+			if b.waitCtx.ctx != nil {
+				t.Error("the waits of the start are not released")
+			}
+			if len(c.waits.waits) != 0 {
+				t.Errorf("waits %v left registered", c.waits.waits)
+			}
+		})
+	}
+}
+
+func TestBPF_waitTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		seconds    int
+		hostConfig *config.Config
+		want       time.Duration
+	}{
+		{name: "NoConfig"},
+		{name: "HostDefault", hostConfig: &config.Config{BPFWaitTimeout: 10 * time.Second}, want: 10 * time.Second},
+		{name: "Program", seconds: 3, hostConfig: &config.Config{BPFWaitTimeout: 10 * time.Second}, want: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: models.BPFProgram{WaitTimeout: tt.seconds}, hostConfig: tt.hostConfig}
+			if got := b.waitTimeout(); got != tt.want {
+				t.Errorf("waitTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -58,6 +58,11 @@ func setupLogging() {
 }
 
 func main() {
+	// Commands of user programs with security settings are executed by l3afd itself
+	if len(os.Args) > 1 && os.Args[1] == kf.SandboxCommand {
+		kf.Sandbox(os.Args[2:])
+	}
+
 	setupLogging()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -125,6 +130,7 @@ func SetupNFConfigs(ctx context.Context, conf *config.Config) (*kf.NFConfigs, er
 	stats.SetupMetrics(machineHostname, daemonName, conf.MetricsAddr)
 
 	pMon := kf.NewpCheck(conf.MaxEBPFReStartCount, conf.BpfChainingEnabled, conf.EBPFPollInterval)
+	pMon.SetRestartPolicy(conf)
 	kfM := kf.NewpKFMetrics(conf.BpfChainingEnabled, conf.NMetricSamples)
 
 	nfConfigs, err := kf.NewNFConfigs(ctx, machineHostname, conf, pMon, kfM)
@@ -3,6 +3,8 @@
 
 package models
 
+import "time"
+
 // l3afd constants
 const (
 	Enabled  = "enabled"
@@ -12,12 +14,32 @@ const (
 	StopType   = "stop"
 	UpdateType = "update"
 
-	XDPType = "xdp"
-	TCType  = "tc"
+	XDPType            = "xdp"
+	TCType             = "tc"
+	CgroupSKBType      = "cgroup_skb"
+	CgroupSockAddrType = "cgroup_sock_addr"
+	SockOpsType        = "sockops"
+	KprobeType         = "kprobe"
+	TracepointType     = "tracepoint"
+	FentryType         = "fentry"
 
 	IngressType    = "ingress"
 	EgressType     = "egress"
 	XDPIngressType = "xdpingress"
+
+	// Cgroup hooks, sock_addr and sockops programs are attached to the hook of their program type,
+	// as are tracing programs
+	CgroupSKBIngressType = "cgroup_skb_ingress"
+	CgroupSKBEgressType  = "cgroup_skb_egress"
+
+	// Restart policies of user programs which are not running
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+
+	// Formats of list arguments of user program commands
+	ArgListComma  = "comma"  // --ports=80,443
+	ArgListRepeat = "repeat" // --ports=80 --ports=443
 )
 
 type L3afDNFArgs map[string]interface{}
@@ -37,10 +59,12 @@ type BPFProgram struct {
 	Version           string              `json:"version"`               // Program version
 	UserProgramDaemon bool                `json:"user_program_daemon"`   // User program daemon or not
 	IsPlugin          bool                `json:"is_plugin"`             // User program is plugin or not
-	CPU               int                 `json:"cpu"`                   // User program cpu limits
-	Memory            int                 `json:"memory"`                // User program memory limits
+	CPU               int                 `json:"cpu"`                   // User program cpu limit in millicores
+	Memory            int                 `json:"memory"`                // User program memory limit in bytes
+	IOWeight          int                 `json:"io_weight"`             // User program io weight, 1 to 10000
+	PidsMax           int                 `json:"pids_max"`              // User program maximum number of processes
 	AdminStatus       string              `json:"admin_status"`          // Program admin status enabled or disabled
-	ProgType          string              `json:"prog_type"`             // Program type XDP or TC
+	ProgType          string              `json:"prog_type"`             // Program type XDP, TC, cgroup_skb, cgroup_sock_addr, sockops, kprobe, tracepoint or fentry
 	RulesFile         string              `json:"rules_file"`            // Config rules file name
 	Rules             string              `json:"rules"`                 // Config rules
 	ConfigFilePath    string              `json:"config_file_path"`      // Config file location
@@ -51,10 +75,39 @@ type BPFProgram struct {
 	UpdateArgs        L3afDNFArgs         `json:"update_args"`           // Map of arguments to update command
 	MapArgs           L3afDNFArgs         `json:"map_args"`              // Config BPF Map of arguments
 	ConfigArgs        L3afDNFArgs         `json:"config_args"`           // Map of arguments to config command
+	ArgListFormat     string              `json:"arg_list_format"`       // comma (default) or repeat, format of list arguments
 	MonitorMaps       []L3afDNFMetricsMap `json:"monitor_maps"`          // Metrics BPF maps
 	EPRURL            string              `json:"ebpf_package_repo_url"` // Download url for Program
 	ObjectFile        string              `json:"object_file"`           // Object file contains kernel code
 	EntryFunctionName string              `json:"entry_function_name"`   // BPF entry function name to load
+	ArtifactSHA256    string              `json:"artifact_sha256"`       // Expected hex encoded SHA-256 digest of the artifact
+	ArtifactSignature string              `json:"artifact_signature"`    // Base64 encoded ed25519 signature of the artifact SHA-256 digest
+	RestartPolicy     string              `json:"restart_policy"`        // always (default), on-failure or never
+	StopGracePeriod   int                 `json:"stop_grace_period"`     // Seconds given to the user program to exit once stopped before it is killed, host default when 0
+	WaitTimeout       int                 `json:"wait_timeout"`          // Seconds the program is waited for to pin or remove its maps, host default when 0
+	Security          *BPFProgramSecurity `json:"security,omitempty"`    // Privileges of the user program commands, those of l3afd when nil
+	Env               map[string]string   `json:"env,omitempty"`         // Environment variables of the user program commands
+	Secrets           []BPFProgramSecret  `json:"secrets,omitempty"`     // Secret files of the host given to the user program
+
+	EPRURLs []string `json:"ebpf_package_repo_urls"` // Mirror download urls for Program, tried in order after EPRURL
+}
+
+// BPFProgramSecret defines a secret file of the host given to a user program, in an environment
+// variable or in the private secrets directory of the program
+type BPFProgramSecret struct {
+	Name string `json:"name"` // Secret name, file name in the secrets directory of the program
+	File string `json:"file"` // Secret file, relative to the secrets directory of l3afd
+	Env  string `json:"env"`  // Environment variable set to the secret, the secret is written to the secrets directory when empty
+}
+
+// BPFProgramSecurity defines the privileges of the commands of a user program
+type BPFProgramSecurity struct {
+	User           string   `json:"user"`            // Run as user name or uid, root when empty
+	Group          string   `json:"group"`           // Run as group name or gid, primary group of the user when empty
+	Capabilities   []string `json:"capabilities"`    // Retained capabilities, such as CAP_BPF, all others are dropped
+	NoNewPrivs     bool     `json:"no_new_privs"`    // Set no_new_privs, always set with a seccomp profile
+	SeccompProfile string   `json:"seccomp_profile"` // Compiled seccomp filter in the artifact
+	MountNamespace bool     `json:"mount_namespace"` // Run in a private mount namespace
 }
 
 // L3afDNFMetricsMap defines BPF map
@@ -66,28 +119,120 @@ type L3afDNFMetricsMap struct {
 
 // L3afBPFPrograms defines configs for a node
 type L3afBPFPrograms struct {
-	HostName    string       `json:"host_name"`    // Host name or pod name
-	Iface       string       `json:"iface"`        // Interface name
-	BpfPrograms *BPFPrograms `json:"bpf_programs"` // List of bpf programs
+	HostName     string       `json:"host_name"`               // Host name or pod name
+	Iface        string       `json:"iface"`                   // Interface name
+	CgroupPath   string       `json:"cgroup_path,omitempty"`   // Cgroup v2 directory, instead of the interface for cgroup programs
+	AttachTarget string       `json:"attach_target,omitempty"` // Kernel function or <group>/<name> tracepoint, instead of the interface for tracing programs
+	BpfPrograms  *BPFPrograms `json:"bpf_programs"`            // List of bpf programs
 }
 
 // BPFPrograms for a node
 type BPFPrograms struct {
-	XDPIngress []*BPFProgram `json:"xdp_ingress"` // list of xdp ingress bpf programs
-	TCIngress  []*BPFProgram `json:"tc_ingress"`  // list of tc ingress bpf programs
-	TCEgress   []*BPFProgram `json:"tc_egress"`   // list of tc egress bpf programs
+	XDPIngress       []*BPFProgram `json:"xdp_ingress"`                  // list of xdp ingress bpf programs
+	TCIngress        []*BPFProgram `json:"tc_ingress"`                   // list of tc ingress bpf programs
+	TCEgress         []*BPFProgram `json:"tc_egress"`                    // list of tc egress bpf programs
+	CgroupSKBIngress []*BPFProgram `json:"cgroup_skb_ingress,omitempty"` // list of cgroup skb ingress bpf programs
+	CgroupSKBEgress  []*BPFProgram `json:"cgroup_skb_egress,omitempty"`  // list of cgroup skb egress bpf programs
+	CgroupSockAddr   []*BPFProgram `json:"cgroup_sock_addr,omitempty"`   // list of cgroup sock_addr bpf programs
+	SockOps          []*BPFProgram `json:"sockops,omitempty"`            // list of cgroup sockops bpf programs
+	Kprobe           []*BPFProgram `json:"kprobe,omitempty"`             // list of kprobe bpf programs
+	Tracepoint       []*BPFProgram `json:"tracepoint,omitempty"`         // list of tracepoint bpf programs
+	Fentry           []*BPFProgram `json:"fentry,omitempty"`             // list of fentry bpf programs
 }
 
 // L3afBPFProgramNames defines names of Bpf programs on interface
 type L3afBPFProgramNames struct {
-	HostName        string           `json:"host_name"`    // Host name or pod name
-	Iface           string           `json:"iface"`        // Interface name
-	BpfProgramNames *BPFProgramNames `json:"bpf_programs"` // List of eBPF program names to remove
+	HostName        string           `json:"host_name"`               // Host name or pod name
+	Iface           string           `json:"iface"`                   // Interface name
+	CgroupPath      string           `json:"cgroup_path,omitempty"`   // Cgroup v2 directory, instead of the interface for cgroup programs
+	AttachTarget    string           `json:"attach_target,omitempty"` // Kernel function or <group>/<name> tracepoint, instead of the interface for tracing programs
+	BpfProgramNames *BPFProgramNames `json:"bpf_programs"`            // List of eBPF program names to remove
 }
 
 // BPFProgramNames defines names of eBPF programs on node
 type BPFProgramNames struct {
-	XDPIngress []string `json:"xdp_ingress"` // names of the XDP ingress eBPF programs
-	TCIngress  []string `json:"tc_ingress"`  // names of the TC ingress eBPF programs
-	TCEgress   []string `json:"tc_egress"`   // names of the TC egress eBPF programs
+	XDPIngress       []string `json:"xdp_ingress"`                  // names of the XDP ingress eBPF programs
+	TCIngress        []string `json:"tc_ingress"`                   // names of the TC ingress eBPF programs
+	TCEgress         []string `json:"tc_egress"`                    // names of the TC egress eBPF programs
+	CgroupSKBIngress []string `json:"cgroup_skb_ingress,omitempty"` // names of the cgroup skb ingress eBPF programs
+	CgroupSKBEgress  []string `json:"cgroup_skb_egress,omitempty"`  // names of the cgroup skb egress eBPF programs
+	CgroupSockAddr   []string `json:"cgroup_sock_addr,omitempty"`   // names of the cgroup sock_addr eBPF programs
+	SockOps          []string `json:"sockops,omitempty"`            // names of the cgroup sockops eBPF programs
+	Kprobe           []string `json:"kprobe,omitempty"`             // names of the kprobe eBPF programs
+	Tracepoint       []string `json:"tracepoint,omitempty"`         // names of the tracepoint eBPF programs
+	Fentry           []string `json:"fentry,omitempty"`             // names of the fentry eBPF programs
+}
+
+// ArtifactCacheEntry defines an extracted eBPF package version in BPFDir
+type ArtifactCacheEntry struct {
+	Name      string    `json:"name"`       // Name of the BPF program package
+	Version   string    `json:"version"`    // Version of the BPF program package
+	SizeBytes int64     `json:"size_bytes"` // Disk usage of the extracted package
+	LastUsed  time.Time `json:"last_used"`  // Last time the package was deployed
+	InUse     bool      `json:"in_use"`     // Whether the package is referenced by a running BPF program
+}
+
+// Platform defines the platform resolution of the node
+type Platform struct {
+	Platform   string            `json:"platform"`   // Most specific platform of the node
+	Candidates []string          `json:"candidates"` // Platform directories of the eBPF package repository tried in order
+	Override   bool              `json:"override"`   // Whether the platform directories are configured in l3afd.cfg
+	OSRelease  map[string]string `json:"os_release"` // ID, VERSION_ID and VERSION_CODENAME of the operating system
+}
+
+// ArtifactRef identifies an eBPF package in an eBPF package repository
+type ArtifactRef struct {
+	Name              string `json:"name"`                  // Name of the BPF program package
+	Version           string `json:"version"`               // Version of the BPF program package
+	Artifact          string `json:"artifact"`              // Artifact file name
+	EPRURL            string `json:"ebpf_package_repo_url"` // Repository URL, the configured repository if empty
+	ArtifactSHA256    string `json:"artifact_sha256"`       // Expected hex encoded SHA-256 digest of the artifact
+	ArtifactSignature string `json:"artifact_signature"`    // Base64 encoded ed25519 signature of the artifact digest
+
+	EPRURLs []string `json:"ebpf_package_repo_urls"` // Repository mirror URLs tried in order after EPRURL
+}
+
+// ArtifactPrefetchStatus defines the state of an eBPF package prefetch
+type ArtifactPrefetchStatus struct {
+	ArtifactRef
+	State     string    `json:"state"`           // pending, downloading, ready or failed
+	Error     string    `json:"error,omitempty"` // Reason of the failure
+	UpdatedAt time.Time `json:"updated_at"`      // Last state change
+}
+
+// ProcessExit defines how the user program of a BPF program exited
+type ProcessExit struct {
+	Pid      int       `json:"pid"`              // Process id of the user program
+	ExitCode int       `json:"exit_code"`        // Exit code, -1 when the process was terminated by a signal
+	Signal   string    `json:"signal,omitempty"` // Signal which terminated the process
+	Time     time.Time `json:"time"`             // Time of the exit
+}
+
+// BPFProgramStatus defines the run time state of a BPF program
+type BPFProgramStatus struct {
+	Name          string            `json:"name"`                   // Name of the BPF program package
+	Version       string            `json:"version"`                // Program version
+	AttachPoint   string            `json:"attach_point"`           // Interface, cgroup path or attach target
+	Direction     string            `json:"direction"`              // Direction or hook of the program
+	State         string            `json:"state"`                  // running, restarting, crash-loop, exited or disabled
+	RestartPolicy string            `json:"restart_policy"`         // always, on-failure or never
+	RestartCount  int               `json:"restart_count"`          // Restarts since the program last ran for the success window
+	NextRestart   *time.Time        `json:"next_restart,omitempty"` // Time of the next restart attempt, while restarting
+	LastExit      *ProcessExit      `json:"last_exit,omitempty"`    // Last exit of the user program
+	Events        []BPFProgramEvent `json:"events,omitempty"`       // Recent events of the program, oldest first
+}
+
+// BPFProgramEvent defines an event of the life cycle of a program
+type BPFProgramEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"` // started, stopped, exited, restarted, crash-loop or killed
+	Message string    `json:"message"`
+}
+
+// BPFProgramLog defines the last lines of the captured output of a user program
+type BPFProgramLog struct {
+	Name        string   `json:"name"`         // Name of the BPF program package
+	AttachPoint string   `json:"attach_point"` // Interface, cgroup path or attach target
+	Direction   string   `json:"direction"`    // Direction or hook of the program
+	Lines       []string `json:"lines"`        // Last lines of stdout and stderr, oldest first
 }
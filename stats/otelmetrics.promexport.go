@@ -31,9 +31,15 @@ var (
 	NFStartCount  *api.Int64Counter
 	NFStopCount   *api.Int64Counter
 	NFUpdateCount *api.Int64Counter
+	NFRestartCount *api.Int64Counter
+	NFForcedKillCount *api.Int64Counter
 	NFRunning     *api.Float64ObservableGauge
 	NFStartTime   *api.Float64ObservableGauge
 	NFMonitorMap  *api.Float64ObservableGauge
+	NFCrashLoop   *api.Float64ObservableGauge
+	NFMemoryUsage *api.Float64ObservableGauge
+	NFCPUUsage    *api.Float64ObservableGauge
+	NFPidsCount   *api.Float64ObservableGauge
 
 	NFRlRecvCount *api.Float64ObservableGauge
 	NFRlDropCount *api.Float64ObservableGauge
@@ -82,6 +88,22 @@ func SetupMetrics(hostname, daemonName, metricsAddr string) {
 	NFUpdateCount = &updateCount
 	counterValues[NFUpdateCount] = NewCounterValue(metricName, attribs)
 
+	metricName = daemonName + "_OtelNFRestartCount"
+	restartCount, err := meter.Int64Counter(metricName, api.WithDescription("The count of network functions restarted after they stopped running"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NFRestartCount = &restartCount
+	counterValues[NFRestartCount] = NewCounterValue(metricName, attribs)
+
+	metricName = daemonName + "_OtelNFForcedKillCount"
+	forcedKillCount, err := meter.Int64Counter(metricName, api.WithDescription("The count of network functions killed after they did not exit within their stop grace period"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NFForcedKillCount = &forcedKillCount
+	counterValues[NFForcedKillCount] = NewCounterValue(metricName, attribs)
+
 	gaugeValues = make(map[*api.Float64ObservableGauge]*OtelGaugeValue)
 	metricName = daemonName + "_OtelNFRunning"
 	runningGugage, err := meter.Float64ObservableGauge(metricName, api.WithDescription("This value indicates network functions is running or not"))
@@ -107,6 +129,38 @@ func SetupMetrics(hostname, daemonName, metricsAddr string) {
 	NFMonitorMap = &monitorMapGuage
 	gaugeValues[NFMonitorMap] = NewGaugeValue(metricName, attribs)
 
+	metricName = daemonName + "_OtelNFCrashLoop"
+	crashLoopGuage, err := meter.Float64ObservableGauge(metricName, api.WithDescription("This value indicates network function is in crash loop, its restarts are exhausted"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NFCrashLoop = &crashLoopGuage
+	gaugeValues[NFCrashLoop] = NewGaugeValue(metricName, attribs)
+
+	metricName = daemonName + "_OtelNFMemoryUsage"
+	memoryUsageGuage, err := meter.Float64ObservableGauge(metricName, api.WithDescription("This value indicates memory usage in bytes of the cgroup of network function"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NFMemoryUsage = &memoryUsageGuage
+	gaugeValues[NFMemoryUsage] = NewGaugeValue(metricName, attribs)
+
+	metricName = daemonName + "_OtelNFCPUUsage"
+	cpuUsageGuage, err := meter.Float64ObservableGauge(metricName, api.WithDescription("This value indicates cpu time in seconds consumed by the cgroup of network function"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NFCPUUsage = &cpuUsageGuage
+	gaugeValues[NFCPUUsage] = NewGaugeValue(metricName, attribs)
+
+	metricName = daemonName + "_OtelNFPidsCount"
+	pidsCountGuage, err := meter.Float64ObservableGauge(metricName, api.WithDescription("This value indicates number of processes in the cgroup of network function"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NFPidsCount = &pidsCountGuage
+	gaugeValues[NFPidsCount] = NewGaugeValue(metricName, attribs)
+
 	metricName = daemonName + "_RLRecvCount"
 	NFRlRecvCountGauge, err := meter.Float64ObservableGauge(metricName, api.WithDescription("This value indicates network packets received by the rate limiter"))
 	if err != nil {